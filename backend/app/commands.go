@@ -0,0 +1,97 @@
+package app
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"oneimg/backend/controllers"
+	"oneimg/backend/models"
+)
+
+// commands 命令行子命令，用法: oneimg <command>
+var commands = map[string]struct {
+	usage string
+	run   func(system *System, args []string) error
+}{
+	"backfill": {
+		usage: "为历史图片补算感知哈希、BlurHash 与主色调",
+		run:   runBackfill,
+	},
+	"presets": {
+		usage: "按当前预设重建所有图片的衍生图，可指定预设名: presets thumb preview",
+		run:   runPresets,
+	},
+	"import": {
+		usage: "导入收件目录（或指定目录）中的图片与压缩包: import [目录]",
+		run:   runImport,
+	},
+}
+
+// RunCommand 执行命令行子命令
+func RunCommand(system *System, args []string) error {
+	command, ok := commands[args[0]]
+	if !ok {
+		var usage strings.Builder
+		for name, cmd := range commands {
+			fmt.Fprintf(&usage, "\n  %-12s %s", name, cmd.usage)
+		}
+		return fmt.Errorf("未知命令: %s，可用命令:%s", args[0], usage.String())
+	}
+	return command.run(system, args[1:])
+}
+
+// runBackfill 同步回填缺少感知哈希或占位图的图片
+func runBackfill(system *System, args []string) error {
+	db := system.Database.DB
+	images, err := controllers.ImagesMissingFeatures(db)
+	if err != nil {
+		return fmt.Errorf("查询图片失败: %v", err)
+	}
+	if len(images) == 0 {
+		log.Println("没有需要处理的图片")
+		return nil
+	}
+
+	log.Printf("开始回填 %d 张图片...", len(images))
+	updated := controllers.BackfillImageFeatures(db, images, nil)
+	log.Printf("回填完成，更新 %d 张，失败 %d 张", updated, len(images)-updated)
+	return nil
+}
+
+// runPresets 同步重建所有图片的预设衍生图
+func runPresets(system *System, args []string) error {
+	presets, err := controllers.SelectPresets(args)
+	if err != nil {
+		return err
+	}
+	var images []models.Image
+	if err := system.Database.DB.Order("id asc").Find(&images).Error; err != nil {
+		return fmt.Errorf("查询图片失败: %v", err)
+	}
+
+	log.Printf("开始为 %d 张图片重建 %d 个预设...", len(images), len(presets))
+	updated := controllers.RegeneratePresetFiles(images, presets, nil, nil)
+	log.Printf("重建完成，成功 %d 张，失败 %d 张", updated, len(images)-updated)
+	return nil
+}
+
+// runImport 同步导入目录中的文件，成功的移入归档目录或删除，失败的移入隔离目录
+func runImport(system *System, args []string) error {
+	dir := system.Config.InboxPath
+	if len(args) > 0 {
+		dir = args[0]
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return fmt.Errorf("目录不存在: %s", dir)
+	}
+
+	log.Printf("开始导入目录 %s ...", dir)
+	succeeded, failed, err := controllers.ImportInbox(dir, system.Config, system.Database)
+	if err != nil {
+		return fmt.Errorf("导入失败: %v", err)
+	}
+	log.Printf("导入完成，成功 %d 个，失败 %d 个（见 %s）", succeeded, failed, system.Config.InboxQuarantinePath)
+	return nil
+}
@@ -1,12 +1,16 @@
 package app
 
 import (
+	"encoding/json"
 	"log"
+	"time"
 
 	"oneimg/backend/config"
+	"oneimg/backend/controllers"
 	"oneimg/backend/database"
 	"oneimg/backend/models"
 	"oneimg/backend/services"
+	"oneimg/backend/storage"
 
 	"golang.org/x/crypto/bcrypt"
 )
@@ -25,12 +29,47 @@ func Init() *System {
 	// 获取数据库实例
 	db := database.GetDB()
 
+	// 初始化存储后端
+	storage.InitStorage(cfg)
+
 	// 初始化图片服务
-	services.InitImageService()
+	services.InitImageService(services.OutputSettings{
+		ThumbnailFormat:  cfg.ThumbnailFormat,
+		PreviewFormat:    cfg.PreviewFormat,
+		ThumbnailQuality: cfg.ThumbnailQuality,
+		PreviewQuality:   cfg.PreviewQuality,
+		TransformQuality: cfg.TransformQuality,
+		AVIFSpeed:        cfg.AVIFSpeed,
+		ThumbnailCrop:    cfg.ThumbnailCrop,
+		TransformCrop:    cfg.TransformCrop,
+		RenditionFormat:  cfg.RenditionFormat,
+		RenditionQuality: cfg.RenditionQuality,
+		Animation: services.AnimationSettings{
+			Enabled:      cfg.AnimatedThumbnails,
+			Format:       cfg.AnimatedFormat,
+			MaxFrames:    cfg.GIFMaxFrames,
+			MaxDuration:  time.Duration(cfg.GIFMaxDuration) * time.Second,
+			MaxPixels:    cfg.GIFMaxPixels,
+			StoreAsWebP:  cfg.GIFToWebP,
+			StoreMinSize: cfg.GIFToWebPMinSize,
+			StoreQuality: cfg.GIFToWebPQuality,
+		},
+	})
+	services.InitVariantCache(cfg.TransformCachePath, cfg.TransformCacheMaxSize)
+	services.InitTusStore(cfg.TusUploadPath, cfg.TusExpiration)
 
 	// 初始化默认用户
 	InitDefaultUser(cfg, db)
 
+	// 加载水印配置
+	InitWatermark(db)
+
+	// 加载图片预设
+	InitPresets(db)
+
+	// 构建相似图片索引
+	InitSimilarIndex(db)
+
 	r := &System{
 		Config:   cfg,
 		Database: db,
@@ -79,3 +118,76 @@ func InitDefaultUser(cfg *config.Config, db *database.Database) {
 
 	log.Printf("默认用户创建成功 - 用户名: %s, 默认密码: %s", defaultUser.Username, defaultPassword)
 }
+
+// StartInboxWatcher 按配置在后台监听收件目录，仅在服务模式下调用
+func StartInboxWatcher(system *System) {
+	cfg := system.Config
+	if !cfg.InboxWatch {
+		return
+	}
+	if _, err := controllers.StartInboxWatcher(cfg, system.Database); err != nil {
+		log.Printf("收件目录监听启动失败: %v", err)
+		return
+	}
+	log.Printf("正在监听收件目录: %s", cfg.InboxPath)
+}
+
+// InitSimilarIndex 将已计算的感知哈希载入内存索引
+func InitSimilarIndex(db *database.Database) {
+	var rows []struct {
+		Id    int
+		PHash string `gorm:"column:phash"`
+	}
+	if err := db.DB.Model(&models.Image{}).Select("id, phash").Where("phash <> ?", "").Scan(&rows).Error; err != nil {
+		log.Println("加载感知哈希失败:", err)
+		return
+	}
+	for _, row := range rows {
+		if hash, err := services.ParsePHash(row.PHash); err == nil {
+			services.Similar.Add(row.Id, hash)
+		}
+	}
+	log.Printf("相似图片索引已加载 %d 张图片", services.Similar.Len())
+}
+
+// InitPresets 从设置中加载图片预设，未保存过时使用内置预设
+func InitPresets(db *database.Database) {
+	var setting models.Settings
+	result := db.DB.Where("`key` = ?", "image_presets").Limit(1).Find(&setting)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return
+	}
+
+	var presets []models.ImagePreset
+	if err := json.Unmarshal([]byte(setting.Value), &presets); err != nil {
+		log.Println("图片预设解析失败:", err)
+		return
+	}
+	if err := services.SetPresets(presets); err != nil {
+		log.Println("图片预设加载失败:", err)
+		return
+	}
+	log.Printf("已加载 %d 个图片预设", len(services.CurrentPresets()))
+}
+
+// InitWatermark 从设置中加载水印配置，加载失败时不启用水印
+func InitWatermark(db *database.Database) {
+	var setting models.Settings
+	result := db.DB.Where("`key` = ?", "watermark_config").Limit(1).Find(&setting)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return
+	}
+
+	wmConfig := services.DefaultWatermarkConfig()
+	if err := json.Unmarshal([]byte(setting.Value), &wmConfig); err != nil {
+		log.Println("水印配置解析失败:", err)
+		return
+	}
+	if err := services.LoadWatermark(wmConfig); err != nil {
+		log.Println("水印加载失败:", err)
+		return
+	}
+	if wmConfig.Enabled {
+		log.Println("水印已启用")
+	}
+}
@@ -1,10 +1,14 @@
 package config
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
 	"log"
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -23,9 +27,84 @@ type Config struct {
 	DbName     string
 
 	// 上传文件配置
-	MaxFileSize  int64
-	AllowedTypes []string
-	UploadPath   string
+	MaxFileSize   int64
+	AllowedTypes  []string
+	MaxMegapixels float64 // 解码前按声明尺寸检查的像素上限（百万像素），0 表示不限制
+	MaxGIFFrames  int     // GIF 帧数上限，超出时拒绝上传，0 表示不限制
+	UploadPath    string
+
+	// 远程地址上传配置
+	RemoteUploadTimeout      time.Duration // 单个地址的下载超时（含读取响应体）
+	RemoteUploadMaxURLs      int           // 单次请求最多的地址数
+	RemoteUploadAllowPrivate bool          // 允许下载内网地址，默认禁止以防 SSRF
+
+	// tus 可续传上传配置
+	TusUploadPath string        // 未完成上传的临时目录
+	TusExpiration time.Duration // 上传在最后一次写入后多久未完成即过期清理
+
+	// 压缩包批量导入配置
+	ImportPath         string // 管理员可导入的服务器端目录，导入路径必须位于其中
+	ImportMaxEntries   int    // 单个压缩包的图片数上限
+	ImportMaxTotalSize int64  // 压缩包大小与解压总大小上限
+
+	// 收件目录导入配置
+	InboxPath           string        // 收件目录，放入的图片按上传流程导入
+	InboxWatch          bool          // 是否在后台监听收件目录
+	InboxAfter          string        // 导入成功后的文件去向: archive 移入归档目录 / delete 删除
+	InboxArchivePath    string        // 归档目录，按日期分子目录
+	InboxQuarantinePath string        // 导入失败的文件与失败原因
+	InboxFolderCategory bool          // 以子目录名作为分类
+	InboxSettle         time.Duration // 文件多久没有写入视为写入完成
+
+	// 按需变换配置
+	TransformCachePath    string
+	TransformCacheMaxSize int64
+	TransformSizes        []int
+	TransformQualities    []int
+
+	// 衍生图输出配置
+	ThumbnailFormat  string         // 缩略图格式: webp / avif / jpeg
+	PreviewFormat    string         // 预览图格式: webp / avif / jpeg
+	ThumbnailQuality map[string]int // 缩略图各格式质量，如 webp:80,avif:60
+	PreviewQuality   map[string]int // 预览图各格式质量
+	TransformQuality map[string]int // 按需变换未指定 q 时各格式的默认质量
+	AVIFSpeed        int            // AVIF 编码速度 0~10，越大越快、体积越大
+	ThumbnailCrop    string         // 缩略图裁剪: none 等比缩放 / center 居中裁剪 / smart 智能裁剪
+	TransformCrop    string         // 按需变换 fit=cover 默认裁剪: center / smart，可用 crop 参数覆盖
+
+	// HEIC/TIFF/BMP 上传转换配置
+	RenditionFormat    string // 转换后的主图格式: jpeg / webp
+	RenditionQuality   int
+	KeepSourceOriginal bool // 是否同时保留上传的原始文件
+
+	// 原图 EXIF 隐私处理: none 保留 / gps 清除位置 / all 清除全部（保留方向），上传时可通过 strip_exif 覆盖
+	StripExif string
+
+	// 相似图片检测: off / warn 提示 / reject 拒绝，上传时可通过 near_duplicate 覆盖
+	NearDuplicate          string
+	NearDuplicateThreshold int // 感知哈希汉明距离不超过该值视为相似
+
+	// 动图配置
+	AnimatedThumbnails bool   // 为多帧 GIF 生成动态缩略图/预览图
+	AnimatedFormat     string // 动态缩略图格式: webp / gif
+	GIFMaxFrames       int
+	GIFMaxDuration     int   // 秒
+	GIFMaxPixels       int64 // 帧数 × 画布像素
+	GIFToWebP          bool  // 较大的 GIF 主图转换为动态 WebP 保存
+	GIFToWebPMinSize   int64
+	GIFToWebPQuality   int
+
+	// Accept 协商配置
+	NegotiateFormats     []string // 按 Accept 请求头协商的现代格式 (webp/avif)，为空时关闭
+	NegotiateQuality     int      // 生成现代格式兄弟文件的质量
+	NegotiatePregenerate bool     // 上传时预先生成兄弟文件，否则首次访问时生成
+
+	// 存储配置
+	StorageDriver  string
+	StorageRetries int
+	S3Config       S3Config
+	WebDAVConfig   WebDAVConfig
+	SFTPConfig     SFTPConfig
 
 	// 默认用户
 	DefaultUser string
@@ -35,6 +114,11 @@ type Config struct {
 	JWTSecret     string
 	SessionSecret string
 
+	// 签名URL配置
+	SignKey        string // HMAC 密钥，未设置时由 JWTSecret 派生，为空表示签名不可用
+	SignUploads    bool   // /uploads 是否要求签名
+	SignTransforms bool   // /img 按需变换是否要求签名
+
 	// AI 配置
 	AiApiUrl string
 	AiApiKey string
@@ -54,9 +138,52 @@ type GitHubConfig struct {
 	RedirectURL  string
 }
 
+// S3Config S3 兼容对象存储配置 (AWS S3 / MinIO / R2 等)
+type S3Config struct {
+	Endpoint  string // 例如 s3.amazonaws.com 或 http://127.0.0.1:9000
+	Region    string
+	Bucket    string
+	Prefix    string // 对象 key 前缀，例如 oneimg/
+	AccessKey string
+	SecretKey string
+	UseSSL    bool
+	PathStyle bool   // MinIO 等自建服务通常需要开启
+	PublicURL string // 公开访问地址，为空时通过本应用 /uploads 代理访问
+}
+
+// WebDAVConfig WebDAV 存储配置
+type WebDAVConfig struct {
+	URL      string // 例如 https://nas.example.com/dav/oneimg
+	Username string
+	Password string
+	MaxConns int // 每个主机保持的最大空闲连接数
+}
+
+// SFTPConfig SFTP 存储配置
+type SFTPConfig struct {
+	Host       string
+	Port       int
+	Username   string
+	Password   string
+	PrivateKey string // 私钥文件路径，与密码二选一
+	HostKey    string // 服务器公钥 (authorized_keys 格式)
+	KnownHosts string // known_hosts 文件路径，未配置 HostKey 时使用
+	RootPath   string // 远程存储根目录
+	MaxConns   int    // 同时打开的最大连接数
+
+	// 不校验服务器公钥，必须显式开启，HostKey 与 KnownHosts 都未配置时才生效
+	InsecureIgnoreHostKey bool
+}
+
 // 设置全局
 var App *Config
 
+// 公开的默认 JWT 密钥，不能用于派生签名密钥
+const defaultJWTSecret = "your-secret-key-change-this-in-production"
+
+// 旧版 .env.example 中的 ALLOWED_TYPES，当时并未按该列表校验上传
+const legacyAllowedTypes = "image/jpeg,image/png,image/gif"
+
 func NewConfig() {
 	err := godotenv.Load()
 	if err != nil {
@@ -64,7 +191,45 @@ func NewConfig() {
 	}
 
 	maxFileSize, _ := strconv.ParseInt(getEnv("MAX_FILE_SIZE", "10485760"), 10, 64)
-	allowedTypes := strings.Split(getEnv("ALLOWED_TYPES", "image/jpeg,image/png,image/gif"), ",")
+	allowedTypes := strings.Split(getEnv("ALLOWED_TYPES", "image/jpeg,image/png,image/gif,image/webp,image/bmp,image/tiff,image/heic,image/heif,image/svg+xml"), ",")
+	for i := range allowedTypes {
+		allowedTypes[i] = strings.TrimSpace(allowedTypes[i])
+	}
+	if strings.Join(allowedTypes, ",") == legacyAllowedTypes {
+		log.Println("警告: ALLOWED_TYPES 仍为旧版默认值，现在上传按该列表校验，WebP/BMP/TIFF/HEIC/SVG 将被拒绝；如需支持请参照 .env.example 更新")
+	}
+	maxMegapixels, _ := strconv.ParseFloat(getEnv("MAX_MEGAPIXELS", "100"), 64)
+	maxGIFFrames, _ := strconv.Atoi(getEnv("MAX_GIF_FRAMES", "1000"))
+	remoteUploadTimeout, _ := strconv.Atoi(getEnv("REMOTE_UPLOAD_TIMEOUT", "30"))
+	if remoteUploadTimeout <= 0 {
+		remoteUploadTimeout = 30
+	}
+	remoteUploadMaxURLs, _ := strconv.Atoi(getEnv("REMOTE_UPLOAD_MAX_URLS", "10"))
+	if remoteUploadMaxURLs <= 0 {
+		remoteUploadMaxURLs = 10
+	}
+	remoteUploadAllowPrivate := getEnv("REMOTE_UPLOAD_ALLOW_PRIVATE", "false") == "true"
+	tusUploadPath := getEnv("TUS_UPLOAD_PATH", "./data/tus")
+	tusExpiration, _ := strconv.Atoi(getEnv("TUS_EXPIRATION", "24"))
+	if tusExpiration <= 0 {
+		tusExpiration = 24
+	}
+	importPath := getEnv("IMPORT_PATH", "./data/import")
+	importMaxEntries, _ := strconv.Atoi(getEnv("IMPORT_MAX_ENTRIES", "10000"))
+	importMaxTotalSize, _ := strconv.ParseInt(getEnv("IMPORT_MAX_TOTAL_SIZE", "2147483648"), 10, 64)
+	inboxPath := getEnv("INBOX_PATH", "./data/inbox")
+	inboxWatch := getEnv("INBOX_WATCH", "false") == "true"
+	inboxAfter := strings.ToLower(getEnv("INBOX_AFTER", "archive"))
+	if inboxAfter != "delete" {
+		inboxAfter = "archive"
+	}
+	inboxArchivePath := getEnv("INBOX_ARCHIVE_PATH", "./data/inbox-archive")
+	inboxQuarantinePath := getEnv("INBOX_QUARANTINE_PATH", "./data/inbox-quarantine")
+	inboxFolderCategory := getEnv("INBOX_FOLDER_CATEGORY", "true") == "true"
+	inboxSettle, _ := strconv.Atoi(getEnv("INBOX_SETTLE", "2"))
+	if inboxSettle <= 0 {
+		inboxSettle = 2
+	}
 	port := getEnv("SERVER_PORT", getEnv("PORT", "8080"))
 
 	sqlitePath := getEnv("SQLITE_PATH", "./data/data.db")
@@ -76,12 +241,68 @@ func NewConfig() {
 	dbName := getEnv("DB_NAME", "oneimgxru")
 
 	uploadPath := getEnv("UPLOAD_PATH", "./uploads")
+	transformCachePath := getEnv("TRANSFORM_CACHE_PATH", "./data/cache/variants")
+	transformCacheMaxSize, _ := strconv.ParseInt(getEnv("TRANSFORM_CACHE_MAX_SIZE", "1073741824"), 10, 64)
+	transformSizes := parseIntList(getEnv("TRANSFORM_SIZES", "64,128,160,240,320,480,640,800,960,1080,1280,1600,1920"))
+	transformQualities := parseIntList(getEnv("TRANSFORM_QUALITIES", "50,60,70,75,80,85,90"))
+	thumbnailFormat := strings.ToLower(getEnv("THUMBNAIL_FORMAT", "webp"))
+	previewFormat := strings.ToLower(getEnv("PREVIEW_FORMAT", "webp"))
+	thumbnailQuality := parseQualityMap(getEnv("THUMBNAIL_QUALITY", "webp:80,avif:60,jpeg:85"))
+	previewQuality := parseQualityMap(getEnv("PREVIEW_QUALITY", "webp:75,avif:55,jpeg:80"))
+	transformQuality := parseQualityMap(getEnv("TRANSFORM_DEFAULT_QUALITY", "webp:80,avif:60,jpeg:85"))
+	avifSpeed, _ := strconv.Atoi(getEnv("AVIF_SPEED", "8"))
+	thumbnailCrop := strings.ToLower(getEnv("THUMBNAIL_CROP", "none"))
+	transformCrop := strings.ToLower(getEnv("TRANSFORM_CROP", "center"))
+	renditionFormat := strings.ToLower(getEnv("RENDITION_FORMAT", "jpeg"))
+	renditionQuality, _ := strconv.Atoi(getEnv("RENDITION_QUALITY", "90"))
+	keepSourceOriginal := getEnv("KEEP_SOURCE_ORIGINAL", "true") == "true"
+	stripExif := strings.ToLower(getEnv("STRIP_EXIF", "gps"))
+	if stripExif != "none" && stripExif != "all" {
+		stripExif = "gps"
+	}
+	nearDuplicate := strings.ToLower(getEnv("NEAR_DUPLICATE", "warn"))
+	if nearDuplicate != "off" && nearDuplicate != "reject" {
+		nearDuplicate = "warn"
+	}
+	nearDuplicateThreshold, _ := strconv.Atoi(getEnv("NEAR_DUPLICATE_THRESHOLD", "6"))
+	if nearDuplicateThreshold < 0 || nearDuplicateThreshold > 64 {
+		nearDuplicateThreshold = 6
+	}
+	animatedThumbnails := getEnv("ANIMATED_THUMBNAILS", "true") == "true"
+	animatedFormat := strings.ToLower(getEnv("ANIMATED_FORMAT", "webp"))
+	gifMaxFrames, _ := strconv.Atoi(getEnv("GIF_MAX_FRAMES", "300"))
+	gifMaxDuration, _ := strconv.Atoi(getEnv("GIF_MAX_DURATION", "60"))
+	gifMaxPixels, _ := strconv.ParseInt(getEnv("GIF_MAX_PIXELS", "200000000"), 10, 64)
+	gifToWebP := getEnv("GIF_TO_WEBP", "false") == "true"
+	gifToWebPMinSize, _ := strconv.ParseInt(getEnv("GIF_TO_WEBP_MIN_SIZE", "1048576"), 10, 64)
+	gifToWebPQuality, _ := strconv.Atoi(getEnv("GIF_TO_WEBP_QUALITY", "80"))
+	negotiateFormats := parseStringList(getEnv("NEGOTIATE_FORMATS", "webp"))
+	negotiateQuality, _ := strconv.Atoi(getEnv("NEGOTIATE_QUALITY", "80"))
+	negotiatePregenerate := getEnv("NEGOTIATE_PREGENERATE", "false") == "true"
+	storageDriver := getEnv("STORAGE_DRIVER", "local")
+	storageRetries, _ := strconv.Atoi(getEnv("STORAGE_RETRIES", "3"))
+	webdavMaxConns, _ := strconv.Atoi(getEnv("WEBDAV_MAX_CONNS", "8"))
+	sftpPort, _ := strconv.Atoi(getEnv("SFTP_PORT", "22"))
+	sftpMaxConns, _ := strconv.Atoi(getEnv("SFTP_MAX_CONNS", "4"))
+	sftpInsecureIgnoreHostKey := getEnv("SFTP_INSECURE_IGNORE_HOST_KEY", "false") == "true"
 	defaultUser := getEnv("DEFAULT_USER", "admin")
 	defaultPass := getEnv("DEFAULT_PASS", "123456")
 
-	jwtSecret := getEnv("JWT_SECRET", "your-secret-key-change-this-in-production")
+	jwtSecret := getEnv("JWT_SECRET", defaultJWTSecret)
 	sessionSecret := getEnv("SESSION_SECRET", "your-session-secret-key-change-this-in-production")
 
+	signKey := urlSignKey(getEnv("URL_SIGN_KEY", ""), jwtSecret)
+	signUploads := getEnv("SIGN_UPLOADS", "false") == "true"
+	signTransforms := getEnv("SIGN_TRANSFORMS", "true") == "true"
+	if signKey == "" {
+		// 没有可用密钥时禁用签名：/img 只允许白名单尺寸，签发接口不可用
+		log.Println("错误: 未设置可用的 URL_SIGN_KEY 且 JWT_SECRET 为默认值，URL 签名已禁用，请设置 URL_SIGN_KEY")
+		if signUploads {
+			log.Fatal("SIGN_UPLOADS=true 需要设置 URL_SIGN_KEY")
+		}
+		signTransforms = false
+	}
+
 	// AI 配置读取
 	aiApiUrl := getEnv("AI_API_URL", "")
 	aiApiKey := getEnv("AI_API_KEY", "")
@@ -103,8 +324,31 @@ func NewConfig() {
 		DbPassword:    dbPassword,
 		DbName:        dbName,
 		UploadPath:    uploadPath,
+		StorageDriver: storageDriver,
 		MaxFileSize:   maxFileSize,
 		AllowedTypes:  allowedTypes,
+		MaxMegapixels: maxMegapixels,
+		MaxGIFFrames:  maxGIFFrames,
+
+		RemoteUploadTimeout:      time.Duration(remoteUploadTimeout) * time.Second,
+		RemoteUploadMaxURLs:      remoteUploadMaxURLs,
+		RemoteUploadAllowPrivate: remoteUploadAllowPrivate,
+
+		TusUploadPath: tusUploadPath,
+		TusExpiration: time.Duration(tusExpiration) * time.Hour,
+
+		ImportPath:         importPath,
+		ImportMaxEntries:   importMaxEntries,
+		ImportMaxTotalSize: importMaxTotalSize,
+
+		InboxPath:           inboxPath,
+		InboxWatch:          inboxWatch,
+		InboxAfter:          inboxAfter,
+		InboxArchivePath:    inboxArchivePath,
+		InboxQuarantinePath: inboxQuarantinePath,
+		InboxFolderCategory: inboxFolderCategory,
+		InboxSettle:         time.Duration(inboxSettle) * time.Second,
+
 		DefaultUser:   defaultUser,
 		DefaultPass:   defaultPass,
 		JWTSecret:     jwtSecret,
@@ -114,12 +358,127 @@ func NewConfig() {
 		AiModel:       aiModel,
 		AiPrompt:      aiPrompt,
 		AppUrl:        appUrl,
+		S3Config: S3Config{
+			Endpoint:  getEnv("S3_ENDPOINT", "s3.amazonaws.com"),
+			Region:    getEnv("S3_REGION", "us-east-1"),
+			Bucket:    getEnv("S3_BUCKET", ""),
+			Prefix:    getEnv("S3_PREFIX", ""),
+			AccessKey: getEnv("S3_ACCESS_KEY", ""),
+			SecretKey: getEnv("S3_SECRET_KEY", ""),
+			UseSSL:    getEnv("S3_USE_SSL", "true") == "true",
+			PathStyle: getEnv("S3_PATH_STYLE", "false") == "true",
+			PublicURL: strings.TrimSuffix(getEnv("S3_PUBLIC_URL", ""), "/"),
+		},
+		StorageRetries:        storageRetries,
+		SignKey:               signKey,
+		SignUploads:           signUploads,
+		SignTransforms:        signTransforms,
+		TransformCachePath:    transformCachePath,
+		TransformCacheMaxSize: transformCacheMaxSize,
+		TransformSizes:        transformSizes,
+		TransformQualities:    transformQualities,
+		ThumbnailFormat:       thumbnailFormat,
+		PreviewFormat:         previewFormat,
+		ThumbnailQuality:      thumbnailQuality,
+		PreviewQuality:        previewQuality,
+		TransformQuality:      transformQuality,
+		AVIFSpeed:             avifSpeed,
+		ThumbnailCrop:         thumbnailCrop,
+		TransformCrop:         transformCrop,
+		RenditionFormat:       renditionFormat,
+		RenditionQuality:      renditionQuality,
+		KeepSourceOriginal:    keepSourceOriginal,
+		StripExif:             stripExif,
+		AnimatedThumbnails:    animatedThumbnails,
+		AnimatedFormat:        animatedFormat,
+		GIFMaxFrames:          gifMaxFrames,
+		GIFMaxDuration:        gifMaxDuration,
+		GIFMaxPixels:          gifMaxPixels,
+		GIFToWebP:             gifToWebP,
+		GIFToWebPMinSize:      gifToWebPMinSize,
+		GIFToWebPQuality:      gifToWebPQuality,
+		NegotiateFormats:      negotiateFormats,
+		NegotiateQuality:      negotiateQuality,
+		NegotiatePregenerate:  negotiatePregenerate,
+		WebDAVConfig: WebDAVConfig{
+			URL:      getEnv("WEBDAV_URL", ""),
+			Username: getEnv("WEBDAV_USERNAME", ""),
+			Password: getEnv("WEBDAV_PASSWORD", ""),
+			MaxConns: webdavMaxConns,
+		},
+		SFTPConfig: SFTPConfig{
+			Host:       getEnv("SFTP_HOST", ""),
+			Port:       sftpPort,
+			Username:   getEnv("SFTP_USERNAME", ""),
+			Password:   getEnv("SFTP_PASSWORD", ""),
+			PrivateKey: getEnv("SFTP_PRIVATE_KEY", ""),
+			HostKey:    getEnv("SFTP_HOST_KEY", ""),
+			KnownHosts: getEnv("SFTP_KNOWN_HOSTS", ""),
+			RootPath:   getEnv("SFTP_ROOT_PATH", "/uploads"),
+			MaxConns:   sftpMaxConns,
+
+			InsecureIgnoreHostKey: sftpInsecureIgnoreHostKey,
+		},
 		GitHubConfig: GitHubConfig{
 			ClientID:     getEnv("GITHUB_CLIENT_ID", ""),
 			ClientSecret: getEnv("GITHUB_CLIENT_SECRET", ""),
 			RedirectURL:  getEnv("GITHUB_REDIRECT_URL", ""),
 		},
+		NearDuplicate:          nearDuplicate,
+		NearDuplicateThreshold: nearDuplicateThreshold,
+	}
+}
+
+// parseIntList 解析逗号分隔的整数列表，忽略无效项
+func parseIntList(value string) []int {
+	var result []int
+	for _, item := range strings.Split(value, ",") {
+		if n, err := strconv.Atoi(strings.TrimSpace(item)); err == nil {
+			result = append(result, n)
+		}
+	}
+	return result
+}
+
+// parseStringList 解析逗号分隔的小写字符串列表，"none" 表示空列表
+func parseStringList(value string) []string {
+	var result []string
+	for _, item := range strings.Split(value, ",") {
+		item = strings.ToLower(strings.TrimSpace(item))
+		if item != "" && item != "none" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// parseQualityMap 解析 "格式:质量" 列表，如 webp:80,avif:60
+func parseQualityMap(value string) map[string]int {
+	result := make(map[string]int)
+	for _, item := range strings.Split(value, ",") {
+		format, quality, ok := strings.Cut(strings.TrimSpace(item), ":")
+		if !ok {
+			continue
+		}
+		if n, err := strconv.Atoi(strings.TrimSpace(quality)); err == nil {
+			result[strings.ToLower(strings.TrimSpace(format))] = n
+		}
+	}
+	return result
+}
+
+// urlSignKey 签名密钥：优先使用 URL_SIGN_KEY，未设置时由 JWT 密钥派生（不直接复用）
+// 公开的默认值视为未设置，没有可用密钥时返回空
+func urlSignKey(key, jwtSecret string) string {
+	if key != "" && key != defaultJWTSecret {
+		return key
+	}
+	if jwtSecret == "" || jwtSecret == defaultJWTSecret {
+		return ""
 	}
+	mac := hmac.New(sha256.New, []byte(jwtSecret))
+	mac.Write([]byte("oneimg url signing"))
+	return hex.EncodeToString(mac.Sum(nil))
 }
 
 func getEnv(key, defaultValue string) string {
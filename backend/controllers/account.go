@@ -14,8 +14,8 @@ import (
 // ChangeAccountInfoRequest 修改登录信息请求结构
 type ChangeAccountInfoRequest struct {
 	CurrentPassword string `json:"current_password" binding:"required"`
-	NewPassword     string `json:"new_password" min=6"`
-	NewUsername     string `json:"new_username" min=3,max=20"`
+	NewPassword     string `json:"new_password"`
+	NewUsername     string `json:"new_username"`
 }
 
 // AccountResponse 账户响应结构
@@ -0,0 +1,331 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"oneimg/backend/config"
+	"oneimg/backend/database"
+	"oneimg/backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 导入任务状态
+const (
+	ImportQueued    = "queued"
+	ImportRunning   = "running"
+	ImportCompleted = "completed"
+	ImportFailed    = "failed"
+)
+
+// 保留的已结束任务数，超出时删除最早的任务
+const maxFinishedImportJobs = 20
+
+// ImportJob 批量导入任务，每张图片的结果按处理顺序记录
+type ImportJob struct {
+	mu sync.Mutex
+
+	ID         string        `json:"id"`
+	Source     string        `json:"source"`
+	Status     string        `json:"status"`
+	Total      int           `json:"total"`
+	Current    int           `json:"current"`
+	Succeeded  int           `json:"succeeded"`
+	Failed     int           `json:"failed"`
+	Error      string        `json:"error,omitempty"`
+	CreatedAt  time.Time     `json:"created_at"`
+	FinishedAt *time.Time    `json:"finished_at,omitempty"`
+	Results    []ImageResult `json:"results,omitempty"`
+}
+
+// NewImportJob 创建导入任务（不加入任务列表）
+func NewImportJob(source string) *ImportJob {
+	return &ImportJob{
+		ID:        generateRandomString(16),
+		Source:    source,
+		Status:    ImportQueued,
+		CreatedAt: time.Now(),
+		Results:   []ImageResult{},
+	}
+}
+
+func (j *ImportJob) start(total int) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.Status = ImportRunning
+	j.Total = total
+}
+
+func (j *ImportJob) add(result ImageResult) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.Current++
+	if result.Success {
+		j.Succeeded++
+	} else {
+		j.Failed++
+	}
+	j.Results = append(j.Results, result)
+}
+
+func (j *ImportJob) finish(err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	now := time.Now()
+	j.FinishedAt = &now
+	j.Status = ImportCompleted
+	if err != nil {
+		j.Status = ImportFailed
+		j.Error = err.Error()
+	}
+}
+
+// Snapshot 复制任务当前状态，withResults 为 false 时不包含逐项结果
+func (j *ImportJob) Snapshot(withResults bool) *ImportJob {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	snapshot := &ImportJob{
+		ID:         j.ID,
+		Source:     j.Source,
+		Status:     j.Status,
+		Total:      j.Total,
+		Current:    j.Current,
+		Succeeded:  j.Succeeded,
+		Failed:     j.Failed,
+		Error:      j.Error,
+		CreatedAt:  j.CreatedAt,
+		FinishedAt: j.FinishedAt,
+	}
+	if withResults {
+		snapshot.Results = append([]ImageResult{}, j.Results...)
+	}
+	return snapshot
+}
+
+var (
+	importJobs   = make(map[string]*ImportJob)
+	importJobsMu sync.Mutex
+	// 导入任务依次执行，避免多个任务同时占满图片处理资源
+	importRunMu sync.Mutex
+)
+
+// registerImportJob 加入任务列表，并清理多余的已结束任务
+func registerImportJob(job *ImportJob) {
+	importJobsMu.Lock()
+	defer importJobsMu.Unlock()
+	importJobs[job.ID] = job
+
+	var finished []*ImportJob
+	for _, j := range importJobs {
+		if s := j.Snapshot(false); s.FinishedAt != nil {
+			finished = append(finished, s)
+		}
+	}
+	if len(finished) <= maxFinishedImportJobs {
+		return
+	}
+	sort.Slice(finished, func(a, b int) bool { return finished[a].FinishedAt.Before(*finished[b].FinishedAt) })
+	for _, j := range finished[:len(finished)-maxFinishedImportJobs] {
+		delete(importJobs, j.ID)
+	}
+}
+
+// ArchiveImportOptions 压缩包导入参数
+type ArchiveImportOptions struct {
+	Upload         UploadOptions
+	FolderCategory bool // 以图片所在文件夹名作为分类
+}
+
+// archiveLimitsOf 由配置得到解压限制
+func archiveLimitsOf(cfg *config.Config) services.ArchiveLimits {
+	return services.ArchiveLimits{
+		MaxEntries:   cfg.ImportMaxEntries,
+		MaxEntrySize: cfg.MaxFileSize,
+		MaxTotalSize: cfg.ImportMaxTotalSize,
+	}
+}
+
+// folderCategoryOf 图片所在文件夹名，位于根目录时返回空
+func folderCategoryOf(name string) string {
+	dir := path.Dir(name)
+	if dir == "." {
+		return ""
+	}
+	category := []rune(strings.TrimSpace(path.Base(dir)))
+	return string(category[:min(len(category), 50)])
+}
+
+// ImportArchiveFile 同步导入压缩包中的所有图片，进度与结果记录在 job 中
+func ImportArchiveFile(job *ImportJob, archivePath string, cfg *config.Config, db *database.Database, opts ArchiveImportOptions) error {
+	importRunMu.Lock()
+	defer importRunMu.Unlock()
+
+	limits := archiveLimitsOf(cfg)
+	total, err := services.CountArchiveImages(archivePath, limits)
+	if err != nil {
+		job.finish(err)
+		return err
+	}
+	job.start(total)
+
+	err = services.WalkArchive(archivePath, limits, func(entry services.ArchiveEntry) error {
+		var result ImageResult
+		if entry.Err != nil {
+			result = rejectedResult(entry.Err)
+		} else {
+			entryOpts := opts.Upload
+			if opts.FolderCategory {
+				entryOpts.Category = folderCategoryOf(entry.Name)
+			}
+			result = processUploadBytes(path.Base(entry.Name), entry.Data, cfg, db, entryOpts)
+		}
+		result.Source = entry.Name
+		job.add(result)
+		return nil
+	})
+	job.finish(err)
+	return err
+}
+
+// archiveImportRequest 导入请求，上传压缩包（archive 字段）或指定服务器端路径
+type archiveImportRequest struct {
+	Path           string `form:"path" json:"path"`
+	FolderCategory bool   `form:"folder_category" json:"folder_category"`
+	StripExif      string `form:"strip_exif" json:"strip_exif"`
+	NearDuplicate  string `form:"near_duplicate" json:"near_duplicate"`
+}
+
+// ImportArchive 创建压缩包导入任务并在后台执行
+func ImportArchive(c *gin.Context) {
+	cfg := c.MustGet("config").(*config.Config)
+	if cfg.ImportMaxTotalSize > 0 {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, cfg.ImportMaxTotalSize+1<<20)
+	}
+
+	var req archiveImportRequest
+	if err := c.ShouldBind(&req); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"code": 413, "message": "压缩包过大"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "参数错误: " + err.Error()})
+		return
+	}
+	uploadOpts, err := parseUploadOptions(cfg, req.StripExif, req.NearDuplicate)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+		return
+	}
+
+	var archivePath, source string
+	temporary := false
+	if file, err := c.FormFile("archive"); err == nil {
+		// 请求结束后表单临时文件会被删除，先复制一份供后台任务使用
+		tmp, err := os.CreateTemp("", "oneimg-import-*")
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "保存压缩包失败"})
+			return
+		}
+		tmp.Close()
+		if err := c.SaveUploadedFile(file, tmp.Name()); err != nil {
+			os.Remove(tmp.Name())
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "保存压缩包失败"})
+			return
+		}
+		archivePath, source, temporary = tmp.Name(), file.Filename, true
+	} else if req.Path != "" {
+		resolved, err := resolveImportPath(cfg.ImportPath, req.Path)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+			return
+		}
+		archivePath, source = resolved, req.Path
+	} else {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "请上传压缩包或指定服务器路径"})
+		return
+	}
+
+	if format, err := services.ArchiveFormatOf(archivePath); err != nil || format == "" {
+		if temporary {
+			os.Remove(archivePath)
+		}
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"code": 415, "message": "不支持的压缩包格式，仅支持 zip、tar 与 tar.gz"})
+		return
+	}
+
+	job := NewImportJob(source)
+	registerImportJob(job)
+	db := database.GetDB()
+	go func() {
+		if temporary {
+			defer os.Remove(archivePath)
+		}
+		if err := ImportArchiveFile(job, archivePath, cfg, db, ArchiveImportOptions{Upload: uploadOpts, FolderCategory: req.FolderCategory}); err != nil {
+			fmt.Printf("压缩包导入失败 %s: %v\n", source, err)
+		}
+	}()
+
+	c.JSON(http.StatusAccepted, gin.H{"code": 202, "message": "导入任务已创建", "data": job.Snapshot(false)})
+}
+
+// resolveImportPath 解析服务器端路径，必须是导入目录内的普通文件（含符号链接解析后的位置）
+func resolveImportPath(root, name string) (string, error) {
+	rootReal, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return "", errors.New("服务器导入目录不存在")
+	}
+	rootReal, _ = filepath.Abs(rootReal)
+
+	target := name
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(rootReal, target)
+	}
+	targetReal, err := filepath.EvalSymlinks(target)
+	if err != nil {
+		return "", errors.New("文件不存在")
+	}
+	targetReal, _ = filepath.Abs(targetReal)
+	rel, err := filepath.Rel(rootReal, targetReal)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", errors.New("只能导入服务器导入目录内的文件")
+	}
+	info, err := os.Stat(targetReal)
+	if err != nil || !info.Mode().IsRegular() {
+		return "", errors.New("文件不存在")
+	}
+	return targetReal, nil
+}
+
+// GetImportJobs 导入任务列表（不含逐项结果），按创建时间倒序
+func GetImportJobs(c *gin.Context) {
+	importJobsMu.Lock()
+	jobs := make([]*ImportJob, 0, len(importJobs))
+	for _, job := range importJobs {
+		jobs = append(jobs, job.Snapshot(false))
+	}
+	importJobsMu.Unlock()
+	sort.Slice(jobs, func(a, b int) bool { return jobs[a].CreatedAt.After(jobs[b].CreatedAt) })
+	c.JSON(http.StatusOK, gin.H{"code": 200, "data": jobs})
+}
+
+// GetImportJob 导入任务进度与逐项结果
+func GetImportJob(c *gin.Context) {
+	importJobsMu.Lock()
+	job, ok := importJobs[c.Param("id")]
+	importJobsMu.Unlock()
+	if !ok {
+		c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "导入任务不存在"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 200, "data": job.Snapshot(true)})
+}
@@ -0,0 +1,146 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"oneimg/backend/database"
+	"oneimg/backend/models"
+	"oneimg/backend/services"
+	"oneimg/backend/storage"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// PHashProgress 图片特征（感知哈希、占位图）回填进度
+var PHashProgress = AIProgressStruct{}
+
+// ImagesMissingFeatures 查询缺少感知哈希、占位图或主色调 CIELAB 值的图片
+func ImagesMissingFeatures(db *gorm.DB) ([]models.Image, error) {
+	var images []models.Image
+	err := db.Where("phash = ? OR phash IS NULL OR blur_hash = ? OR blur_hash IS NULL OR (palette <> ? AND lab_l IS NULL)", "", "", "").
+		Order("id asc").Find(&images).Error
+	return images, err
+}
+
+// BackfillImageFeatures 为历史图片计算感知哈希、BlurHash 与主色调，返回更新的图片数量
+// progress 不为 nil 时更新进度
+func BackfillImageFeatures(db *gorm.DB, images []models.Image, progress *AIProgressStruct) int {
+	semaphore := make(chan struct{}, 3)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	updated := 0
+
+	for _, img := range images {
+		wg.Add(1)
+		semaphore <- struct{}{}
+
+		go func(image models.Image) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			defer func() {
+				if progress != nil {
+					mu.Lock()
+					progress.Current++
+					mu.Unlock()
+				}
+			}()
+
+			features, err := imageFeaturesOf(image)
+			if err != nil {
+				fmt.Printf("计算图片特征失败: %s, %v\n", image.Url, err)
+				return
+			}
+			updates := map[string]interface{}{
+				"phash":     features.PHash,
+				"blur_hash": features.Placeholder.BlurHash,
+				"palette":   strings.Join(features.Placeholder.Palette, ","),
+			}
+			if lab := features.Placeholder.Dominant; lab != nil {
+				updates["lab_l"], updates["lab_a"], updates["lab_b"] = lab.L, lab.A, lab.B
+			}
+			if err := db.Model(&models.Image{}).Where("id = ?", image.Id).Updates(updates).Error; err != nil {
+				fmt.Printf("保存图片特征失败: %d, %v\n", image.Id, err)
+				return
+			}
+			if hash, err := services.ParsePHash(features.PHash); err == nil {
+				services.Similar.Add(image.Id, hash)
+			}
+			mu.Lock()
+			updated++
+			mu.Unlock()
+		}(img)
+	}
+
+	wg.Wait()
+	return updated
+}
+
+// BackfillPerceptualHashes 为历史图片补算感知哈希与占位图（后台执行）
+func BackfillPerceptualHashes(c *gin.Context) {
+	if PHashProgress.IsRunning {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "任务已在运行中"})
+		return
+	}
+
+	db := database.GetDB().DB
+	images, err := ImagesMissingFeatures(db)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": "查询图片失败"})
+		return
+	}
+	if len(images) == 0 {
+		c.JSON(http.StatusOK, gin.H{"code": 200, "msg": "没有需要处理的图片"})
+		return
+	}
+
+	PHashProgress.Total = len(images)
+	PHashProgress.Current = 0
+	PHashProgress.IsRunning = true
+
+	go func() {
+		defer func() {
+			PHashProgress.IsRunning = false
+		}()
+		updated := BackfillImageFeatures(db, images, &PHashProgress)
+		fmt.Printf("图片特征回填完成，更新了 %d 张图片\n", updated)
+	}()
+
+	c.JSON(http.StatusOK, gin.H{"code": 200, "msg": "回填任务已在后台启动"})
+}
+
+// GetPHashProgress 获取回填进度
+func GetPHashProgress(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": PHashProgress,
+	})
+}
+
+// imageFeaturesOf 读取图片文件计算特征，原图无法解码时使用预览图
+func imageFeaturesOf(img models.Image) (services.ImageFeatures, error) {
+	fileKey := storage.KeyFromURL(img.Url)
+	// 原图带水印时使用无水印版本
+	keys := []string{cleanOriginalKeyOf(fileKey), fileKey, previewKeyOf(fileKey)}
+
+	imgService := services.NewImageService()
+	var lastErr error
+	for _, key := range keys {
+		data, err := readStorageObject(key)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		transformSemaphore <- struct{}{}
+		features, err := imgService.ImageFeaturesOf(data)
+		<-transformSemaphore
+		if err == nil {
+			return features, nil
+		}
+		lastErr = err
+	}
+	return services.ImageFeatures{}, lastErr
+}
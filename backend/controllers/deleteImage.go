@@ -2,11 +2,8 @@ package controllers
 
 import (
 	"net/http"
-	"os"
-	"path/filepath"
 	"strconv"
 
-	"oneimg/backend/config"
 	"oneimg/backend/database"
 	"oneimg/backend/models"
 
@@ -46,36 +43,12 @@ func DeleteImage(c *gin.Context) {
 		return
 	}
 
-	// 获取配置
-	cfg, exists := c.Get("config")
-	if !exists {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"code": 500,
-			"msg":  "获取配置失败",
-		})
-		return
-	}
-	config := cfg.(*config.Config)
-
-	// 从URL中提取文件路径
-	// URL格式: /uploads/2025/09/filename.ext
-	// 需要去掉前缀 "/uploads/" 得到相对路径
-	relativePath := image.Url
-	if len(relativePath) > 9 && relativePath[:9] == "/uploads/" {
-		relativePath = relativePath[9:] // 去掉 "/uploads/" 前缀
-	}
-
-	// 构建完整文件路径
-	filePath := filepath.Join(config.UploadPath, relativePath)
-
-	// 删除物理文件
-	if err := os.Remove(filePath); err != nil {
-		// 文件可能已经不存在，记录日志但不阻止删除数据库记录
-		// log.Printf("删除文件失败: %v", err)
-	}
+	// 删除物理文件（原图、缩略图、预览图）
+	// 文件可能已经不存在，记录日志但不阻止删除数据库记录
+	deleteImageFiles(image)
 
 	// 删除数据库记录
-	if err := db.Delete(&image).Error; err != nil {
+	if err := deleteImageRecord(db, image); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
 			"code": 500,
 			"msg":  "删除图片记录失败",
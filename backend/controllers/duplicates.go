@@ -0,0 +1,175 @@
+package controllers
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+
+	"oneimg/backend/config"
+	"oneimg/backend/database"
+	"oneimg/backend/models"
+	"oneimg/backend/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// NearDuplicate 与上传图片相似的已有图片
+type NearDuplicate struct {
+	ID       int    `json:"id"`
+	URL      string `json:"url"`
+	FileName string `json:"filename"`
+	Distance int    `json:"distance"`
+}
+
+// findNearDuplicates 查找与给定哈希的汉明距离不超过阈值的图片，按距离升序
+func findNearDuplicates(db *gorm.DB, phash string, threshold int) ([]NearDuplicate, error) {
+	hash, err := services.ParsePHash(phash)
+	if err != nil {
+		return nil, err
+	}
+	matches := services.Similar.Within(hash, threshold)
+	if len(matches) == 0 {
+		return nil, nil
+	}
+
+	images, err := loadImagesByMatches(db, matches)
+	if err != nil {
+		return nil, err
+	}
+	duplicates := make([]NearDuplicate, 0, len(images))
+	for _, match := range matches {
+		if img, ok := images[match.ImageID]; ok {
+			duplicates = append(duplicates, NearDuplicate{ID: img.Id, URL: img.Url, FileName: img.FileName, Distance: match.Distance})
+		}
+	}
+	return duplicates, nil
+}
+
+// loadImagesByMatches 按索引查询结果读取图片记录
+func loadImagesByMatches(db *gorm.DB, matches []services.SimilarMatch) (map[int]models.Image, error) {
+	ids := make([]int, len(matches))
+	for i, match := range matches {
+		ids[i] = match.ImageID
+	}
+	var images []models.Image
+	if err := db.Where("id IN ?", ids).Find(&images).Error; err != nil {
+		return nil, err
+	}
+	byID := make(map[int]models.Image, len(images))
+	for _, img := range images {
+		byID[img.Id] = img
+	}
+	return byID, nil
+}
+
+// clusterItem 相似图片分组中的一张图片
+type clusterItem struct {
+	ID        int    `json:"id"`
+	URL       string `json:"url"`
+	FileName  string `json:"filename"`
+	FileSize  int64  `json:"file_size"`
+	Width     int    `json:"width"`
+	Height    int    `json:"height"`
+	CreatedAt string `json:"created_at"`
+	Distance  int    `json:"distance"` // 与分组中第一张（最早上传）图片的距离
+}
+
+// GetNearDuplicateClusters 列出相似图片分组，供管理员人工确认后再删除
+// 参数: threshold 汉明距离阈值，默认使用 NEAR_DUPLICATE_THRESHOLD
+func GetNearDuplicateClusters(c *gin.Context) {
+	cfg := c.MustGet("config").(*config.Config)
+	threshold := cfg.NearDuplicateThreshold
+	if value := c.Query("threshold"); value != "" {
+		t, err := strconv.Atoi(value)
+		if err != nil || t < 0 || t > 64 {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "无效的 threshold 参数"})
+			return
+		}
+		threshold = t
+	}
+
+	db := database.GetDB().DB
+	var images []models.Image
+	if err := db.Where("phash <> ?", "").Order("id asc").Find(&images).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": "查询失败"})
+		return
+	}
+	position := make(map[int]int, len(images))
+	hashes := make([]uint64, len(images))
+	for i, img := range images {
+		position[img.Id] = i
+		hashes[i], _ = services.ParsePHash(img.PHash)
+	}
+
+	// 并查集：距离不超过阈值的图片归入同一分组，近邻由 BK 树索引查询
+	parent := make([]int, len(images))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	for i := range images {
+		for _, match := range services.Similar.Within(hashes[i], threshold) {
+			j, ok := position[match.ImageID]
+			if !ok {
+				continue
+			}
+			if ri, rj := find(i), find(j); ri != rj {
+				parent[max(ri, rj)] = min(ri, rj)
+			}
+		}
+	}
+
+	groups := make(map[int][]int)
+	for i := range images {
+		root := find(i)
+		groups[root] = append(groups[root], i)
+	}
+	clusters := make([][]clusterItem, 0)
+	for root, members := range groups {
+		if len(members) < 2 {
+			continue
+		}
+		cluster := make([]clusterItem, 0, len(members))
+		for _, i := range members {
+			img := images[i]
+			cluster = append(cluster, clusterItem{
+				ID:        img.Id,
+				URL:       img.Url,
+				FileName:  img.FileName,
+				FileSize:  img.FileSize,
+				Width:     img.Width,
+				Height:    img.Height,
+				CreatedAt: img.CreatedAt.Format("2006-01-02 15:04:05"),
+				Distance:  services.HammingDistance(hashes[root], hashes[i]),
+			})
+		}
+		clusters = append(clusters, cluster)
+	}
+	// 图片多的分组在前，数量相同时按最早图片排序
+	sort.Slice(clusters, func(i, j int) bool {
+		if len(clusters[i]) != len(clusters[j]) {
+			return len(clusters[i]) > len(clusters[j])
+		}
+		return clusters[i][0].ID < clusters[j][0].ID
+	})
+
+	// 尚未计算感知哈希的图片数量，提示管理员先执行回填
+	var unhashed int64
+	db.Model(&models.Image{}).Where("phash = ? OR phash IS NULL", "").Count(&unhashed)
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": gin.H{
+			"threshold": threshold,
+			"clusters":  clusters,
+			"unhashed":  unhashed,
+		},
+	})
+}
@@ -0,0 +1,247 @@
+package controllers
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"oneimg/backend/config"
+	"oneimg/backend/database"
+	"oneimg/backend/models"
+	"oneimg/backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 未指定 widths 时 srcset 使用的宽度，与变换尺寸白名单取交集
+var defaultEmbedWidths = []int{320, 640, 960, 1280, 1600, 1920}
+
+// EmbedCandidate srcset 中的一项
+type EmbedCandidate struct {
+	Width int    `json:"width"`
+	URL   string `json:"url"`
+}
+
+// EmbedSource <picture> 中的一个 <source>
+type EmbedSource struct {
+	Type   string           `json:"type"`
+	Srcset []EmbedCandidate `json:"srcset"`
+}
+
+// EmbedSnippets 可直接粘贴的嵌入代码
+type EmbedSnippets struct {
+	HTML     string `json:"html"`
+	Picture  string `json:"picture"`
+	Markdown string `json:"markdown"`
+	BBCode   string `json:"bbcode"`
+}
+
+// ImageEmbed 图片嵌入信息
+type ImageEmbed struct {
+	ID       int              `json:"id"`
+	Width    int              `json:"width"`
+	Height   int              `json:"height"`
+	Alt      string           `json:"alt"`
+	Sizes    string           `json:"sizes"`
+	Src      string           `json:"src"`
+	Srcset   []EmbedCandidate `json:"srcset"`
+	Sources  []EmbedSource    `json:"sources"`
+	Snippets EmbedSnippets    `json:"snippets"`
+}
+
+// GetImageEmbed 生成图片的响应式嵌入代码
+// 查询参数: widths=320,640 alt=说明 sizes=(max-width: 800px) 100vw format=html|picture|markdown|bbcode
+// 未指定 format 时返回 JSON，指定时直接返回对应的纯文本代码
+func GetImageEmbed(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "无效的图片ID"})
+		return
+	}
+
+	var image models.Image
+	if err := database.GetDB().DB.First(&image, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 404, "msg": "图片不存在"})
+		return
+	}
+
+	cfg := c.MustGet("config").(*config.Config)
+	widths, err := embedWidths(c.Query("widths"), cfg)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "参数错误: " + err.Error()})
+		return
+	}
+
+	alt := c.DefaultQuery("alt", image.FileName)
+	sizes := c.DefaultQuery("sizes", "100vw")
+	embed := buildImageEmbed(image, widths, cfg)
+	embed.Alt, embed.Sizes = alt, sizes
+	embed.Snippets = renderEmbedSnippets(embed)
+
+	switch format := c.Query("format"); format {
+	case "":
+		c.JSON(http.StatusOK, gin.H{"code": 200, "msg": "获取成功", "data": embed})
+	case "html":
+		c.String(http.StatusOK, embed.Snippets.HTML)
+	case "picture":
+		c.String(http.StatusOK, embed.Snippets.Picture)
+	case "markdown":
+		c.String(http.StatusOK, embed.Snippets.Markdown)
+	case "bbcode":
+		c.String(http.StatusOK, embed.Snippets.BBCode)
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "不支持的格式: " + format})
+	}
+}
+
+// embedWidths 解析 srcset 宽度，未要求签名时必须在变换尺寸白名单内
+func embedWidths(raw string, cfg *config.Config) ([]int, error) {
+	if raw == "" {
+		var widths []int
+		for _, w := range defaultEmbedWidths {
+			if cfg.SignTransforms || slices.Contains(cfg.TransformSizes, w) {
+				widths = append(widths, w)
+			}
+		}
+		return widths, nil
+	}
+
+	var widths []int
+	for _, part := range strings.Split(raw, ",") {
+		w, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || w < 1 {
+			return nil, fmt.Errorf("invalid width: %s", part)
+		}
+		if !cfg.SignTransforms && !slices.Contains(cfg.TransformSizes, w) {
+			return nil, fmt.Errorf("width %d is not allowed", w)
+		}
+		if !slices.Contains(widths, w) {
+			widths = append(widths, w)
+		}
+	}
+	slices.Sort(widths)
+	return widths, nil
+}
+
+// embedFallbackFormat 不支持 <source> 时 <img> 使用的格式，与原图保持一致
+// 返回空表示原图不适合转换（如 GIF 动图），只使用原图地址
+func embedFallbackFormat(fileURL string) string {
+	switch strings.ToLower(path.Ext(fileURL)) {
+	case ".gif", ".svg":
+		return ""
+	case ".png":
+		return "png"
+	case ".webp":
+		return "webp"
+	default:
+		return "jpeg"
+	}
+}
+
+// buildImageEmbed 由服务端可生成的按需变换地址组成 srcset 与 <picture> 的各个 source
+func buildImageEmbed(image models.Image, widths []int, cfg *config.Config) ImageEmbed {
+	base := strings.TrimSuffix(cfg.AppUrl, "/")
+	src := image.Url
+	if cfg.SignUploads && strings.HasPrefix(src, "/uploads/") {
+		src = services.SignURL(cfg.SignKey, src, url.Values{}, time.Time{})
+	}
+	if strings.HasPrefix(src, "/") {
+		src = base + src
+	}
+
+	embed := ImageEmbed{
+		ID:      image.Id,
+		Width:   image.Width,
+		Height:  image.Height,
+		Src:     src,
+		Srcset:  []EmbedCandidate{},
+		Sources: []EmbedSource{},
+	}
+	fallback := embedFallbackFormat(image.Url)
+	if fallback == "" {
+		return embed
+	}
+
+	// 只生成小于原图宽度的版本，原图本身作为最大的一项
+	variantURL := func(width int, format string) string {
+		query := url.Values{}
+		query.Set("w", strconv.Itoa(width))
+		query.Set("fmt", format)
+		imgPath := fmt.Sprintf("/img/%d", image.Id)
+		if cfg.SignTransforms {
+			return base + services.SignURL(cfg.SignKey, imgPath, query, time.Time{})
+		}
+		return base + imgPath + "?" + query.Encode()
+	}
+	for _, format := range []string{"avif", "webp"} {
+		if !services.FormatSupported(format) || format == fallback {
+			continue
+		}
+		source := EmbedSource{Type: services.MimeTypeOf(format)}
+		for _, w := range widths {
+			if w < image.Width {
+				source.Srcset = append(source.Srcset, EmbedCandidate{Width: w, URL: variantURL(w, format)})
+			}
+		}
+		// 原图宽度本身可以变换时补上全尺寸版本
+		if cfg.SignTransforms || slices.Contains(cfg.TransformSizes, image.Width) {
+			source.Srcset = append(source.Srcset, EmbedCandidate{Width: image.Width, URL: variantURL(image.Width, format)})
+		}
+		if len(source.Srcset) > 0 {
+			embed.Sources = append(embed.Sources, source)
+		}
+	}
+	for _, w := range widths {
+		if w < image.Width {
+			embed.Srcset = append(embed.Srcset, EmbedCandidate{Width: w, URL: variantURL(w, fallback)})
+		}
+	}
+	if image.Width > 0 {
+		embed.Srcset = append(embed.Srcset, EmbedCandidate{Width: image.Width, URL: src})
+	}
+	return embed
+}
+
+// formatSrcset 拼接 srcset 属性值
+func formatSrcset(candidates []EmbedCandidate) string {
+	parts := make([]string, len(candidates))
+	for i, candidate := range candidates {
+		parts[i] = fmt.Sprintf("%s %dw", candidate.URL, candidate.Width)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// renderEmbedSnippets 生成 HTML、<picture>、Markdown 与 BBCode 代码
+func renderEmbedSnippets(embed ImageEmbed) EmbedSnippets {
+	var img strings.Builder
+	fmt.Fprintf(&img, `<img src="%s"`, html.EscapeString(embed.Src))
+	if len(embed.Srcset) > 1 {
+		fmt.Fprintf(&img, ` srcset="%s" sizes="%s"`, html.EscapeString(formatSrcset(embed.Srcset)), html.EscapeString(embed.Sizes))
+	}
+	if embed.Width > 0 && embed.Height > 0 {
+		fmt.Fprintf(&img, ` width="%d" height="%d"`, embed.Width, embed.Height)
+	}
+	fmt.Fprintf(&img, ` alt="%s" loading="lazy" decoding="async">`, html.EscapeString(embed.Alt))
+
+	var picture strings.Builder
+	picture.WriteString("<picture>\n")
+	for _, source := range embed.Sources {
+		fmt.Fprintf(&picture, "  <source type=\"%s\" srcset=\"%s\" sizes=\"%s\">\n",
+			source.Type, html.EscapeString(formatSrcset(source.Srcset)), html.EscapeString(embed.Sizes))
+	}
+	picture.WriteString("  " + img.String() + "\n</picture>")
+
+	alt := strings.NewReplacer("[", `\[`, "]", `\]`).Replace(embed.Alt)
+	return EmbedSnippets{
+		HTML:     img.String(),
+		Picture:  picture.String(),
+		Markdown: fmt.Sprintf("![%s](%s)", alt, embed.Src),
+		BBCode:   fmt.Sprintf("[img]%s[/img]", embed.Src),
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"oneimg/backend/database"
 	"oneimg/backend/models"
 
+	"github.com/gin-contrib/sessions"
 	"github.com/gin-gonic/gin"
 )
 
@@ -35,7 +36,7 @@ func GetImageDetail(c *gin.Context) {
 	var image models.Image
 
 	// 查询图片详情
-	if err := db.First(&image, uint(id)).Error; err != nil {
+	if err := db.Preload("Metadata").First(&image, uint(id)).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{
 			"code": 404,
 			"msg":  "图片不存在",
@@ -43,6 +44,11 @@ func GetImageDetail(c *gin.Context) {
 		return
 	}
 
+	// 拍摄位置仅对已登录用户可见
+	if image.Metadata != nil && sessions.Default(c).Get("logged_in") != true {
+		image.Metadata.Latitude, image.Metadata.Longitude = nil, nil
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"code": 200,
 		"msg":  "获取图片详情成功",
@@ -6,10 +6,22 @@ import (
 
 	"oneimg/backend/database"
 	"oneimg/backend/models"
+	"oneimg/backend/services"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm/clause"
 )
 
+// 按颜色筛选的默认色差阈值，约 25 为同一色系
+const defaultColorTolerance = 25.0
+
+// colorDistanceSQL 主色调与目标颜色的色差平方 (CIE76)
+const colorDistanceSQL = "(lab_l - ?) * (lab_l - ?) + (lab_a - ?) * (lab_a - ?) + (lab_b - ?) * (lab_b - ?)"
+
+func colorDistanceVars(lab *services.Lab, extra ...interface{}) []interface{} {
+	return append([]interface{}{lab.L, lab.L, lab.A, lab.A, lab.B, lab.B}, extra...)
+}
+
 // GetImageList 获取图片列表
 func GetImageList(c *gin.Context) {
 	// 获取分页参数
@@ -34,6 +46,31 @@ func GetImageList(c *gin.Context) {
 	search := c.Query("search")
 	category := c.Query("category")
 
+	// 按主色调筛选: color 为十六进制或颜色名 (blue / 蓝)，color_tolerance 为 CIELAB 色差阈值
+	var colorLab *services.Lab
+	colorTolerance := defaultColorTolerance
+	if colorStr := c.Query("color"); colorStr != "" {
+		lab, err := services.ParseColorLab(colorStr)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"code": 400,
+				"msg":  "无效的颜色: " + colorStr,
+			})
+			return
+		}
+		colorLab = &lab
+		if toleranceStr := c.Query("color_tolerance"); toleranceStr != "" {
+			colorTolerance, err = strconv.ParseFloat(toleranceStr, 64)
+			if err != nil || colorTolerance <= 0 || colorTolerance > 100 {
+				c.JSON(http.StatusBadRequest, gin.H{
+					"code": 400,
+					"msg":  "color_tolerance 取值范围为 (0, 100]",
+				})
+				return
+			}
+		}
+	}
+
 	// 计算偏移量
 	offset := (page - 1) * limit
 
@@ -56,6 +93,12 @@ func GetImageList(c *gin.Context) {
 		query = query.Where("category = ?", category)
 	}
 
+	// 添加颜色筛选，先按 L 通道范围缩小（可走索引），再计算色差
+	if colorLab != nil {
+		query = query.Where("lab_l BETWEEN ? AND ?", colorLab.L-colorTolerance, colorLab.L+colorTolerance).
+			Where(colorDistanceSQL+" <= ?", colorDistanceVars(colorLab, colorTolerance*colorTolerance)...)
+	}
+
 	// 获取总数
 	if err := query.Count(&total).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{
@@ -104,6 +147,10 @@ func GetImageList(c *gin.Context) {
 		}
 
 		orderClause := dbField + " " + sortOrder
+		// 按颜色筛选且未指定排序时，颜色最接近的在前
+		if colorLab != nil && c.Query("sort_by") == "" {
+			query = query.Order(clause.Expr{SQL: colorDistanceSQL, Vars: colorDistanceVars(colorLab)})
+		}
 		if err := query.Order(orderClause).Offset(offset).Limit(limit).Find(&images).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"code": 500,
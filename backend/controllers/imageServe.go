@@ -1,33 +1,60 @@
 package controllers
 
 import (
+	"bufio"
+	"io"
 	"net/http"
-	"os"
-	"path/filepath"
+	"strconv"
 	"strings"
 
-	"oneimg/backend/config"
 	"oneimg/backend/middlewares"
+	"oneimg/backend/services"
+	"oneimg/backend/storage"
 
 	"github.com/gin-gonic/gin"
 )
 
+// ServeUpload 从存储后端读取并返回 /uploads 下的文件
+func ServeUpload(c *gin.Context) {
+	key, err := storage.CleanKey(c.Param("filepath"))
+	if err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"code": 403, "msg": "Forbidden"})
+		return
+	}
+	// 无水印原图与水印素材不对外提供
+	if isPrivateKey(key) {
+		c.JSON(http.StatusNotFound, gin.H{"code": 404, "msg": "文件不存在"})
+		return
+	}
+	if serveWatermarkedUpload(c, key) {
+		return
+	}
+	serveStorageObject(c, negotiateUpload(c, key))
+}
+
+// 不通过 /uploads 对外提供的存储目录
+const (
+	privateOriginalsPrefix = ".originals/"
+	privateWatermarkPrefix = ".watermark/"
+)
+
+func isPrivateKey(key string) bool {
+	return strings.HasPrefix(key, privateOriginalsPrefix) || strings.HasPrefix(key, privateWatermarkPrefix)
+}
+
 // ServeImage 动态图片服务 (控制访问权限)
 func ServeImage(c *gin.Context) {
-	// 获取请求的文件路径
-	filePath := c.Param("filepath")
-	
-	// 防止目录遍历攻击
-	if strings.Contains(filePath, "..") {
+	// 获取请求的文件路径，防止目录遍历攻击
+	key, err := storage.CleanKey(c.Param("filepath"))
+	if err != nil {
 		c.JSON(http.StatusForbidden, gin.H{"code": 403, "msg": "Forbidden"})
 		return
 	}
 
-	cfg := config.App
-	fullPath := filepath.Join(cfg.UploadPath, filePath)
+	store := storage.GetStorage()
 
 	// 检查文件是否存在
-	if _, err := os.Stat(fullPath); os.IsNotExist(err) {
+	if _, err := store.Stat(key); err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"code": 404, "msg": "Image not found"})
 		return
 	}
@@ -37,19 +64,15 @@ func ServeImage(c *gin.Context) {
 
 	// 如果已登录，直接返回原图
 	if loggedIn {
-		c.File(fullPath)
+		serveStorageObject(c, key)
 		return
 	}
 
 	// 如果未登录，尝试返回缩略图
-	// 假设缩略图命名规则：原文件名_thumb.ext
-	ext := filepath.Ext(fullPath)
-	nameWithoutExt := strings.TrimSuffix(fullPath, ext)
-	thumbPath := nameWithoutExt + "_thumb" + ext
-
-	// 检查缩略图是否存在
-	if _, err := os.Stat(thumbPath); err == nil {
-		c.File(thumbPath)
+	// 缩略图命名规则：原文件名_thumb.ext
+	thumbKey := thumbKeyOf(key)
+	if _, err := store.Stat(thumbKey); err == nil {
+		serveStorageObject(c, thumbKey)
 		return
 	}
 
@@ -61,5 +84,79 @@ func ServeImage(c *gin.Context) {
 	// 这里选择：如果缩略图不存在，返回原图 (Fallback)，或者返回占位图。
 	// 考虑到已有逻辑是上传时生成缩略图，如果丢失说明异常。
 	// 暂时返回原图，避免裂图。
-	c.File(fullPath)
+	serveStorageObject(c, key)
+}
+
+// serveStorageObject 将存储对象写入响应
+// 后端返回可 Seek 的数据时交给 http.ServeContent 处理 Range/缓存头，否则直接流式输出
+func serveStorageObject(c *gin.Context, key string) {
+	reader, info, err := storage.GetStorage().Get(key)
+	if err != nil {
+		if err == storage.ErrNotExist {
+			c.Status(http.StatusNotFound)
+			return
+		}
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	defer reader.Close()
+
+	// 根据文件头确定 Content-Type，缩略图等衍生文件的扩展名与实际编码可能不一致
+	head := make([]byte, 512)
+	if seeker, ok := reader.(io.ReadSeeker); ok {
+		n, _ := io.ReadFull(seeker, head)
+		if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+		setImageContentType(c, sniffImageType(head[:n], info.ContentType))
+		http.ServeContent(c.Writer, c.Request, info.Key, info.ModTime, seeker)
+		return
+	}
+
+	buffered := bufio.NewReaderSize(reader, len(head))
+	head, _ = buffered.Peek(len(head))
+	setImageContentType(c, sniffImageType(head, info.ContentType))
+
+	if !info.ModTime.IsZero() {
+		c.Header("Last-Modified", info.ModTime.UTC().Format(http.TimeFormat))
+	}
+	if info.Size > 0 {
+		c.Header("Content-Length", strconv.FormatInt(info.Size, 10))
+	}
+	c.Status(http.StatusOK)
+	if c.Request.Method == http.MethodHead {
+		return
+	}
+	io.Copy(c.Writer, buffered)
+}
+
+// svgContentSecurityPolicy SVG 文件的 CSP，直接打开时也不能执行脚本或加载外部资源
+const svgContentSecurityPolicy = "default-src 'none'; style-src 'unsafe-inline'; img-src data:; sandbox"
+
+// setImageContentType 设置 Content-Type，SVG 额外附加限制性的安全头
+func setImageContentType(c *gin.Context, contentType string) {
+	c.Header("Content-Type", contentType)
+	if contentType == "image/svg+xml" {
+		c.Header("Content-Security-Policy", svgContentSecurityPolicy)
+		c.Header("X-Content-Type-Options", "nosniff")
+	}
+}
+
+// sniffImageType 识别图片类型，无法识别为图片时使用存储后端提供的类型
+func sniffImageType(head []byte, fallback string) string {
+	// SVG 为文本格式，http.DetectContentType 识别为 text/xml
+	if services.SniffImageType(head) == "image/svg+xml" {
+		return "image/svg+xml"
+	}
+	// http.DetectContentType 不识别 AVIF，按 ftyp 品牌单独判断
+	if len(head) >= 12 && string(head[4:8]) == "ftyp" {
+		if brand := string(head[8:12]); brand == "avif" || brand == "avis" {
+			return "image/avif"
+		}
+	}
+	if contentType := http.DetectContentType(head); strings.HasPrefix(contentType, "image/") {
+		return contentType
+	}
+	return fallback
 }
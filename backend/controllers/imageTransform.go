@@ -0,0 +1,109 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"oneimg/backend/config"
+	"oneimg/backend/database"
+	"oneimg/backend/models"
+	"oneimg/backend/services"
+	"oneimg/backend/storage"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// transformSemaphore 限制同时进行的图片变换数量，避免缓存未命中的请求占满 CPU
+var transformSemaphore = make(chan struct{}, runtime.NumCPU())
+
+// TransformImage 按需生成衍生图
+// 查询参数形式: /img/:id?w=640&h=480&fit=cover&fmt=webp&q=75
+// 路径段形式:   /img/:id/w_640,h_480,fit_cover,fmt_webp,q_75
+func TransformImage(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "无效的图片ID"})
+		return
+	}
+
+	var opts services.TransformOptions
+	if segment := c.Param("opts"); segment != "" && segment != "/" {
+		opts, err = services.ParseTransformPath(segment)
+	} else {
+		opts, err = services.ParseTransformQuery(c.Query)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "参数错误: " + err.Error()})
+		return
+	}
+
+	// 管理员签发的URL可以使用白名单之外的参数
+	if !c.GetBool("signed_url") {
+		cfg := c.MustGet("config").(*config.Config)
+		limits := services.TransformLimits{Sizes: cfg.TransformSizes, Qualities: cfg.TransformQualities}
+		if err := opts.Validate(limits); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "参数不在允许范围内: " + err.Error()})
+			return
+		}
+	}
+
+	// 访客或全局水印配置下为衍生图添加水印
+	wm := services.CurrentWatermark()
+	if wm.ForVariants(isAnonymous(c)) {
+		opts.Watermark = wm
+	}
+
+	data, err := renderVariant(id, opts)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) || errors.Is(err, storage.ErrNotExist) {
+			c.JSON(http.StatusNotFound, gin.H{"code": 404, "msg": "图片不存在"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": "图片处理失败: " + err.Error()})
+		return
+	}
+
+	if wm != nil && wm.Config.AnonymousOnly && wm.Config.ApplyPreview {
+		// 同一地址对访客与登录用户返回不同内容，不能由共享缓存保存
+		c.Header("Vary", strings.TrimPrefix(c.Writer.Header().Get("Vary")+", Cookie", ", "))
+		c.Header("Cache-Control", "private, max-age=3600")
+	} else {
+		c.Header("Cache-Control", "public, max-age=31536000, immutable")
+	}
+	c.Data(http.StatusOK, opts.MimeType(), data)
+}
+
+// renderVariant 读取缓存或生成衍生图
+func renderVariant(id int, opts services.TransformOptions) ([]byte, error) {
+	cacheName := opts.CacheKey()
+	if data, ok := services.Variants.Get(id, cacheName); ok {
+		return data, nil
+	}
+
+	var image models.Image
+	if err := database.GetDB().DB.First(&image, id).Error; err != nil {
+		return nil, err
+	}
+	original, err := readStorageObject(storage.KeyFromURL(image.Url))
+	if err != nil {
+		return nil, err
+	}
+
+	transformSemaphore <- struct{}{}
+	data, err := services.NewImageService().Transform(original, opts)
+	<-transformSemaphore
+	if err != nil {
+		return nil, err
+	}
+
+	if err := services.Variants.Put(id, cacheName, data); err != nil {
+		// 缓存写入失败不影响本次响应
+		fmt.Printf("写入衍生图缓存失败: %v\n", err)
+	}
+	return data, nil
+}
@@ -0,0 +1,188 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"oneimg/backend/config"
+	"oneimg/backend/database"
+	"oneimg/backend/services"
+)
+
+// 收件目录处理成功后的文件去向
+const (
+	InboxAfterArchive = "archive"
+	InboxAfterDelete  = "delete"
+)
+
+// inboxExcludes 不在收件目录中处理的目录
+func inboxExcludes(cfg *config.Config) []string {
+	return []string{cfg.InboxArchivePath, cfg.InboxQuarantinePath}
+}
+
+// IngestInboxFile 按上传流程处理收件目录中的一个文件
+// 成功后移入归档目录或删除，失败时移入隔离目录并写入同名的 .error.json 说明原因
+// 压缩包按压缩包导入处理，逐项结果可在导入任务中查看；有图片导入失败时整个压缩包移入隔离目录，
+// .error.json 中列出失败的图片，已导入的图片重新放入时按重复文件处理
+func IngestInboxFile(root, filePath string, cfg *config.Config, db *database.Database) ImageResult {
+	rel, err := filepath.Rel(root, filePath)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		rel = filepath.Base(filePath)
+	}
+	result, failures := ingestInboxFile(rel, filePath, cfg, db)
+	result.Source = filepath.ToSlash(rel)
+
+	if result.Success {
+		if cfg.InboxAfter == InboxAfterDelete {
+			err = os.Remove(filePath)
+		} else {
+			_, err = moveInboxFile(filePath, filepath.Join(cfg.InboxArchivePath, time.Now().Format("20060102"), rel))
+		}
+		if err != nil {
+			log.Printf("收件目录文件清理失败 %s: %v", filePath, err)
+		}
+		return result
+	}
+
+	log.Printf("收件目录文件处理失败 %s: %s", rel, result.Message)
+	target, err := moveInboxFile(filePath, filepath.Join(cfg.InboxQuarantinePath, rel))
+	if err != nil {
+		log.Printf("移入隔离目录失败 %s: %v", filePath, err)
+		return result
+	}
+	report, _ := json.MarshalIndent(struct {
+		ImageResult
+		FailedAt string        `json:"failed_at"`
+		Failures []ImageResult `json:"failures,omitempty"` // 压缩包中导入失败的图片
+	}{result, time.Now().Format("2006-01-02 15:04:05"), failures}, "", "  ")
+	if err := os.WriteFile(target+".error.json", report, 0644); err != nil {
+		log.Printf("写入失败原因失败 %s: %v", target, err)
+	}
+	return result
+}
+
+// ingestInboxFile 处理单个文件，压缩包中有图片导入失败时同时返回这些图片的结果
+func ingestInboxFile(rel, filePath string, cfg *config.Config, db *database.Database) (ImageResult, []ImageResult) {
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return ImageResult{Success: false, Message: "读取文件失败"}, nil
+	}
+
+	opts := UploadOptions{StripExif: cfg.StripExif, NearDuplicate: cfg.NearDuplicate}
+	if format, _ := services.ArchiveFormatOf(filePath); format != "" {
+		job := NewImportJob("inbox: " + filepath.ToSlash(rel))
+		registerImportJob(job)
+		if err := ImportArchiveFile(job, filePath, cfg, db, ArchiveImportOptions{Upload: opts, FolderCategory: cfg.InboxFolderCategory}); err != nil {
+			return ImageResult{Success: false, Message: "压缩包导入失败: " + err.Error()}, nil
+		}
+		snapshot := job.Snapshot(true)
+		if snapshot.Failed == 0 {
+			return ImageResult{Success: true, Message: fmt.Sprintf("压缩包导入完成，成功 %d 张 (任务 %s)", snapshot.Succeeded, snapshot.ID)}, nil
+		}
+		var failures []ImageResult
+		for _, r := range snapshot.Results {
+			if !r.Success {
+				failures = append(failures, r)
+			}
+		}
+		return ImageResult{Success: false, Message: fmt.Sprintf("压缩包中 %d 张图片导入失败，成功 %d 张 (任务 %s)", snapshot.Failed, snapshot.Succeeded, snapshot.ID)}, failures
+	}
+
+	// 先按文件大小拒绝，避免读入超大文件
+	if cfg.MaxFileSize > 0 && info.Size() > cfg.MaxFileSize {
+		return ImageResult{Success: false, Message: fmt.Sprintf("文件大小超出限制 (最大 %d 字节)", cfg.MaxFileSize), Reason: services.RejectFileTooLarge}, nil
+	}
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return ImageResult{Success: false, Message: "读取文件失败"}, nil
+	}
+	if cfg.InboxFolderCategory {
+		opts.Category = folderCategoryOf(filepath.ToSlash(rel))
+	}
+	return processUploadBytes(filepath.Base(filePath), data, cfg, db, opts), nil
+}
+
+// ImportInbox 处理目录中已有的所有文件，返回成功与失败数量
+func ImportInbox(dir string, cfg *config.Config, db *database.Database) (int, int, error) {
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return 0, 0, err
+	}
+	files, err := services.ScanInbox(root, inboxExcludes(cfg))
+	if err != nil {
+		return 0, 0, err
+	}
+	succeeded, failed := 0, 0
+	for _, file := range files {
+		if result := IngestInboxFile(root, file, cfg, db); result.Success {
+			succeeded++
+		} else {
+			failed++
+		}
+	}
+	return succeeded, failed, nil
+}
+
+// StartInboxWatcher 后台监听收件目录，新文件写入完成后自动导入
+func StartInboxWatcher(cfg *config.Config, db *database.Database) (*services.InboxWatcher, error) {
+	root, err := filepath.Abs(cfg.InboxPath)
+	if err != nil {
+		return nil, err
+	}
+	watcher, err := services.NewInboxWatcher(root, inboxExcludes(cfg), cfg.InboxSettle, func(path string) {
+		result := IngestInboxFile(root, path, cfg, db)
+		if result.Success {
+			log.Printf("收件目录导入完成: %s", result.Source)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return watcher, watcher.Start()
+}
+
+// moveInboxFile 移动文件，目标已存在时追加序号；跨设备时复制后删除源文件
+func moveInboxFile(src, dst string) (string, error) {
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return "", err
+	}
+	ext := filepath.Ext(dst)
+	base := strings.TrimSuffix(dst, ext)
+	for i := 1; ; i++ {
+		if _, err := os.Lstat(dst); os.IsNotExist(err) {
+			break
+		}
+		dst = base + "-" + strconv.Itoa(i) + ext
+	}
+
+	if err := os.Rename(src, dst); err == nil {
+		return dst, nil
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return "", err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(dst)
+		return "", err
+	}
+	in.Close()
+	return dst, os.Remove(src)
+}
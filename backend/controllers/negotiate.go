@@ -0,0 +1,222 @@
+package controllers
+
+import (
+	"bytes"
+	"container/list"
+	"fmt"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"oneimg/backend/config"
+	"oneimg/backend/services"
+	"oneimg/backend/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 现代格式按压缩率从高到低排列，协商时优先选择靠前的格式
+var modernFormats = []string{"avif", "webp"}
+
+// 可参与协商的原图扩展名，GIF 保留动画、SVG 为矢量图，不做转换
+var negotiableExts = []string{".jpg", ".jpeg", ".png", ".webp"}
+
+const (
+	// 跳过记录的容量，超出时淘汰最久未使用的记录
+	maxSiblingSkips = 10000
+	// 生成失败的兄弟文件在该时长后重试
+	siblingRetryAfter = 10 * time.Minute
+)
+
+var (
+	// siblingInFlight 正在生成中的兄弟文件，避免并发请求重复生成
+	siblingInFlight sync.Map
+	// siblingSkips 暂不生成的兄弟文件：转换后不比原图小的不再尝试，生成失败的稍后重试
+	siblingSkips = &siblingSkipList{max: maxSiblingSkips, lru: list.New(), entries: make(map[string]*list.Element)}
+)
+
+// siblingSkip 一条跳过记录，until 为零表示不再重试
+type siblingSkip struct {
+	key   string
+	until time.Time
+}
+
+// siblingSkipList 容量有限的跳过记录，按 LRU 淘汰
+type siblingSkipList struct {
+	mu      sync.Mutex
+	max     int
+	lru     *list.List
+	entries map[string]*list.Element
+}
+
+// skipped 兄弟文件是否仍在跳过期内
+func (l *siblingSkipList) skipped(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	elem, ok := l.entries[key]
+	if !ok {
+		return false
+	}
+	if until := elem.Value.(*siblingSkip).until; !until.IsZero() && time.Now().After(until) {
+		l.lru.Remove(elem)
+		delete(l.entries, key)
+		return false
+	}
+	l.lru.MoveToFront(elem)
+	return true
+}
+
+// add 记录跳过的兄弟文件，retryAfter 为 0 时不再重试
+func (l *siblingSkipList) add(key string, retryAfter time.Duration) {
+	var until time.Time
+	if retryAfter > 0 {
+		until = time.Now().Add(retryAfter)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if elem, ok := l.entries[key]; ok {
+		elem.Value.(*siblingSkip).until = until
+		l.lru.MoveToFront(elem)
+		return
+	}
+	l.entries[key] = l.lru.PushFront(&siblingSkip{key: key, until: until})
+	for l.lru.Len() > l.max {
+		oldest := l.lru.Back()
+		l.lru.Remove(oldest)
+		delete(l.entries, oldest.Value.(*siblingSkip).key)
+	}
+}
+
+// modernSiblingKey 原图对应的现代格式兄弟文件 key，例如 20250101/abc.jpg.webp
+func modernSiblingKey(fileKey, format string) string {
+	return fileKey + "." + format
+}
+
+// isNegotiable 判断文件是否为可协商的原图（缩略图、预览图等衍生图已按预设格式生成）
+func isNegotiable(fileKey string) bool {
+	ext := strings.ToLower(path.Ext(fileKey))
+	if derivedSuffixOf(fileKey) != "" {
+		return false
+	}
+	return slices.Contains(negotiableExts, ext)
+}
+
+// acceptsMimeType 解析 Accept 请求头，判断是否接受指定类型（q=0 视为不接受）
+func acceptsMimeType(accept, mimeType string) bool {
+	for _, part := range strings.Split(accept, ",") {
+		fields := strings.Split(part, ";")
+		if strings.TrimSpace(fields[0]) != mimeType {
+			continue
+		}
+		for _, param := range fields[1:] {
+			name, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+			if name == "q" {
+				if q, err := strconv.ParseFloat(value, 64); err == nil && q <= 0 {
+					return false
+				}
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// negotiateUpload 根据 Accept 请求头选择实际返回的文件
+// 浏览器支持的现代格式兄弟文件存在且更小时返回兄弟文件，不存在时按需生成，否则返回原图
+func negotiateUpload(c *gin.Context, fileKey string) string {
+	cfg := c.MustGet("config").(*config.Config)
+	if len(cfg.NegotiateFormats) == 0 || !isNegotiable(fileKey) {
+		return fileKey
+	}
+	c.Header("Vary", "Accept")
+
+	accept := c.GetHeader("Accept")
+	originalExt := strings.TrimPrefix(strings.ToLower(path.Ext(fileKey)), ".")
+	for _, format := range modernFormats {
+		if format == originalExt || !slices.Contains(cfg.NegotiateFormats, format) || !services.FormatSupported(format) {
+			continue
+		}
+		if !acceptsMimeType(accept, services.MimeTypeOf(format)) {
+			continue
+		}
+		if key, ok := lookupModernSibling(fileKey, format, cfg); ok {
+			return key
+		}
+	}
+	return fileKey
+}
+
+// lookupModernSibling 查找可用的兄弟文件，首次访问时同步生成
+func lookupModernSibling(fileKey, format string, cfg *config.Config) (string, bool) {
+	siblingKey := modernSiblingKey(fileKey, format)
+	if siblingSkips.skipped(siblingKey) {
+		return "", false
+	}
+
+	store := storage.GetStorage()
+	if _, err := store.Stat(siblingKey); err == nil {
+		return siblingKey, true
+	} else if err != storage.ErrNotExist {
+		return "", false
+	}
+
+	// 其他请求正在生成时本次先返回原图
+	if _, loaded := siblingInFlight.LoadOrStore(siblingKey, struct{}{}); loaded {
+		return "", false
+	}
+	defer siblingInFlight.Delete(siblingKey)
+
+	original, err := readStorageObject(fileKey)
+	if err != nil {
+		return "", false
+	}
+	ok, err := generateModernSibling(fileKey, original, format, cfg)
+	if err != nil {
+		// 转换或保存失败可能是暂时的，稍后重试
+		fmt.Printf("生成 %s 兄弟文件失败: %s, %v\n", format, fileKey, err)
+		siblingSkips.add(siblingKey, siblingRetryAfter)
+		return "", false
+	}
+	if !ok {
+		// 转换后不比原图小，不再尝试
+		siblingSkips.add(siblingKey, 0)
+		return "", false
+	}
+	return siblingKey, true
+}
+
+// generateModernSibling 将原图转换为现代格式并保存，转换结果不比原图小时不保存并返回 false
+func generateModernSibling(fileKey string, original []byte, format string, cfg *config.Config) (bool, error) {
+	transformSemaphore <- struct{}{}
+	data, err := services.NewImageService().ConvertFormat(original, format, cfg.NegotiateQuality)
+	<-transformSemaphore
+	if err != nil {
+		return false, err
+	}
+	if len(data) >= len(original) {
+		return false, nil
+	}
+	if err := storage.GetStorage().Put(modernSiblingKey(fileKey, format), bytes.NewReader(data), services.MimeTypeOf(format)); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// pregenerateModernSiblings 上传时预先生成所有启用的现代格式兄弟文件
+func pregenerateModernSiblings(fileKey string, original []byte, cfg *config.Config) {
+	if !cfg.NegotiatePregenerate || !isNegotiable(fileKey) {
+		return
+	}
+	originalExt := strings.TrimPrefix(strings.ToLower(path.Ext(fileKey)), ".")
+	for _, format := range cfg.NegotiateFormats {
+		if format == originalExt || !services.FormatSupported(format) {
+			continue
+		}
+		if _, err := generateModernSibling(fileKey, original, format, cfg); err != nil {
+			fmt.Printf("预生成 %s 兄弟文件失败: %s, %v\n", format, fileKey, err)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package controllers
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"oneimg/backend/database"
+	"oneimg/backend/models"
+	"oneimg/backend/services"
+	"oneimg/backend/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PresetProgress 预设衍生图重建进度
+var PresetProgress = AIProgressStruct{}
+
+// presetSettingsRequest 预设配置请求体
+type presetSettingsRequest struct {
+	Presets []models.ImagePreset `json:"presets"`
+}
+
+// GetPresetSettings 获取当前生效的预设（含内置的 thumb 与 preview）
+func GetPresetSettings(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": gin.H{"presets": services.CurrentPresets()},
+	})
+}
+
+// SavePresetSettings 保存预设并在后台为已有图片重建新增或修改的预设，删除已移除预设的文件
+func SavePresetSettings(c *gin.Context) {
+	var req presetSettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "参数错误"})
+		return
+	}
+	presets, err := services.NormalizePresets(req.Presets)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "参数错误: " + err.Error()})
+		return
+	}
+	if PresetProgress.IsRunning {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "预设重建任务运行中，请稍后再试"})
+		return
+	}
+
+	changed, stale := diffPresets(services.CurrentPresets(), presets)
+	if err := saveSettingJSON("image_presets", presets); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": "保存设置失败"})
+		return
+	}
+	if err := services.SetPresets(presets); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": "应用设置失败"})
+		return
+	}
+
+	if len(changed) == 0 && len(stale) == 0 {
+		c.JSON(http.StatusOK, gin.H{"code": 200, "msg": "保存成功"})
+		return
+	}
+	if err := startPresetJob(changed, stale); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": "保存成功，但启动重建任务失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 200, "msg": "保存成功，衍生图重建任务已在后台启动"})
+}
+
+// RegeneratePresets 为所有图片重建指定预设（未指定时重建全部预设）
+func RegeneratePresets(c *gin.Context) {
+	var req struct {
+		Presets []string `json:"presets"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "参数错误"})
+			return
+		}
+	}
+	presets, err := SelectPresets(req.Presets)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": err.Error()})
+		return
+	}
+	if PresetProgress.IsRunning {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "任务已在运行中"})
+		return
+	}
+	if err := startPresetJob(presets, nil); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": "查询图片失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 200, "msg": "重建任务已在后台启动"})
+}
+
+// GetPresetProgress 获取预设重建进度
+func GetPresetProgress(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": PresetProgress,
+	})
+}
+
+// SelectPresets 按名称选取当前预设，names 为空时返回全部
+func SelectPresets(names []string) ([]models.ImagePreset, error) {
+	if len(names) == 0 {
+		return services.CurrentPresets(), nil
+	}
+	presets := make([]models.ImagePreset, 0, len(names))
+	for _, name := range names {
+		preset, ok := services.FindPreset(name)
+		if !ok {
+			return nil, fmt.Errorf("预设不存在: %s", name)
+		}
+		presets = append(presets, preset)
+	}
+	return presets, nil
+}
+
+// diffPresets 比较新旧预设，返回需要重建的预设与需要删除文件的旧预设
+// 修改了格式的自定义预设文件扩展名会变化，旧文件同样需要删除
+func diffPresets(old, current []models.ImagePreset) (changed, stale []models.ImagePreset) {
+	previous := make(map[string]models.ImagePreset, len(old))
+	for _, preset := range old {
+		previous[preset.Name] = preset
+	}
+	for _, preset := range current {
+		before, ok := previous[preset.Name]
+		delete(previous, preset.Name)
+		if ok && before == preset {
+			continue
+		}
+		changed = append(changed, preset)
+		if ok && presetKeyOf("", before) != presetKeyOf("", preset) {
+			stale = append(stale, before)
+		}
+	}
+	for _, preset := range previous {
+		stale = append(stale, preset)
+	}
+	return changed, stale
+}
+
+// startPresetJob 后台为所有图片重建预设并删除旧预设文件
+func startPresetJob(presets, stale []models.ImagePreset) error {
+	db := database.GetDB().DB
+	var images []models.Image
+	if err := db.Order("id asc").Find(&images).Error; err != nil {
+		return err
+	}
+
+	PresetProgress.Total = len(images)
+	PresetProgress.Current = 0
+	PresetProgress.IsRunning = true
+
+	go func() {
+		defer func() {
+			PresetProgress.IsRunning = false
+		}()
+		updated := RegeneratePresetFiles(images, presets, stale, &PresetProgress)
+		fmt.Printf("预设重建完成，处理了 %d 张图片\n", updated)
+	}()
+	return nil
+}
+
+// RegeneratePresetFiles 由原图重新生成预设衍生图并删除 stale 预设的文件，返回成功处理的图片数量
+// progress 不为 nil 时更新进度
+func RegeneratePresetFiles(images []models.Image, presets, stale []models.ImagePreset, progress *AIProgressStruct) int {
+	semaphore := make(chan struct{}, 3)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	updated := 0
+
+	for _, img := range images {
+		wg.Add(1)
+		semaphore <- struct{}{}
+
+		go func(image models.Image) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			defer func() {
+				if progress != nil {
+					mu.Lock()
+					progress.Current++
+					mu.Unlock()
+				}
+			}()
+
+			if err := regenerateImagePresets(image, presets, stale); err != nil {
+				fmt.Printf("重建预设失败: %s, %v\n", image.Url, err)
+				return
+			}
+			mu.Lock()
+			updated++
+			mu.Unlock()
+		}(img)
+	}
+
+	wg.Wait()
+	return updated
+}
+
+// regenerateImagePresets 为单张图片重建预设，原图带水印时使用无水印版本
+func regenerateImagePresets(img models.Image, presets, stale []models.ImagePreset) error {
+	store := storage.GetStorage()
+	fileKey := storage.KeyFromURL(img.Url)
+
+	for _, preset := range stale {
+		if err := store.Delete(presetKeyOf(fileKey, preset)); err != nil {
+			fmt.Printf("删除旧预设文件失败: %s, %v\n", presetKeyOf(fileKey, preset), err)
+		}
+	}
+	if len(presets) == 0 {
+		return nil
+	}
+
+	data, err := readStorageObject(cleanOriginalKeyOf(fileKey))
+	if err != nil {
+		if data, err = readStorageObject(fileKey); err != nil {
+			return err
+		}
+	}
+
+	transformSemaphore <- struct{}{}
+	renditions, err := services.NewImageService().RenderPresets(data, presets)
+	<-transformSemaphore
+	for _, rendition := range renditions {
+		key := presetKeyOf(fileKey, rendition.Preset)
+		if err := store.Put(key, bytes.NewReader(rendition.Bytes), services.MimeTypeOf(rendition.Preset.Format)); err != nil {
+			return err
+		}
+	}
+	return err
+}
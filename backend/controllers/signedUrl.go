@@ -0,0 +1,110 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"oneimg/backend/config"
+	"oneimg/backend/database"
+	"oneimg/backend/models"
+	"oneimg/backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SignedURLRequest 签发签名URL请求
+type SignedURLRequest struct {
+	Type      string `json:"type"` // original: 原图; transform: 按需变换 (默认)
+	Width     int    `json:"w"`
+	Height    int    `json:"h"`
+	Fit       string `json:"fit"`
+	Format    string `json:"fmt"`
+	Quality   int    `json:"q"`
+	ExpiresIn int64  `json:"expires_in"` // 有效期(秒)，0 表示永久有效
+}
+
+// CreateSignedURL 为指定图片签发签名URL
+func CreateSignedURL(c *gin.Context) {
+	cfg := c.MustGet("config").(*config.Config)
+	if cfg.SignKey == "" {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"code": 503, "msg": "URL 签名未启用，请设置 URL_SIGN_KEY"})
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "无效的图片ID"})
+		return
+	}
+
+	var req SignedURLRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "参数错误"})
+		return
+	}
+	if req.ExpiresIn < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "有效期不能为负数"})
+		return
+	}
+
+	var image models.Image
+	if err := database.GetDB().DB.First(&image, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 404, "msg": "图片不存在"})
+		return
+	}
+
+	var path string
+	query := url.Values{}
+	switch req.Type {
+	case "original":
+		if !strings.HasPrefix(image.Url, "/uploads/") {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "该图片不经由本站访问，无法签名"})
+			return
+		}
+		path = image.Url
+	case "", "transform":
+		path = fmt.Sprintf("/img/%d", id)
+		if req.Width > 0 {
+			query.Set("w", strconv.Itoa(req.Width))
+		}
+		if req.Height > 0 {
+			query.Set("h", strconv.Itoa(req.Height))
+		}
+		if req.Quality > 0 {
+			query.Set("q", strconv.Itoa(req.Quality))
+		}
+		if req.Fit != "" {
+			query.Set("fit", req.Fit)
+		}
+		if req.Format != "" {
+			query.Set("fmt", req.Format)
+		}
+		if _, err := services.ParseTransformQuery(query.Get); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "参数错误: " + err.Error()})
+			return
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "不支持的类型: " + req.Type})
+		return
+	}
+
+	var expires time.Time
+	if req.ExpiresIn > 0 {
+		expires = time.Now().Add(time.Duration(req.ExpiresIn) * time.Second)
+	}
+
+	signedPath := services.SignURL(cfg.SignKey, path, query, expires)
+
+	data := gin.H{
+		"url":  strings.TrimSuffix(cfg.AppUrl, "/") + signedPath,
+		"path": signedPath,
+	}
+	if !expires.IsZero() {
+		data["expires_at"] = expires.Format("2006-01-02 15:04:05")
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 200, "msg": "签发成功", "data": data})
+}
@@ -0,0 +1,146 @@
+package controllers
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"oneimg/backend/config"
+	"oneimg/backend/database"
+	"oneimg/backend/models"
+	"oneimg/backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 相似图片查询参数默认值与上限
+const (
+	defaultSimilarLimit       = 10
+	maxSimilarLimit           = 100
+	defaultSimilarMaxDistance = 20
+)
+
+// SimilarImage 相似图片查询结果
+type SimilarImage struct {
+	models.Image
+	Distance int `json:"distance"` // 感知哈希汉明距离，越小越相似
+}
+
+// similarQuery 读取 limit / max_distance 参数
+func similarQuery(c *gin.Context) (limit, maxDistance int, err error) {
+	limit, maxDistance = defaultSimilarLimit, defaultSimilarMaxDistance
+	if value := c.Query("limit"); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil || limit < 1 || limit > maxSimilarLimit {
+			return 0, 0, fmt.Errorf("limit 取值范围为 1~%d", maxSimilarLimit)
+		}
+	}
+	if value := c.Query("max_distance"); value != "" {
+		if maxDistance, err = strconv.Atoi(value); err != nil || maxDistance < 0 || maxDistance > 64 {
+			return 0, 0, fmt.Errorf("max_distance 取值范围为 0~64")
+		}
+	}
+	return limit, maxDistance, nil
+}
+
+// respondSimilar 按索引查询结果读取图片并返回
+func respondSimilar(c *gin.Context, hash uint64, limit, maxDistance int, exclude map[int]bool) {
+	matches := services.Similar.Nearest(hash, limit, maxDistance, exclude)
+	results := make([]SimilarImage, 0, len(matches))
+	if len(matches) > 0 {
+		images, err := loadImagesByMatches(database.GetDB().DB, matches)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": "查询失败"})
+			return
+		}
+		for _, match := range matches {
+			if img, ok := images[match.ImageID]; ok {
+				results = append(results, SimilarImage{Image: img, Distance: match.Distance})
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "获取相似图片成功",
+		"data": gin.H{
+			"phash":  services.FormatPHash(hash),
+			"images": results,
+		},
+	})
+}
+
+// GetSimilarImages 查找与指定图片最相似的图片
+// 参数: limit 返回数量 (默认 10，最多 100)，max_distance 最大汉明距离 (默认 20)
+func GetSimilarImages(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "无效的图片ID"})
+		return
+	}
+	limit, maxDistance, err := similarQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": err.Error()})
+		return
+	}
+
+	hash, ok := services.Similar.Hash(id)
+	if !ok {
+		var image models.Image
+		if err := database.GetDB().DB.First(&image, id).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"code": 404, "msg": "图片不存在"})
+			return
+		}
+		c.JSON(http.StatusConflict, gin.H{"code": 409, "msg": "该图片尚未计算感知哈希"})
+		return
+	}
+
+	respondSimilar(c, hash, limit, maxDistance, map[int]bool{id: true})
+}
+
+// SearchByImage 上传一张图片，查找图库中与之最相似的图片（上传的图片不会保存）
+// 表单字段: image；查询参数同 GetSimilarImages
+func SearchByImage(c *gin.Context) {
+	limit, maxDistance, err := similarQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": err.Error()})
+		return
+	}
+
+	fileHeader, err := c.FormFile("image")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "未检测到文件"})
+		return
+	}
+	cfg := c.MustGet("config").(*config.Config)
+	if fileHeader.Size > cfg.MaxFileSize {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "文件大小超出限制"})
+		return
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "无法打开文件"})
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, cfg.MaxFileSize+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "读取文件失败"})
+		return
+	}
+	if _, err := services.CheckUpload(data, uploadLimitsOf(cfg)); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": err.Error()})
+		return
+	}
+
+	transformSemaphore <- struct{}{}
+	phash, err := services.NewImageService().PerceptualHashBytes(data)
+	<-transformSemaphore
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "无法解析图片: " + err.Error()})
+		return
+	}
+	hash, _ := services.ParsePHash(phash)
+
+	respondSimilar(c, hash, limit, maxDistance, nil)
+}
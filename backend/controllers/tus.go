@@ -0,0 +1,306 @@
+package controllers
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"oneimg/backend/config"
+	"oneimg/backend/database"
+	"oneimg/backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// tus 1.0 可续传上传协议，支持 creation、creation-with-upload、termination 与 expiration 扩展
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,creation-with-upload,termination,expiration"
+	tusBasePath   = "/api/upload/tus/"
+	tusChunkType  = "application/offset+octet-stream"
+)
+
+// TusOptions 返回服务端支持的协议版本与扩展
+func TusOptions(c *gin.Context) {
+	cfg := c.MustGet("config").(*config.Config)
+	c.Header("Tus-Resumable", tusVersion)
+	c.Header("Tus-Version", tusVersion)
+	c.Header("Tus-Extension", tusExtensions)
+	if cfg.MaxFileSize > 0 {
+		c.Header("Tus-Max-Size", strconv.FormatInt(cfg.MaxFileSize, 10))
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// checkTusResumable 校验客户端的协议版本
+func checkTusResumable(c *gin.Context) bool {
+	c.Header("Tus-Resumable", tusVersion)
+	if c.GetHeader("Tus-Resumable") != tusVersion {
+		c.Header("Tus-Version", tusVersion)
+		c.JSON(http.StatusPreconditionFailed, gin.H{"code": 412, "message": "不支持的 tus 协议版本"})
+		return false
+	}
+	return true
+}
+
+// TusCreate 创建上传，Upload-Metadata 中可包含 filename、filetype、strip_exif、near_duplicate
+// 请求体非空时按 creation-with-upload 同时写入第一段数据
+func TusCreate(c *gin.Context) {
+	if !checkTusResumable(c) {
+		return
+	}
+	cfg := c.MustGet("config").(*config.Config)
+
+	if c.GetHeader("Upload-Defer-Length") != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "不支持延迟声明文件长度"})
+		return
+	}
+	length, err := strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的 Upload-Length"})
+		return
+	}
+	if cfg.MaxFileSize > 0 && length > cfg.MaxFileSize {
+		message := fmt.Sprintf("文件大小超出限制 (最大 %d 字节)", cfg.MaxFileSize)
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"code":    413,
+			"message": message,
+			"data":    ImageResult{Success: false, Message: message, Reason: services.RejectFileTooLarge},
+		})
+		return
+	}
+	metadata, err := parseTusMetadata(c.GetHeader("Upload-Metadata"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的 Upload-Metadata"})
+		return
+	}
+	if _, err := parseUploadOptions(cfg, metadata["strip_exif"], metadata["near_duplicate"]); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error()})
+		return
+	}
+
+	upload, err := services.Tus.Create(length, metadata)
+	if err != nil {
+		fmt.Printf("创建可续传上传失败: %v\n", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "创建上传失败"})
+		return
+	}
+	c.Header("Location", tusBasePath+upload.ID)
+	setTusExpires(c, upload)
+
+	if c.Request.ContentLength != 0 && c.GetHeader("Content-Type") == tusChunkType {
+		writeTusChunk(c, upload.ID, 0, http.StatusCreated)
+		return
+	}
+	// 空文件直接完成
+	if length == 0 {
+		if status, body := finishTusUpload(c, upload); status != http.StatusOK {
+			c.JSON(status, body)
+			return
+		}
+	}
+	c.Header("Upload-Offset", "0")
+	c.Status(http.StatusCreated)
+}
+
+// TusHead 查询上传进度，客户端据此从 Upload-Offset 续传
+func TusHead(c *gin.Context) {
+	if !checkTusResumable(c) {
+		return
+	}
+	c.Header("Cache-Control", "no-store")
+	upload, err := services.Tus.Get(c.Param("id"))
+	if err != nil {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	c.Header("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	if len(upload.Metadata) > 0 {
+		c.Header("Upload-Metadata", formatTusMetadata(upload.Metadata))
+	}
+	setTusExpires(c, upload)
+	c.Status(http.StatusOK)
+}
+
+// TusPatch 从 Upload-Offset 处追加数据，全部接收后交给上传流程处理
+func TusPatch(c *gin.Context) {
+	if !checkTusResumable(c) {
+		return
+	}
+	if c.GetHeader("Content-Type") != tusChunkType {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"code": 415, "message": "Content-Type 必须为 " + tusChunkType})
+		return
+	}
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "无效的 Upload-Offset"})
+		return
+	}
+	writeTusChunk(c, c.Param("id"), offset, http.StatusNoContent)
+}
+
+// writeTusChunk 写入请求体并在上传完成时处理图片，成功时以 status 响应
+func writeTusChunk(c *gin.Context, id string, offset int64, status int) {
+	unlock, err := services.Tus.Lock(id)
+	if err != nil {
+		c.JSON(http.StatusLocked, gin.H{"code": 423, "message": "该上传正在被其他请求写入"})
+		return
+	}
+	defer unlock()
+
+	upload, err := services.Tus.Get(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "上传不存在或已过期"})
+		return
+	}
+	if c.Request.ContentLength > 0 && offset+c.Request.ContentLength > upload.Length {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"code": 413, "message": "数据超出声明的文件长度"})
+		return
+	}
+
+	upload, err = services.Tus.WriteChunk(id, offset, c.Request.Body)
+	switch {
+	case errors.Is(err, services.ErrTusNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "上传不存在或已过期"})
+		return
+	case errors.Is(err, services.ErrTusOffsetMismatch), errors.Is(err, services.ErrTusCompleted):
+		c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+		c.JSON(http.StatusConflict, gin.H{"code": 409, "message": "Upload-Offset 与服务端不一致"})
+		return
+	case err != nil && upload == nil:
+		fmt.Printf("写入可续传上传失败 %s: %v\n", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "message": "写入失败"})
+		return
+	case err != nil:
+		// 连接中断，已写入的部分保留，客户端通过 HEAD 获取新的偏移续传
+		fmt.Printf("可续传上传中断 %s: 已接收 %d/%d 字节: %v\n", id, upload.Offset, upload.Length, err)
+		c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "读取数据失败"})
+		return
+	}
+
+	c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	setTusExpires(c, upload)
+	if upload.Offset == upload.Length {
+		if code, body := finishTusUpload(c, upload); code != http.StatusOK {
+			// 数据已全部接收但处理失败，返回拒绝原因，客户端不应重试
+			c.JSON(code, body)
+			return
+		}
+	}
+	c.Status(status)
+}
+
+// finishTusUpload 将完整的数据交给上传流程，结果保存在上传记录中，可通过 TusResult 查询
+func finishTusUpload(c *gin.Context, upload *services.TusUpload) (int, gin.H) {
+	cfg := c.MustGet("config").(*config.Config)
+	data, err := services.Tus.ReadData(upload.ID)
+	if err != nil {
+		return http.StatusInternalServerError, gin.H{"code": 500, "message": "读取上传数据失败"}
+	}
+	opts, _ := parseUploadOptions(cfg, upload.Metadata["strip_exif"], upload.Metadata["near_duplicate"])
+	filename := upload.Metadata["filename"]
+	if filename == "" {
+		filename = upload.Metadata["name"]
+	}
+
+	result := processUploadBytes(filename, data, cfg, database.GetDB(), opts)
+	if err := services.Tus.Complete(upload, result); err != nil {
+		fmt.Printf("保存可续传上传结果失败 %s: %v\n", upload.ID, err)
+	}
+	if !result.Success {
+		status := rejectionStatus(result.Reason)
+		return status, gin.H{"code": status, "message": result.Message, "data": result}
+	}
+	return http.StatusOK, nil
+}
+
+// TusResult 查询上传完成后的处理结果（tus 之外的扩展接口）
+func TusResult(c *gin.Context) {
+	upload, err := services.Tus.Get(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"code": 404, "message": "上传不存在或已过期"})
+		return
+	}
+	if !upload.Completed {
+		c.JSON(http.StatusAccepted, gin.H{
+			"code":    202,
+			"message": "上传未完成",
+			"data":    gin.H{"offset": upload.Offset, "length": upload.Length},
+		})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 200, "message": "上传已完成", "data": upload.Result})
+}
+
+// TusDelete 终止上传并删除已接收的数据
+func TusDelete(c *gin.Context) {
+	if !checkTusResumable(c) {
+		return
+	}
+	id := c.Param("id")
+	unlock, err := services.Tus.Lock(id)
+	if err != nil {
+		c.JSON(http.StatusLocked, gin.H{"code": 423, "message": "该上传正在被其他请求写入"})
+		return
+	}
+	defer unlock()
+	if err := services.Tus.Delete(id); err != nil {
+		c.Status(http.StatusNotFound)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func setTusExpires(c *gin.Context, upload *services.TusUpload) {
+	c.Header("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+}
+
+// parseTusMetadata 解析 Upload-Metadata: "key base64值,key2 base64值"，值可以省略
+func parseTusMetadata(header string) (map[string]string, error) {
+	metadata := make(map[string]string)
+	if strings.TrimSpace(header) == "" {
+		return metadata, nil
+	}
+	for _, pair := range strings.Split(header, ",") {
+		parts := strings.Fields(pair)
+		if len(parts) == 0 || len(parts) > 2 {
+			return nil, fmt.Errorf("invalid metadata pair: %q", pair)
+		}
+		value := ""
+		if len(parts) == 2 {
+			decoded, err := base64.StdEncoding.DecodeString(parts[1])
+			if err != nil {
+				return nil, err
+			}
+			value = string(decoded)
+		}
+		if _, exists := metadata[parts[0]]; exists {
+			return nil, fmt.Errorf("duplicate metadata key: %s", parts[0])
+		}
+		metadata[parts[0]] = value
+	}
+	return metadata, nil
+}
+
+// formatTusMetadata 按键名排序编码 Upload-Metadata
+func formatTusMetadata(metadata map[string]string) string {
+	keys := make([]string, 0, len(metadata))
+	for key := range metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, key := range keys {
+		pairs[i] = key
+		if metadata[key] != "" {
+			pairs[i] += " " + base64.StdEncoding.EncodeToString([]byte(metadata[key]))
+		}
+	}
+	return strings.Join(pairs, ",")
+}
@@ -0,0 +1,249 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"oneimg/backend/config"
+	"oneimg/backend/database"
+	"oneimg/backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 单次请求最多的图片数
+const maxBase64Images = 20
+
+// 请求体上限为该数量的最大尺寸图片编码后的体积，多张小图可以一次上传，大图需分批
+const maxBase64BodyImages = 4
+
+var errTooManyBase64Images = fmt.Errorf("单次最多上传 %d 张图片", maxBase64Images)
+
+// Base64Image 一张 base64 图片，JSON 中可以是对象，也可以直接是字符串
+type Base64Image struct {
+	Data     string `json:"data"`
+	FileName string `json:"filename"`
+}
+
+func (b *Base64Image) UnmarshalJSON(raw []byte) error {
+	var data string
+	if err := json.Unmarshal(raw, &data); err == nil {
+		b.Data = data
+		return nil
+	}
+	type plain Base64Image
+	return json.Unmarshal(raw, (*plain)(b))
+}
+
+// base64Item 已解码的一张图片，解码失败时保留拒绝原因
+type base64Item struct {
+	data         []byte
+	declaredType string
+	fileName     string
+	err          error
+}
+
+func decodeBase64Item(payload string, maxSize int64) *base64Item {
+	data, declaredType, err := services.DecodeBase64Image(payload, maxSize)
+	return &base64Item{data: data, declaredType: declaredType, err: err}
+}
+
+// base64Upload base64 上传请求
+// 单张: {"data": "data:image/png;base64,...", "filename": "paste.png"}
+// 多张: {"images": ["data:image/png;base64,...", {"data": "...", "filename": "a.jpg"}]}，或直接以数组作为请求体
+type base64Upload struct {
+	items         []*base64Item
+	single        bool // 只有顶层 data 一张图片
+	stripExif     string
+	nearDuplicate string
+}
+
+// parseBase64Upload 流式解析请求体，每读到一张图片立即解码，不保留原始请求体与编码后的字符串
+func parseBase64Upload(body io.Reader, maxSize int64) (*base64Upload, error) {
+	dec := json.NewDecoder(body)
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	upload := &base64Upload{}
+	switch tok {
+	case json.Delim('['):
+		// 请求体也可以直接是图片数组
+		err = upload.readImages(dec, maxSize)
+	case json.Delim('{'):
+		err = upload.readObject(dec, maxSize)
+	default:
+		err = errors.New("请求体必须是 JSON 对象或数组")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return upload, nil
+}
+
+// readObject 读取 { 之后的各字段，顶层 data 排在 images 之前
+func (u *base64Upload) readObject(dec *json.Decoder, maxSize int64) error {
+	var top *base64Item
+	var fileName string
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		key, _ := tok.(string)
+		switch strings.ToLower(key) {
+		case "data":
+			var data string
+			if err := dec.Decode(&data); err != nil {
+				return err
+			}
+			if data != "" {
+				top = decodeBase64Item(data, maxSize)
+			}
+		case "filename":
+			err = dec.Decode(&fileName)
+		case "images":
+			if tok, err = dec.Token(); err != nil || tok == nil {
+				break
+			}
+			if tok != json.Delim('[') {
+				return errors.New("images 必须是数组")
+			}
+			err = u.readImages(dec, maxSize)
+		case "strip_exif":
+			err = dec.Decode(&u.stripExif)
+		case "near_duplicate":
+			err = dec.Decode(&u.nearDuplicate)
+		default:
+			var skip json.RawMessage
+			err = dec.Decode(&skip)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if _, err := dec.Token(); err != nil {
+		return err
+	}
+
+	if top != nil {
+		if len(u.items) >= maxBase64Images {
+			return errTooManyBase64Images
+		}
+		top.fileName = fileName
+		u.single = len(u.items) == 0
+		u.items = append([]*base64Item{top}, u.items...)
+	}
+	return nil
+}
+
+// readImages 读取 [ 之后的图片数组
+func (u *base64Upload) readImages(dec *json.Decoder, maxSize int64) error {
+	for dec.More() {
+		if len(u.items) >= maxBase64Images {
+			return errTooManyBase64Images
+		}
+		var image Base64Image
+		if err := dec.Decode(&image); err != nil {
+			return err
+		}
+		item := decodeBase64Item(image.Data, maxSize)
+		item.fileName = image.FileName
+		u.items = append(u.items, item)
+	}
+	_, err := dec.Token()
+	return err
+}
+
+// UploadBase64 上传 base64 或 data URI 编码的图片（编辑器粘贴截图等）
+func UploadBase64(c *gin.Context) {
+	cfg := c.MustGet("config").(*config.Config)
+
+	// 按编码后的体积限制请求体
+	if cfg.MaxFileSize > 0 {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, (cfg.MaxFileSize/3*4+1024)*maxBase64BodyImages)
+	}
+	req, err := parseBase64Upload(c.Request.Body, cfg.MaxFileSize)
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		switch {
+		case errors.As(err, &tooLarge):
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"code": 413, "message": "请求体过大", "data": []string{}})
+		case errors.Is(err, errTooManyBase64Images):
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error(), "data": []string{}})
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "参数错误: " + err.Error(), "data": []string{}})
+		}
+		return
+	}
+
+	images, single := req.items, req.single
+	if len(images) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "未提供图片数据", "data": []string{}})
+		return
+	}
+	opts, err := parseUploadOptions(cfg, req.stripExif, req.nearDuplicate)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error(), "data": []string{}})
+		return
+	}
+
+	db := database.GetDB()
+	results := make([]ImageResult, 0, len(images))
+	successCount := 0
+	for i, image := range images {
+		result := uploadBase64Image(image, cfg, db, opts)
+		images[i] = nil // 处理完即释放
+		results = append(results, result)
+		if result.Success {
+			successCount++
+		}
+	}
+
+	if single {
+		// 单张时与 UploadImage 一致，按失败原因返回状态码
+		result := results[0]
+		if result.Success {
+			c.JSON(http.StatusOK, gin.H{"code": 200, "message": "上传成功", "data": result})
+			return
+		}
+		status := rejectionStatus(result.Reason)
+		c.JSON(status, gin.H{"code": status, "message": result.Message, "data": result})
+		return
+	}
+
+	if successCount > 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"code":    200,
+			"message": fmt.Sprintf("成功上传 %d 张图片", successCount),
+			"data":    results,
+		})
+	} else {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "所有图片上传失败",
+			"data":    results,
+		})
+	}
+}
+
+// uploadBase64Image 保存一张已解码的图片，未指定文件名时按 data URI 声明的类型命名
+func uploadBase64Image(image *base64Item, cfg *config.Config, db *database.Database, opts UploadOptions) ImageResult {
+	if image.err != nil {
+		return rejectedResult(image.err)
+	}
+
+	filename := image.fileName
+	if filename == "" {
+		filename = "paste"
+		if exts, _ := mime.ExtensionsByType(image.declaredType); len(exts) > 0 {
+			filename += exts[0]
+		}
+	}
+	return processUploadBytes(filename, image.data, cfg, db, opts)
+}
@@ -1,16 +1,17 @@
 package controllers
 
 import (
+	"bytes"
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"math/rand"
 	"mime/multipart"
 	"net/http"
-	"os"
 	"path/filepath"
 	"strings"
 	"sync"
@@ -20,8 +21,10 @@ import (
 	"oneimg/backend/database"
 	"oneimg/backend/models"
 	"oneimg/backend/services"
+	"oneimg/backend/storage"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 // UploadResponse 上传响应结构
@@ -35,6 +38,8 @@ type UploadResponse struct {
 type ImageResult struct {
 	Success   bool   `json:"success"`
 	Message   string `json:"message,omitempty"`
+	Reason    string `json:"reason,omitempty"` // 失败原因代码，见 services.Reject* 常量
+	Source    string `json:"source,omitempty"` // 非表单上传时的来源（远程 URL 等）
 	ID        int    `json:"id,omitempty"`
 	URL       string `json:"url,omitempty"`
 	FileName  string `json:"filename,omitempty"`
@@ -45,6 +50,9 @@ type ImageResult struct {
 	Category  string `json:"category,omitempty"`
 	Tags      string `json:"tags,omitempty"`
 	CreatedAt string `json:"created_at,omitempty"`
+
+	// 感知哈希相似的已有图片（warn 模式下上传成功也会返回）
+	NearDuplicates []NearDuplicate `json:"near_duplicates,omitempty"`
 }
 
 // OpenAIRequest OpenAI API 请求结构
@@ -85,13 +93,6 @@ type AIProgressStruct struct {
 
 var AIProgress = AIProgressStruct{}
 
-func ensureUploadDir(uploadPath string) error {
-	if _, err := os.Stat(uploadPath); os.IsNotExist(err) {
-		return os.MkdirAll(uploadPath, 0755)
-	}
-	return nil
-}
-
 func generateUniqueFileName(ext string) string {
 	timestamp := time.Now().UnixNano()
 	hash := fmt.Sprintf("%x", timestamp)
@@ -125,9 +126,115 @@ func determineOutputFormat(contentType, originalExt string) string {
 	}
 }
 
-func calculateFileHash(file multipart.File) (string, error) {
+// thumbKeyOf 由原图 key 得到缩略图 key (name_thumb.ext)
+func thumbKeyOf(fileKey string) string {
+	ext := filepath.Ext(fileKey)
+	return strings.TrimSuffix(fileKey, ext) + "_thumb" + ext
+}
+
+// previewKeyOf 由原图 key 得到预览图 key (name_preview.webp)
+// 文件名保持不变以兼容已有链接，实际格式由 PREVIEW_FORMAT 决定，返回时按内容识别 Content-Type
+func previewKeyOf(fileKey string) string {
+	return strings.TrimSuffix(fileKey, filepath.Ext(fileKey)) + "_preview.webp"
+}
+
+// presetKeyOf 由原图 key 得到预设衍生图 key (name_{preset}.ext)，内置预设沿用原有文件名
+func presetKeyOf(fileKey string, preset models.ImagePreset) string {
+	switch preset.Name {
+	case services.PresetThumb:
+		return thumbKeyOf(fileKey)
+	case services.PresetPreview:
+		return previewKeyOf(fileKey)
+	}
+	return strings.TrimSuffix(fileKey, filepath.Ext(fileKey)) + "_" + preset.Name + services.PresetExt(preset.Format)
+}
+
+// derivedSuffixOf 衍生文件的后缀 (thumb / preview / source / 自定义预设名)，原图返回空
+// 上传文件名由随机字符组成不含下划线，因此可按最后一个下划线区分
+func derivedSuffixOf(fileKey string) string {
+	base := strings.TrimSuffix(fileKey, filepath.Ext(fileKey))
+	i := strings.LastIndex(base, "_")
+	if i < 0 {
+		return ""
+	}
+	suffix := base[i+1:]
+	if suffix == "source" {
+		return suffix
+	}
+	if _, ok := services.FindPreset(suffix); ok {
+		return suffix
+	}
+	return ""
+}
+
+// cleanOriginalKeyOf 写入水印前的原图 key，保存在不对外提供的 .originals 目录下
+func cleanOriginalKeyOf(fileKey string) string {
+	return privateOriginalsPrefix + fileKey
+}
+
+// sourceKeyOf 转换保存的图片对应的原始文件 key (name_source.heic)
+func sourceKeyOf(fileKey, sourceExt string) string {
+	return strings.TrimSuffix(fileKey, filepath.Ext(fileKey)) + "_source" + sourceExt
+}
+
+// privateSourceKeyOf 原图受水印保护时原始文件的 key，与无水印原图一样保存在 .originals 目录下
+func privateSourceKeyOf(fileKey, sourceFormat string) string {
+	return cleanOriginalKeyOf(sourceKeyOf(fileKey, "."+sourceFormat))
+}
+
+// readStorageObject 从存储后端读取完整对象
+func readStorageObject(key string) ([]byte, error) {
+	reader, _, err := storage.GetStorage().Get(key)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+// deleteImageFiles 删除图片的原图及所有衍生文件
+func deleteImageFiles(img models.Image) {
+	store := storage.GetStorage()
+	fileKey := storage.KeyFromURL(img.Url)
+	keys := []string{fileKey, cleanOriginalKeyOf(fileKey)}
+	if img.SourceFormat != "" {
+		keys = append(keys, privateSourceKeyOf(fileKey, img.SourceFormat))
+	}
+	for _, preset := range services.CurrentPresets() {
+		keys = append(keys, presetKeyOf(fileKey, preset))
+	}
+	if img.SourceUrl != "" {
+		keys = append(keys, storage.KeyFromURL(img.SourceUrl))
+	}
+	for _, format := range modernFormats {
+		keys = append(keys, modernSiblingKey(fileKey, format))
+	}
+	for _, key := range keys {
+		if err := store.Delete(key); err != nil {
+			fmt.Printf("删除文件失败: %s, %v\n", key, err)
+		}
+	}
+	// 清理按需生成的衍生图缓存
+	services.Variants.Purge(img.Id)
+}
+
+// deleteImageRecord 删除图片及其关联的元数据记录
+func deleteImageRecord(db *gorm.DB, img models.Image) error {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("image_id = ?", img.Id).Delete(&models.ImageMetadata{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&img).Error
+	})
+	if err == nil {
+		services.Similar.Remove(img.Id)
+	}
+	return err
+}
+
+func calculateFileHash(reader io.Reader) (string, error) {
 	hash := sha256.New()
-	if _, err := io.Copy(hash, file); err != nil {
+	if _, err := io.Copy(hash, reader); err != nil {
 		return "", err
 	}
 	return hex.EncodeToString(hash.Sum(nil)), nil
@@ -240,20 +347,104 @@ func getAIInfo(imageBytes []byte, cfg *config.Config) (string, string) {
 	return "", ""
 }
 
-func processUploadFile(fileHeader *multipart.FileHeader, cfg *config.Config, db *database.Database) ImageResult {
-	// 1. 基础验证
-	file, err := fileHeader.Open()
+// UploadOptions 单次上传的可选参数
+type UploadOptions struct {
+	StripExif     string // 原图 EXIF 隐私处理: none / gps / all
+	NearDuplicate string // 相似图片处理: off / warn / reject
+	Category      string // 指定分类（如压缩包导入时的文件夹名），为空时使用 AI 分类
+}
+
+// uploadOptionsFromRequest 读取上传表单中的可选参数，未指定时使用全局配置
+func uploadOptionsFromRequest(c *gin.Context, cfg *config.Config) (UploadOptions, error) {
+	return parseUploadOptions(cfg, c.PostForm("strip_exif"), c.PostForm("near_duplicate"))
+}
+
+// parseUploadOptions 校验上传参数，为空的参数使用全局配置
+func parseUploadOptions(cfg *config.Config, stripExif, nearDuplicate string) (UploadOptions, error) {
+	opts := UploadOptions{StripExif: cfg.StripExif, NearDuplicate: cfg.NearDuplicate}
+	if mode := strings.ToLower(stripExif); mode != "" {
+		if !services.ValidStripExifMode(mode) {
+			return opts, fmt.Errorf("无效的 strip_exif 参数: %s", mode)
+		}
+		opts.StripExif = mode
+	}
+	if mode := strings.ToLower(nearDuplicate); mode != "" {
+		if !services.ValidNearDuplicateMode(mode) {
+			return opts, fmt.Errorf("无效的 near_duplicate 参数: %s", mode)
+		}
+		opts.NearDuplicate = mode
+	}
+	return opts, nil
+}
+
+// uploadLimitsOf 由配置得到上传限制
+func uploadLimitsOf(cfg *config.Config) services.UploadLimits {
+	return services.UploadLimits{
+		MaxFileSize:   cfg.MaxFileSize,
+		AllowedTypes:  cfg.AllowedTypes,
+		MaxMegapixels: cfg.MaxMegapixels,
+		MaxGIFFrames:  cfg.MaxGIFFrames,
+	}
+}
+
+// rejectedResult 上传检查未通过时的结果
+func rejectedResult(err error) ImageResult {
+	var rejection *services.UploadRejection
+	if errors.As(err, &rejection) {
+		return ImageResult{Success: false, Message: rejection.Message, Reason: rejection.Reason}
+	}
+	return ImageResult{Success: false, Message: "读取文件失败"}
+}
+
+// rejectionStatus 单张上传失败时按原因返回的 HTTP 状态码
+func rejectionStatus(reason string) int {
+	switch reason {
+	case services.RejectFileTooLarge:
+		return http.StatusRequestEntityTooLarge
+	case services.RejectUnsupportedType:
+		return http.StatusUnsupportedMediaType
+	case services.RejectTooManyPixels, services.RejectTooManyFrames, services.RejectCorruptImage:
+		return http.StatusUnprocessableEntity
+	case services.RejectNearDuplicate:
+		return http.StatusConflict
+	case services.RejectBlockedAddress:
+		return http.StatusForbidden
+	case services.RejectFetchFailed:
+		return http.StatusBadGateway
+	case services.RejectFetchTimeout:
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+func processUploadFile(fileHeader *multipart.FileHeader, cfg *config.Config, db *database.Database, opts UploadOptions) ImageResult {
+	// 1. 基础验证：解码前检查大小、真实类型、声明的尺寸与 GIF 帧数
+	imgService := services.NewImageService()
+	data, _, err := imgService.ValidateImage(fileHeader, uploadLimitsOf(cfg))
 	if err != nil {
-		return ImageResult{Success: false, Message: "无法打开文件"}
+		return rejectedResult(err)
+	}
+	return processUploadData(fileHeader.Filename, data, fileHeader.Header.Get("Content-Type"), cfg, db, opts)
+}
+
+// processUploadBytes 处理表单以外来源（远程 URL 等）的图片数据，先按上传限制检查
+func processUploadBytes(filename string, data []byte, cfg *config.Config, db *database.Database, opts UploadOptions) ImageResult {
+	if _, err := services.CheckUpload(data, uploadLimitsOf(cfg)); err != nil {
+		return rejectedResult(err)
 	}
-	defer file.Close()
+	return processUploadData(filename, data, "", cfg, db, opts)
+}
+
+// processUploadData 处理已通过上传检查的图片：查重、生成衍生图、保存并写入数据库
+func processUploadData(filename string, data []byte, contentType string, cfg *config.Config, db *database.Database, opts UploadOptions) ImageResult {
+	imgService := services.NewImageService()
 
 	// 计算哈希
-	fileHash, err := calculateFileHash(file)
+	fileHash, err := calculateFileHash(bytes.NewReader(data))
 	if err != nil {
 		return ImageResult{Success: false, Message: "哈希计算失败"}
 	}
-	file.Seek(0, 0) // 重置指针
 
 	// 查重
 	var existingImage models.Image
@@ -274,15 +465,45 @@ func processUploadFile(fileHeader *multipart.FileHeader, cfg *config.Config, db
 		}
 	}
 
-	// 图片处理服务
-	imgService := services.NewImageService()
-	processedImage, err := imgService.ProcessImage(file, fileHeader)
+	// 图片处理
+	processedImage, err := imgService.ProcessImageBytes(data, contentType)
 	if err != nil {
-		return ImageResult{Success: false, Message: "图片处理失败: " + err.Error()}
+		return ImageResult{Success: false, Message: "图片处理失败: " + err.Error(), Reason: services.RejectCorruptImage}
+	}
+
+	// 按隐私设置清除原图中的 EXIF/GPS（转换后保存的主图本身不含元数据）
+	if opts.StripExif != services.StripExifNone && processedImage.Format == processedImage.SourceFormat {
+		stripped, err := services.StripMetadata(processedImage.CompressedBytes, processedImage.Format, opts.StripExif)
+		if err != nil {
+			return ImageResult{Success: false, Message: "图片元数据处理失败: " + err.Error()}
+		}
+		processedImage.CompressedBytes = stripped
+		if processedImage.CleanBytes != nil {
+			if processedImage.CleanBytes, err = services.StripMetadata(processedImage.CleanBytes, processedImage.Format, opts.StripExif); err != nil {
+				return ImageResult{Success: false, Message: "图片元数据处理失败: " + err.Error()}
+			}
+		}
+	}
+
+	// 相似图片检测（缩放、重新压缩后的副本 SHA-256 不同）
+	var nearDuplicates []NearDuplicate
+	if opts.NearDuplicate != services.NearDuplicateOff && processedImage.PHash != "" {
+		nearDuplicates, err = findNearDuplicates(db.DB, processedImage.PHash, cfg.NearDuplicateThreshold)
+		if err != nil {
+			fmt.Printf("相似图片检测失败: %v\n", err)
+		}
+		if len(nearDuplicates) > 0 && opts.NearDuplicate == services.NearDuplicateReject {
+			return ImageResult{
+				Success:        false,
+				Message:        fmt.Sprintf("存在相似图片 (ID: %d, 距离: %d)", nearDuplicates[0].ID, nearDuplicates[0].Distance),
+				Reason:         services.RejectNearDuplicate,
+				NearDuplicates: nearDuplicates,
+			}
+		}
 	}
 
 	// 2. 命名逻辑 (随机) & AI 标签
-	originalExt := strings.ToLower(filepath.Ext(fileHeader.Filename))
+	originalExt := strings.ToLower(filepath.Ext(filename))
 	outputExt := originalExt
 
 	// 根据解码后的格式规范化扩展名
@@ -295,6 +516,8 @@ func processUploadFile(fileHeader *multipart.FileHeader, cfg *config.Config, db
 		outputExt = ".gif"
 	case "webp":
 		outputExt = ".webp"
+	case "svg":
+		outputExt = ".svg"
 	}
 	
 	// 如果 outputExt 仍然为空，使用原始扩展名
@@ -314,46 +537,75 @@ func processUploadFile(fileHeader *multipart.FileHeader, cfg *config.Config, db
 	if aiTags != "" {
 		tags = aiTags
 	}
+	if opts.Category != "" {
+		category = opts.Category
+	}
 
 	// 3. 保存文件
+	store := storage.GetStorage()
 	today := time.Now().Format("20060102")
-	saveDir := filepath.Join(cfg.UploadPath, today)
-	if err := ensureUploadDir(saveDir); err != nil {
-		return ImageResult{Success: false, Message: "创建目录失败"}
-	}
-
-	savePath := filepath.Join(saveDir, uniqueFileName)
-	fileUrl := fmt.Sprintf("/uploads/%s/%s", today, uniqueFileName)
+	fileKey := today + "/" + uniqueFileName
 
 	// 保存主文件
-	out, err := os.Create(savePath)
-	if err != nil {
+	if err := store.Put(fileKey, bytes.NewReader(processedImage.CompressedBytes), processedImage.MimeType); err != nil {
 		return ImageResult{Success: false, Message: "保存文件失败"}
 	}
-	defer out.Close()
-	out.Write(processedImage.CompressedBytes)
 
 	// 保存缩略图
-	thumbName := strings.TrimSuffix(uniqueFileName, outputExt) + "_thumb" + outputExt
-	thumbPath := filepath.Join(saveDir, thumbName)
-	thumbOut, err := os.Create(thumbPath)
-	if err == nil {
-		defer thumbOut.Close()
-		thumbOut.Write(processedImage.ThumbnailBytes)
+	if err := store.Put(thumbKeyOf(fileKey), bytes.NewReader(processedImage.ThumbnailBytes), processedImage.ThumbnailMimeType); err != nil {
+		fmt.Printf("保存缩略图失败: %v\n", err)
 	}
 
 	// 保存预览图 (用于前端展示)
-	previewName := strings.TrimSuffix(uniqueFileName, outputExt) + "_preview.webp"
-	previewPath := filepath.Join(saveDir, previewName)
-	previewOut, err := os.Create(previewPath)
-	if err == nil {
-		defer previewOut.Close()
-		previewOut.Write(processedImage.PreviewBytes)
+	if err := store.Put(previewKeyOf(fileKey), bytes.NewReader(processedImage.PreviewBytes), processedImage.PreviewMimeType); err != nil {
+		fmt.Printf("保存预览图失败: %v\n", err)
+	}
+
+	// 保存自定义预设衍生图
+	for _, rendition := range processedImage.Presets {
+		key := presetKeyOf(fileKey, rendition.Preset)
+		if err := store.Put(key, bytes.NewReader(rendition.Bytes), services.MimeTypeOf(rendition.Preset.Format)); err != nil {
+			fmt.Printf("保存预设 %s 失败: %v\n", rendition.Preset.Name, err)
+		}
+	}
+
+	// 主文件已写入水印时，另存一份无水印原图（不对外提供访问）
+	if processedImage.CleanBytes != nil {
+		if err := store.Put(cleanOriginalKeyOf(fileKey), bytes.NewReader(processedImage.CleanBytes), processedImage.MimeType); err != nil {
+			fmt.Printf("保存无水印原图失败: %v\n", err)
+		}
+	}
+
+	// 预生成现代格式兄弟文件 (用于 Accept 协商)
+	pregenerateModernSiblings(fileKey, processedImage.CompressedBytes, cfg)
+
+	// HEIC/TIFF/BMP 等转换后保存的图片，按配置保留原始文件
+	// 原始文件同样按 EXIF 隐私处理模式清除元数据，清除失败时不保留
+	// 原始文件不含水印，原图受水印保护时保存在 .originals 目录下，不返回访问地址
+	var sourceUrl string
+	if processedImage.SourceFormat != processedImage.Format && cfg.KeepSourceOriginal {
+		sourceExt := originalExt
+		if sourceExt == "" {
+			sourceExt = "." + processedImage.SourceFormat
+		}
+		sourceKey := sourceKeyOf(fileKey, sourceExt)
+		private := services.CurrentWatermark().CoversOriginal()
+		if private {
+			sourceKey = privateSourceKeyOf(fileKey, processedImage.SourceFormat)
+		}
+		sourceBytes, err := services.StripMetadata(processedImage.OriginalBytes, processedImage.SourceFormat, opts.StripExif)
+		if err != nil {
+			fmt.Printf("原始文件元数据清除失败，不保留原始文件: %v\n", err)
+		} else if err := store.Put(sourceKey, bytes.NewReader(sourceBytes), processedImage.SourceMimeType); err != nil {
+			fmt.Printf("保存原始文件失败: %v\n", err)
+		} else if !private {
+			sourceUrl = store.URL(sourceKey)
+		}
 	}
 
 	// 4. 数据库记录
 	imageModel := models.Image{
-		Url:       fileUrl,
+		Url:       store.URL(fileKey),
 		FileName:  uniqueFileName,
 		FileSize:  int64(len(processedImage.CompressedBytes)),
 		MimeType:  processedImage.MimeType,
@@ -363,11 +615,46 @@ func processUploadFile(fileHeader *multipart.FileHeader, cfg *config.Config, db
 		Category:  category,
 		Tags:      tags,
 		CreatedAt: time.Now(),
+
+		SourceFormat: processedImage.SourceFormat,
+		SourceUrl:    sourceUrl,
+		PHash:        processedImage.PHash,
+		BlurHash:     processedImage.Placeholder.BlurHash,
+		Palette:      strings.Join(processedImage.Placeholder.Palette, ","),
+	}
+	if lab := processedImage.Placeholder.Dominant; lab != nil {
+		imageModel.LabL, imageModel.LabA, imageModel.LabB = &lab.L, &lab.A, &lab.B
 	}
 
 	if err := db.DB.Create(&imageModel).Error; err != nil {
 		return ImageResult{Success: false, Message: "数据库保存失败"}
 	}
+	if hash, err := services.ParsePHash(imageModel.PHash); err == nil {
+		services.Similar.Add(imageModel.Id, hash)
+	}
+
+	// 保存 EXIF 元数据
+	if exifInfo := processedImage.Exif; exifInfo != nil {
+		metadata := models.ImageMetadata{
+			ImageId:      imageModel.Id,
+			Make:         exifInfo.Make,
+			Model:        exifInfo.Model,
+			LensModel:    exifInfo.LensModel,
+			TakenAt:      exifInfo.TakenAt,
+			ExposureTime: exifInfo.ExposureTime,
+			FNumber:      exifInfo.FNumber,
+			ISO:          exifInfo.ISO,
+			FocalLength:  exifInfo.FocalLength,
+			Orientation:  exifInfo.Orientation,
+		}
+		// 已从原图清除 GPS 时同样不保存位置
+		if opts.StripExif == services.StripExifNone {
+			metadata.Latitude, metadata.Longitude = exifInfo.Latitude, exifInfo.Longitude
+		}
+		if err := db.DB.Create(&metadata).Error; err != nil {
+			fmt.Printf("保存图片元数据失败: %v\n", err)
+		}
+	}
 
 	return ImageResult{
 		Success:   true,
@@ -381,6 +668,8 @@ func processUploadFile(fileHeader *multipart.FileHeader, cfg *config.Config, db
 		Category:  imageModel.Category,
 		Tags:      imageModel.Tags,
 		CreatedAt: imageModel.CreatedAt.Format("2006-01-02 15:04:05"),
+
+		NearDuplicates: nearDuplicates,
 	}
 }
 
@@ -400,12 +689,17 @@ func UploadImages(c *gin.Context) {
 
 	cfg := c.MustGet("config").(*config.Config)
 	db := database.GetDB()
+	opts, err := uploadOptionsFromRequest(c, cfg)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error(), "data": []string{}})
+		return
+	}
 
 	var results []ImageResult
 	successCount := 0
 
 	for _, file := range files {
-		result := processUploadFile(file, cfg, db)
+		result := processUploadFile(file, cfg, db, opts)
 		results = append(results, result)
 		if result.Success {
 			successCount++
@@ -437,11 +731,20 @@ func UploadImage(c *gin.Context) {
 
 	cfg := c.MustGet("config").(*config.Config)
 	db := database.GetDB()
+	opts, err := uploadOptionsFromRequest(c, cfg)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error(), "data": []string{}})
+		return
+	}
 
-	result := processUploadFile(file, cfg, db)
+	result := processUploadFile(file, cfg, db, opts)
 
 	if result.Success {
 		c.JSON(http.StatusOK, gin.H{"code": 200, "message": "上传成功", "data": result})
+	} else if result.Reason != "" {
+		// 带拒绝原因（含相似图片列表）返回，便于前端逐项提示
+		status := rejectionStatus(result.Reason)
+		c.JSON(status, gin.H{"code": status, "message": result.Message, "data": result})
 	} else {
 		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": result.Message, "data": []string{}})
 	}
@@ -500,24 +803,18 @@ func BatchTagImages(c *gin.Context) {
 				defer wg.Done()
 				defer func() { <-semaphore }() // 释放令牌
 
-				// 读取图片文件
-				relPath := strings.TrimPrefix(image.Url, "/uploads/")
-				fullPath := filepath.Join(cfg.UploadPath, relPath)
-
-				fileBytes, err := os.ReadFile(fullPath)
+				// 优先读取缩略图以节省token
+				fileKey := storage.KeyFromURL(image.Url)
+				fileBytes, err := readStorageObject(thumbKeyOf(fileKey))
 				if err != nil {
-					fmt.Printf("读取文件失败: %s\n", fullPath)
+					fileBytes, err = readStorageObject(fileKey)
+				}
+				if err != nil {
+					fmt.Printf("读取文件失败: %s\n", fileKey)
 					AIProgress.Current++
 					return
 				}
 
-				// 尝试读取缩略图以节省token
-				ext := filepath.Ext(fullPath)
-				thumbPath := strings.TrimSuffix(fullPath, ext) + "_thumb" + ext
-				if thumbBytes, err := os.ReadFile(thumbPath); err == nil {
-					fileBytes = thumbBytes
-				}
-
 				tags, category := getAIInfo(fileBytes, cfg)
 				if tags != "" {
 					image.Tags = tags
@@ -552,7 +849,6 @@ func BatchDeduplicate(c *gin.Context) {
 	}
 
 	deletedCount := 0
-	cfg := c.MustGet("config").(*config.Config)
 
 	for _, r := range results {
 		var images []models.Image
@@ -563,22 +859,11 @@ func BatchDeduplicate(c *gin.Context) {
 			for i := 1; i < len(images); i++ {
 				img := images[i]
 				
-				// 删除物理文件
-				relPath := strings.TrimPrefix(img.Url, "/uploads/")
-				fullPath := filepath.Join(cfg.UploadPath, relPath)
-				os.Remove(fullPath)
-				
-				// 删除缩略图
-				ext := filepath.Ext(fullPath)
-				thumbPath := strings.TrimSuffix(fullPath, ext) + "_thumb" + ext
-				os.Remove(thumbPath)
-
-				// 删除预览图
-				previewPath := strings.TrimSuffix(fullPath, ext) + "_preview.webp"
-				os.Remove(previewPath)
+				// 删除物理文件（原图、缩略图、预览图）
+				deleteImageFiles(img)
 
 				// 删除数据库记录
-				db.Delete(&img)
+				deleteImageRecord(db, img)
 				deletedCount++
 			}
 		}
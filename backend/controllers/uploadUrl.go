@@ -0,0 +1,112 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"oneimg/backend/config"
+	"oneimg/backend/database"
+	"oneimg/backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UploadURLRequest 远程地址上传请求，url 与 urls 可同时使用
+type UploadURLRequest struct {
+	URL           string   `json:"url"`
+	URLs          []string `json:"urls"`
+	StripExif     string   `json:"strip_exif"`
+	NearDuplicate string   `json:"near_duplicate"`
+}
+
+// UploadFromURL 由服务端下载远程图片并按普通上传流程处理
+// 禁止访问内网、回环、链路本地地址（含重定向后的目标），超出大小或下载超时的地址逐项返回失败原因
+func UploadFromURL(c *gin.Context) {
+	var req UploadURLRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "参数错误: " + err.Error(), "data": []string{}})
+		return
+	}
+
+	var urls []string
+	for _, u := range append([]string{req.URL}, req.URLs...) {
+		if u = strings.TrimSpace(u); u != "" {
+			urls = append(urls, u)
+		}
+	}
+	if len(urls) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": "未提供图片地址", "data": []string{}})
+		return
+	}
+
+	cfg := c.MustGet("config").(*config.Config)
+	if len(urls) > cfg.RemoteUploadMaxURLs {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": fmt.Sprintf("单次最多上传 %d 个地址", cfg.RemoteUploadMaxURLs), "data": []string{}})
+		return
+	}
+	opts, err := parseUploadOptions(cfg, req.StripExif, req.NearDuplicate)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "message": err.Error(), "data": []string{}})
+		return
+	}
+
+	db := database.GetDB()
+	fetchOpts := services.RemoteFetchOptions{
+		MaxSize:      cfg.MaxFileSize,
+		Timeout:      cfg.RemoteUploadTimeout,
+		AllowPrivate: cfg.RemoteUploadAllowPrivate,
+	}
+
+	results := make([]ImageResult, 0, len(urls))
+	successCount := 0
+	for _, u := range urls {
+		result := uploadRemoteImage(c, u, fetchOpts, cfg, db, opts)
+		result.Source = u
+		results = append(results, result)
+		if result.Success {
+			successCount++
+		}
+	}
+
+	if len(urls) == 1 {
+		// 单个地址时与 UploadImage 一致，按失败原因返回状态码
+		result := results[0]
+		if result.Success {
+			c.JSON(http.StatusOK, gin.H{"code": 200, "message": "上传成功", "data": result})
+			return
+		}
+		status := rejectionStatus(result.Reason)
+		c.JSON(status, gin.H{"code": status, "message": result.Message, "data": result})
+		return
+	}
+
+	if successCount > 0 {
+		c.JSON(http.StatusOK, gin.H{
+			"code":    200,
+			"message": fmt.Sprintf("成功上传 %d 张图片", successCount),
+			"data":    results,
+		})
+	} else {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"code":    400,
+			"message": "所有图片上传失败",
+			"data":    results,
+		})
+	}
+}
+
+// uploadRemoteImage 下载单个地址并保存
+func uploadRemoteImage(c *gin.Context, rawURL string, fetchOpts services.RemoteFetchOptions, cfg *config.Config, db *database.Database, opts UploadOptions) ImageResult {
+	remote, err := services.FetchRemoteImage(c.Request.Context(), rawURL, fetchOpts)
+	if err != nil {
+		fmt.Printf("远程图片下载失败 %s: %v\n", rawURL, err)
+		return rejectedResult(err)
+	}
+
+	filename := remote.FileName
+	if filename == "" || filename == "/" || filename == "." {
+		filename = "remote"
+	}
+	return processUploadBytes(filename, remote.Data, cfg, db, opts)
+}
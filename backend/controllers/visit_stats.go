@@ -150,6 +150,9 @@ func GetVisitStats(c *gin.Context) {
 		} else if strings.HasSuffix(baseName, "_preview") {
 			baseName = strings.TrimSuffix(baseName, "_preview")
 			originalFilename = baseName + ".webp" // _preview 是 webp 格式的，但原图可能是其他格式
+		} else if suffix := derivedSuffixOf(filename); suffix != "" {
+			// 自定义预设的扩展名与原图无关，下面按 baseName 模糊匹配
+			baseName = strings.TrimSuffix(baseName, "_"+suffix)
 		}
 
 		// 尝试根据原始文件名查找图片信息
@@ -0,0 +1,243 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image/png"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"oneimg/backend/database"
+	"oneimg/backend/models"
+	"oneimg/backend/services"
+	"oneimg/backend/storage"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// 水印 PNG 文件大小上限
+const maxWatermarkImageSize = 5 << 20
+
+// GetWatermarkSettings 获取水印配置
+func GetWatermarkSettings(c *gin.Context) {
+	wmConfig, err := loadWatermarkConfig()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": "获取设置失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"data": wmConfig,
+	})
+}
+
+// SaveWatermarkSettings 保存水印配置并立即生效
+func SaveWatermarkSettings(c *gin.Context) {
+	wmConfig := services.DefaultWatermarkConfig()
+	if err := c.ShouldBindJSON(&wmConfig); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "参数错误"})
+		return
+	}
+	if wmConfig.Enabled {
+		if err := services.ValidateWatermarkConfig(wmConfig); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "参数错误: " + err.Error()})
+			return
+		}
+	}
+	if err := services.LoadWatermark(wmConfig); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "水印加载失败: " + err.Error()})
+		return
+	}
+
+	if err := saveWatermarkConfig(wmConfig); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": "保存设置失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"code": 200, "msg": "保存成功"})
+}
+
+// UploadWatermarkImage 上传 PNG 水印图片，返回供配置使用的 image_key
+func UploadWatermarkImage(c *gin.Context) {
+	fileHeader, err := c.FormFile("image")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "未检测到文件"})
+		return
+	}
+	if fileHeader.Size > maxWatermarkImageSize {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "水印图片不能超过 5MB"})
+		return
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "无法打开文件"})
+		return
+	}
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, maxWatermarkImageSize+1))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "读取文件失败"})
+		return
+	}
+	if _, err := png.DecodeConfig(bytes.NewReader(data)); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"code": 400, "msg": "水印图片必须为 PNG 格式"})
+		return
+	}
+
+	if err := storage.GetStorage().Put(services.WatermarkImageKey, bytes.NewReader(data), "image/png"); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": "保存水印图片失败"})
+		return
+	}
+
+	// 正在使用图片水印时立即替换
+	if wmConfig, err := loadWatermarkConfig(); err == nil && wmConfig.Enabled && wmConfig.Type == "image" {
+		if err := services.LoadWatermark(wmConfig); err != nil {
+			fmt.Printf("重新加载水印失败: %v\n", err)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"code": 200,
+		"msg":  "上传成功",
+		"data": gin.H{"image_key": services.WatermarkImageKey},
+	})
+}
+
+// loadWatermarkConfig 读取水印配置，不存在时返回默认配置
+func loadWatermarkConfig() (models.WatermarkConfig, error) {
+	db := database.GetDB().DB
+	var setting models.Settings
+	if err := db.Where("`key` = ?", "watermark_config").First(&setting).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return services.DefaultWatermarkConfig(), nil
+		}
+		return models.WatermarkConfig{}, err
+	}
+
+	wmConfig := services.DefaultWatermarkConfig()
+	if err := json.Unmarshal([]byte(setting.Value), &wmConfig); err != nil {
+		return models.WatermarkConfig{}, err
+	}
+	return wmConfig, nil
+}
+
+func saveWatermarkConfig(wmConfig models.WatermarkConfig) error {
+	return saveSettingJSON("watermark_config", wmConfig)
+}
+
+// saveSettingJSON 以 JSON 形式保存设置项，不存在时创建
+func saveSettingJSON(key string, value any) error {
+	configJson, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	db := database.GetDB().DB
+	var setting models.Settings
+	err = db.Where("`key` = ?", key).First(&setting).Error
+	if err == gorm.ErrRecordNotFound {
+		setting = models.Settings{
+			Key:       key,
+			Value:     string(configJson),
+			CreatedAt: time.Now(),
+			UpdatedAt: time.Now(),
+		}
+		return db.Create(&setting).Error
+	} else if err != nil {
+		return err
+	}
+	setting.Value = string(configJson)
+	setting.UpdatedAt = time.Now()
+	return db.Save(&setting).Error
+}
+
+// isAnonymous 当前请求是否来自未登录访客
+func isAnonymous(c *gin.Context) bool {
+	return sessions.Default(c).Get("logged_in") != true
+}
+
+// serveWatermarkedUpload 仅对访客加水印时，为原图/预览图即时生成带水印版本；原图受水印保护时拒绝访客访问原始文件
+// 返回 false 表示无需加水印，由调用方按原文件返回
+func serveWatermarkedUpload(c *gin.Context, fileKey string) bool {
+	wm := services.CurrentWatermark()
+	// 保留的原始文件不含水印，原图受水印保护时不对访客提供（启用水印前上传的原始文件仍在公开目录下）
+	if derivedSuffixOf(fileKey) == "source" && wm.CoversOriginal() {
+		c.Header("Vary", strings.TrimPrefix(c.Writer.Header().Get("Vary")+", Cookie", ", "))
+		c.Header("Cache-Control", "private, max-age=3600")
+		if isAnonymous(c) {
+			c.JSON(http.StatusForbidden, gin.H{"code": 403, "msg": "Forbidden"})
+			return true
+		}
+		return false
+	}
+	if wm == nil || !wm.Config.AnonymousOnly {
+		return false
+	}
+
+	anonymous := isAnonymous(c)
+	var watermarked bool
+	switch derivedSuffixOf(fileKey) {
+	case services.PresetThumb, "source":
+		return false
+	case "":
+		// SVG 原图无法写入位图水印，按原文件返回（其预览图为位图，照常处理）
+		if strings.HasSuffix(strings.ToLower(fileKey), ".svg") || !wm.Config.ApplyOriginal {
+			return false
+		}
+		watermarked = wm.ServeOriginal(anonymous)
+	default:
+		// 预览图与自定义预设
+		if !wm.Config.ApplyPreview {
+			return false
+		}
+		watermarked = wm.ServePreview(anonymous)
+	}
+	// 同一地址对访客与登录用户返回不同内容，登录用户的无水印版本同样不能由共享缓存保存
+	c.Header("Vary", strings.TrimPrefix(c.Writer.Header().Get("Vary")+", Cookie", ", "))
+	c.Header("Cache-Control", "private, max-age=3600")
+	if !watermarked {
+		return false
+	}
+
+	// 带水印版本缓存在 0 号目录下，按水印版本区分
+	cacheName := "wm" + wm.Version + "_" + strings.ReplaceAll(fileKey, "/", "_")
+	data, ok := services.Variants.Get(0, cacheName)
+	if ok {
+		// 原文件已删除时不再返回缓存
+		if _, err := storage.GetStorage().Stat(fileKey); err != nil {
+			ok = false
+			data = nil
+		}
+	}
+	if !ok {
+		original, err := readStorageObject(fileKey)
+		if err != nil {
+			if err == storage.ErrNotExist {
+				c.JSON(http.StatusNotFound, gin.H{"code": 404, "msg": "文件不存在"})
+			} else {
+				c.JSON(http.StatusInternalServerError, gin.H{"code": 500, "msg": "读取文件失败"})
+			}
+			return true
+		}
+		transformSemaphore <- struct{}{}
+		data, err = services.NewImageService().WatermarkBytes(original, wm)
+		<-transformSemaphore
+		if err != nil {
+			// 无法解码的文件（如动图）原样返回
+			fmt.Printf("添加水印失败: %s, %v\n", fileKey, err)
+			data = original
+		}
+		if err := services.Variants.Put(0, cacheName, data); err != nil {
+			fmt.Printf("写入水印缓存失败: %v\n", err)
+		}
+	}
+
+	head := data[:min(len(data), 512)]
+	c.Data(http.StatusOK, sniffImageType(head, storage.ContentTypeByKey(fileKey)), data)
+	return true
+}
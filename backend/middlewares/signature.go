@@ -0,0 +1,45 @@
+package middlewares
+
+import (
+	"net/http"
+	"time"
+
+	"oneimg/backend/config"
+	"oneimg/backend/services"
+
+	"github.com/gin-contrib/sessions"
+	"github.com/gin-gonic/gin"
+)
+
+// SignedURLMiddleware 签名URL校验中间件
+// 携带 sig 参数的请求总会被校验；required 为 true 时未签名的请求只允许已登录用户访问
+// 校验通过后在上下文中设置 signed_url，供后续处理放宽限制（如变换尺寸白名单）
+func SignedURLMiddleware(cfg *config.Config, required bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Query("sig") == "" {
+			loggedIn := sessions.Default(c).Get("logged_in")
+			if !required || loggedIn == true {
+				c.Next()
+				return
+			}
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"code": 403, "msg": "缺少签名"})
+			return
+		}
+
+		err := services.VerifySignedURL(cfg.SignKey, c.Request.URL.Path, c.Request.URL.Query(), time.Now())
+		if err != nil {
+			msg := "签名无效"
+			switch err {
+			case services.ErrSignatureExpired:
+				msg = "链接已过期"
+			case services.ErrSigningDisabled:
+				msg = "URL 签名未启用"
+			}
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"code": 403, "msg": msg})
+			return
+		}
+
+		c.Set("signed_url", true)
+		c.Next()
+	}
+}
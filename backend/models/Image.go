@@ -17,4 +17,24 @@ type Image struct {
 	Tags      string    `json:"tags" gorm:"type:text"`         // 新增标签字段 (JSON array or comma-separated)
     // ---------------------------------------------------
 	CreatedAt time.Time `json:"created_at" gorm:"index"`
+
+	// 上传文件的原始格式，heic/tiff/bmp 等会转换为 jpeg/webp 后保存
+	SourceFormat string `json:"source_format" gorm:"size:20"`
+	// 保留的原始文件地址，未保留时为空
+	SourceUrl string `json:"source_url"`
+
+	// 感知哈希 (dHash, 16 位十六进制)，用于查找缩放、重新压缩后的相似图片
+	PHash string `json:"phash" gorm:"column:phash;size:16;index"`
+
+	// 前端占位图：BlurHash 与主色调（#rrggbb，逗号分隔，按占比从高到低）
+	BlurHash string `json:"blurhash" gorm:"size:64"`
+	Palette  string `json:"palette" gorm:"size:64"`
+
+	// 主色调的 CIELAB 值，用于按颜色搜索
+	LabL *float64 `json:"-" gorm:"column:lab_l;index"`
+	LabA *float64 `json:"-" gorm:"column:lab_a"`
+	LabB *float64 `json:"-" gorm:"column:lab_b"`
+
+	// EXIF 元数据，仅详情接口加载
+	Metadata *ImageMetadata `json:"metadata,omitempty" gorm:"foreignKey:ImageId"`
 }
\ No newline at end of file
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+)
+
+// ImageMetadata 图片 EXIF 元数据，与 Image 一对一
+type ImageMetadata struct {
+	ID           uint       `gorm:"primarykey" json:"id"`
+	ImageId      int        `gorm:"uniqueIndex" json:"image_id"`
+	Make         string     `gorm:"size:100" json:"make"`         // 相机厂商
+	Model        string     `gorm:"size:100" json:"model"`        // 相机型号
+	LensModel    string     `gorm:"size:100" json:"lens_model"`   // 镜头型号
+	TakenAt      *time.Time `gorm:"index" json:"taken_at"`        // 拍摄时间
+	ExposureTime string     `gorm:"size:20" json:"exposure_time"` // 快门速度，如 1/125
+	FNumber      float64    `json:"f_number"`                     // 光圈
+	ISO          int        `json:"iso"`                          // 感光度
+	FocalLength  float64    `json:"focal_length"`                 // 焦距 (mm)
+	Latitude     *float64   `json:"latitude"`                     // GPS 纬度
+	Longitude    *float64   `json:"longitude"`                    // GPS 经度
+	Orientation  int        `json:"orientation"`                  // EXIF 方向 1~8
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// TableName 指定表名
+func (ImageMetadata) TableName() string {
+	return "image_metadata"
+}
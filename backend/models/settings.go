@@ -17,3 +17,34 @@ type AIConfig struct {
 	ApiKey string `json:"api_key"`
 	Model  string `json:"model"`
 }
+
+// WatermarkConfig 水印配置结构体 (用于JSON序列化存储在Settings中)
+type WatermarkConfig struct {
+	Enabled  bool    `json:"enabled"`
+	Type     string  `json:"type"`      // text: 文字水印; image: PNG 图片水印
+	Text     string  `json:"text"`      // 文字内容
+	FontPath string  `json:"font_path"` // 服务器上的 TTF/OTF 字体路径，为空时使用内置字体（不含中文字形）
+	Color    string  `json:"color"`     // 文字颜色 #RRGGBB
+	ImageKey string  `json:"image_key"` // PNG 水印在存储中的 key，由上传接口写入
+	Position string  `json:"position"`  // top-left/top/top-right/left/center/right/bottom-left/bottom/bottom-right
+	Opacity  float64 `json:"opacity"`   // 不透明度 0~1
+	Scale    float64 `json:"scale"`     // 水印宽度占图片宽度的比例 0~1
+	Margin   float64 `json:"margin"`    // 边距占图片短边的比例
+	Tile     bool    `json:"tile"`      // 平铺整张图片
+
+	ApplyOriginal bool `json:"apply_original"` // 作用于原图
+	ApplyPreview  bool `json:"apply_preview"`  // 作用于预览图及按需生成的衍生图
+	AnonymousOnly bool `json:"anonymous_only"` // 仅对未登录访客返回的图片添加（访问时生成，存储的文件不含水印）
+}
+
+// ImagePreset 衍生图预设 (用于JSON序列化存储在Settings中)
+// 上传时为每个预设生成 name_{preset}.ext，thumb 与 preview 为内置预设
+type ImagePreset struct {
+	Name    string `json:"name"`    // 小写字母、数字与连字符
+	Width   int    `json:"width"`   // 目标宽度
+	Height  int    `json:"height"`  // 目标高度
+	Fit     string `json:"fit"`     // contain: 等比缩放至框内; cover: 裁剪填满; fill: 拉伸
+	Crop    string `json:"crop"`    // cover 的裁剪方式: center / smart
+	Format  string `json:"format"`  // webp / avif / jpeg / png
+	Quality int    `json:"quality"` // 1~100，为 0 时使用该格式的默认质量
+}
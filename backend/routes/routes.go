@@ -30,9 +30,9 @@ func SetupRoutes() *gin.Engine {
 	// 跨域配置
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"*"},
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "HEAD", "DELETE", "OPTIONS"},
 		AllowHeaders:     []string{"*"},
-		ExposeHeaders:    []string{"Content-Length"},
+		ExposeHeaders:    []string{"Content-Length", "Location", "Upload-Offset", "Upload-Length", "Upload-Metadata", "Upload-Expires", "Tus-Resumable", "Tus-Version", "Tus-Extension", "Tus-Max-Size"},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}))
@@ -42,8 +42,16 @@ func SetupRoutes() *gin.Engine {
 	// 对uploads目录启用防盗链保护
 	uploadsGroup := r.Group("/uploads")
 	uploadsGroup.Use(middlewares.HotlinkProtectionMiddleware())
-	uploadsGroup.Static("/", cfg.UploadPath)
-	
+	uploadsGroup.Use(middlewares.SignedURLMiddleware(cfg, cfg.SignUploads))
+	uploadsGroup.GET("/*filepath", controllers.ServeUpload)
+	uploadsGroup.HEAD("/*filepath", controllers.ServeUpload)
+
+	// 按需变换图片 (缩放/裁剪/格式转换)
+	imgGroup := r.Group("/img")
+	imgGroup.Use(middlewares.SignedURLMiddleware(cfg, cfg.SignTransforms))
+	imgGroup.GET("/:id", controllers.TransformImage)
+	imgGroup.GET("/:id/*opts", controllers.TransformImage)
+
 	r.Static("/assets", "./frontend/dist/assets")
 	r.StaticFile("/favicon.ico", "./frontend/dist/favicon.ico")
 	r.StaticFile("/logo.png", "./frontend/dist/logo.png")
@@ -56,6 +64,8 @@ func SetupRoutes() *gin.Engine {
 		api.POST("/logout", controllers.Logout)
 		api.GET("/logout", controllers.Logout)
 		api.GET("/user/status", controllers.CheckLoginStatus)
+		// tus 协议发现（返回支持的版本与扩展）
+		api.OPTIONS("/upload/tus", controllers.TusOptions)
 
 		// GitHub 认证接口（公开）
 		authGroup := api.Group("/auth")
@@ -70,6 +80,7 @@ func SetupRoutes() *gin.Engine {
 		{
 			optional.GET("/images", controllers.GetImageList)
 			optional.GET("/images/:id", controllers.GetImageDetail)
+			optional.GET("/images/:id/similar", controllers.GetSimilarImages)
 		}
 
 		// 需要认证的接口分组（应用AuthMiddleware）
@@ -85,6 +96,10 @@ func SetupRoutes() *gin.Engine {
 			auth.POST("/account/change", controllers.ChangeAccountInfo)
 			auth.POST("/sessions/clear", controllers.ClearAllSessions)
 
+			// 以图搜图
+			auth.POST("/search/by-image", controllers.SearchByImage)
+			auth.GET("/images/:id/embed", controllers.GetImageEmbed)
+
 			// 管理员接口分组
 			admin := auth.Group("")
 			admin.Use(middlewares.AdminMiddleware())
@@ -92,18 +107,45 @@ func SetupRoutes() *gin.Engine {
 				// 图片相关接口 (上传、删除)
 				admin.POST("/upload", controllers.UploadImage)
 				admin.POST("/upload/images", controllers.UploadImages)
+				admin.POST("/upload/url", controllers.UploadFromURL)
+				admin.POST("/upload/base64", controllers.UploadBase64)
+				// tus 1.0 可续传上传
+				admin.POST("/upload/tus", controllers.TusCreate)
+				admin.HEAD("/upload/tus/:id", controllers.TusHead)
+				admin.PATCH("/upload/tus/:id", controllers.TusPatch)
+				admin.DELETE("/upload/tus/:id", controllers.TusDelete)
+				admin.GET("/upload/tus/:id", controllers.TusResult)
+
+				// 压缩包批量导入
+				admin.POST("/import/archive", controllers.ImportArchive)
+				admin.GET("/import/jobs", controllers.GetImportJobs)
+				admin.GET("/import/jobs/:id", controllers.GetImportJob)
 				admin.DELETE("/images/:id", controllers.DeleteImage)
+				admin.POST("/images/:id/signed-url", controllers.CreateSignedURL)
 
 				// AI 设置
 				admin.GET("/settings/ai", controllers.GetAISettings)
 				admin.POST("/settings/ai", controllers.SaveAISettings)
 				admin.GET("/ai/models", controllers.GetAIModels)
 
+				// 水印设置
+				admin.GET("/settings/watermark", controllers.GetWatermarkSettings)
+				admin.POST("/settings/watermark", controllers.SaveWatermarkSettings)
+				admin.POST("/settings/watermark/image", controllers.UploadWatermarkImage)
+				admin.GET("/settings/presets", controllers.GetPresetSettings)
+				admin.POST("/settings/presets", controllers.SavePresetSettings)
+				admin.POST("/presets/regenerate", controllers.RegeneratePresets)
+				admin.GET("/presets/progress", controllers.GetPresetProgress)
+
 				// AI 任务
 				admin.POST("/batch-tag", controllers.BatchTagImages)
 				admin.GET("/ai/progress", controllers.GetAIProgress)
 				// 图片去重
 				admin.POST("/deduplicate", controllers.BatchDeduplicate)
+				// 相似图片分组（感知哈希）
+				admin.GET("/duplicates/similar", controllers.GetNearDuplicateClusters)
+				admin.POST("/duplicates/phash", controllers.BackfillPerceptualHashes)
+				admin.GET("/duplicates/phash/progress", controllers.GetPHashProgress)
 			}
 		}
 	}
@@ -0,0 +1,471 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/draw"
+	"image/gif"
+	"time"
+
+	"oneimg/backend/models"
+
+	"github.com/chai2010/webp"
+	"github.com/disintegration/imaging"
+)
+
+// AnimationSettings 动图（GIF）处理配置
+type AnimationSettings struct {
+	Enabled      bool          // 为动图生成保留动画的缩略图与预览图
+	Format       string        // 动态缩略图/预览图格式: webp / gif
+	MaxFrames    int           // 帧数上限，超出时只取第一帧
+	MaxDuration  time.Duration // 总时长上限，超出时只取第一帧
+	MaxPixels    int64         // 帧数 × 画布像素上限，防止解压炸弹
+	StoreAsWebP  bool          // 较大的 GIF 主图转换为动态 WebP 保存
+	StoreMinSize int64         // 触发转换的最小文件大小（字节）
+	StoreQuality int           // 主图转换为动态 WebP 时的质量
+}
+
+var errAnimationLimit = errors.New("animation exceeds frame or duration limit")
+
+// gifInfo 不解码像素，仅扫描 GIF 数据块得到的帧数与总时长
+type gifInfo struct {
+	Width    int
+	Height   int
+	Frames   int
+	Duration time.Duration
+}
+
+// scanGIF 遍历 GIF 数据块统计帧数和时长，用于在 gif.DecodeAll 之前检查限制
+func scanGIF(data []byte) (gifInfo, error) {
+	var info gifInfo
+	if len(data) < 13 || (string(data[:6]) != "GIF87a" && string(data[:6]) != "GIF89a") {
+		return info, errors.New("not a gif file")
+	}
+	info.Width = int(binary.LittleEndian.Uint16(data[6:8]))
+	info.Height = int(binary.LittleEndian.Uint16(data[8:10]))
+
+	pos := 13
+	if data[10]&0x80 != 0 {
+		pos += 3 << ((data[10] & 0x07) + 1)
+	}
+
+	// skipSubBlocks 跳过以 0 结尾的数据子块序列
+	skipSubBlocks := func() error {
+		for {
+			if pos >= len(data) {
+				return errors.New("unexpected end of gif data")
+			}
+			size := int(data[pos])
+			pos++
+			if size == 0 {
+				return nil
+			}
+			pos += size
+		}
+	}
+
+	var delay int
+	for pos < len(data) {
+		switch data[pos] {
+		case 0x21: // 扩展块
+			if pos+2 > len(data) {
+				return info, errors.New("unexpected end of gif data")
+			}
+			// 图形控制扩展中记录帧延迟（单位 1/100 秒）
+			if data[pos+1] == 0xF9 && pos+7 < len(data) && data[pos+2] == 4 {
+				delay = int(binary.LittleEndian.Uint16(data[pos+4 : pos+6]))
+			}
+			pos += 2
+			if err := skipSubBlocks(); err != nil {
+				return info, err
+			}
+		case 0x2C: // 图像描述符
+			if pos+10 > len(data) {
+				return info, errors.New("unexpected end of gif data")
+			}
+			packed := data[pos+9]
+			pos += 10
+			if packed&0x80 != 0 {
+				pos += 3 << ((packed & 0x07) + 1)
+			}
+			pos++ // LZW 最小码长
+			if err := skipSubBlocks(); err != nil {
+				return info, err
+			}
+			info.Frames++
+			info.Duration += gifFrameDuration(delay)
+			delay = 0
+		case 0x3B: // 结束符
+			return info, nil
+		default:
+			return info, fmt.Errorf("invalid gif block: 0x%02x", data[pos])
+		}
+	}
+	return info, nil
+}
+
+// gifFrameDuration 帧延迟换算为时长，与浏览器一致地把过小的延迟按 100ms 处理
+func gifFrameDuration(delay int) time.Duration {
+	if delay < 2 {
+		delay = 10
+	}
+	return time.Duration(delay) * 10 * time.Millisecond
+}
+
+// animationEncoder 逐帧编码动图，避免同时持有所有全尺寸帧
+type animationEncoder interface {
+	// AddFrame 追加一帧，pal 为源帧调色板，供 GIF 输出量化使用
+	AddFrame(img image.Image, duration time.Duration, pal color.Palette) error
+	// Encode 输出完整文件，loopCount 为 0 表示无限循环
+	Encode(loopCount int) ([]byte, error)
+}
+
+// newAnimationEncoder 按格式创建编码器
+func newAnimationEncoder(format string, quality int) (animationEncoder, error) {
+	switch format {
+	case "webp":
+		return &webpAnimationEncoder{quality: quality}, nil
+	case "gif":
+		return &gifAnimationEncoder{}, nil
+	}
+	return nil, fmt.Errorf("unsupported animation format: %s", format)
+}
+
+// webpAnimationEncoder 将每帧编码为静态 WebP 后封装为 ANMF 块
+type webpAnimationEncoder struct {
+	quality  int
+	width    int
+	height   int
+	hasAlpha bool
+	frames   bytes.Buffer
+}
+
+func (e *webpAnimationEncoder) AddFrame(img image.Image, duration time.Duration, _ color.Palette) error {
+	data, err := webp.EncodeRGBA(img, float32(e.quality))
+	if err != nil {
+		return fmt.Errorf("failed to encode webp frame: %v", err)
+	}
+	chunks, hasAlpha, err := webpImageChunks(data)
+	if err != nil {
+		return err
+	}
+
+	bounds := img.Bounds()
+	if e.width == 0 {
+		e.width, e.height = bounds.Dx(), bounds.Dy()
+	}
+	e.hasAlpha = e.hasAlpha || hasAlpha
+
+	// ANMF 头: X/2, Y/2, 宽-1, 高-1, 时长(ms) 各 24 位，标志位 0x02 表示不与前一帧混合
+	header := make([]byte, 16)
+	putUint24(header[0:], 0)
+	putUint24(header[3:], 0)
+	putUint24(header[6:], bounds.Dx()-1)
+	putUint24(header[9:], bounds.Dy()-1)
+	putUint24(header[12:], min(int(duration/time.Millisecond), 1<<24-1))
+	header[15] = 0x02
+	writeRIFFChunk(&e.frames, "ANMF", append(header, chunks...))
+	return nil
+}
+
+func (e *webpAnimationEncoder) Encode(loopCount int) ([]byte, error) {
+	if e.frames.Len() == 0 {
+		return nil, errors.New("animation has no frames")
+	}
+
+	var body bytes.Buffer
+	body.WriteString("WEBP")
+
+	vp8x := make([]byte, 10)
+	vp8x[0] = 0x02 // 动画
+	if e.hasAlpha {
+		vp8x[0] |= 0x10
+	}
+	putUint24(vp8x[4:], e.width-1)
+	putUint24(vp8x[7:], e.height-1)
+	writeRIFFChunk(&body, "VP8X", vp8x)
+
+	// ANIM: 背景色 (BGRA) + 循环次数
+	anim := make([]byte, 6)
+	binary.LittleEndian.PutUint16(anim[4:], uint16(loopCount))
+	writeRIFFChunk(&body, "ANIM", anim)
+
+	body.Write(e.frames.Bytes())
+
+	var out bytes.Buffer
+	out.WriteString("RIFF")
+	binary.Write(&out, binary.LittleEndian, uint32(body.Len()))
+	out.Write(body.Bytes())
+	return out.Bytes(), nil
+}
+
+// webpImageChunks 从静态 WebP 中取出图像数据块 (ALPH/VP8/VP8L)，原样用于 ANMF 帧
+func webpImageChunks(data []byte) ([]byte, bool, error) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, false, errors.New("invalid webp data")
+	}
+	var chunks []byte
+	hasAlpha := false
+	for pos := 12; pos+8 <= len(data); {
+		fourCC := string(data[pos : pos+4])
+		size := int(binary.LittleEndian.Uint32(data[pos+4 : pos+8]))
+		end := pos + 8 + size + size&1
+		if end > len(data) {
+			end = len(data)
+		}
+		switch fourCC {
+		case "ALPH", "VP8L":
+			hasAlpha = true
+			chunks = append(chunks, data[pos:end]...)
+		case "VP8 ":
+			chunks = append(chunks, data[pos:end]...)
+		}
+		pos = end
+	}
+	if len(chunks) == 0 {
+		return nil, false, errors.New("webp data has no image chunk")
+	}
+	return chunks, hasAlpha, nil
+}
+
+// decodeWebPFirstFrame 解码动态 WebP 的第一帧，按帧偏移绘制到画布上
+// libwebp 的静态解码接口不支持动画，将帧数据重新封装为静态 WebP 后解码
+func decodeWebPFirstFrame(data []byte) (image.Image, error) {
+	var canvasWidth, canvasHeight int
+	var frame []byte
+	walkWebPChunks(data, func(fourCC string, payload []byte) {
+		switch {
+		case fourCC == "VP8X" && len(payload) >= 10:
+			canvasWidth, canvasHeight = uint24(payload[4:])+1, uint24(payload[7:])+1
+		case fourCC == "ANMF" && frame == nil && len(payload) > 16:
+			frame = payload
+		}
+	})
+	if frame == nil || canvasWidth == 0 {
+		return nil, errors.New("webp has no animation frame")
+	}
+	if output.Animation.MaxPixels > 0 && int64(canvasWidth)*int64(canvasHeight) > output.Animation.MaxPixels {
+		return nil, errAnimationLimit
+	}
+
+	x, y := uint24(frame[0:])*2, uint24(frame[3:])*2
+	width, height := uint24(frame[6:])+1, uint24(frame[9:])+1
+	chunks := frame[16:]
+
+	// 带 ALPH 块的有损帧需要 VP8X 头才能解码
+	var body bytes.Buffer
+	body.WriteString("WEBP")
+	if bytes.HasPrefix(chunks, []byte("ALPH")) {
+		vp8x := make([]byte, 10)
+		vp8x[0] = 0x10
+		putUint24(vp8x[4:], width-1)
+		putUint24(vp8x[7:], height-1)
+		writeRIFFChunk(&body, "VP8X", vp8x)
+	}
+	body.Write(chunks)
+	var still bytes.Buffer
+	still.WriteString("RIFF")
+	binary.Write(&still, binary.LittleEndian, uint32(body.Len()))
+	still.Write(body.Bytes())
+
+	img, err := webp.Decode(&still)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode webp frame: %v", err)
+	}
+	canvas := image.NewNRGBA(image.Rect(0, 0, canvasWidth, canvasHeight))
+	draw.Draw(canvas, image.Rect(x, y, x+width, y+height), img, img.Bounds().Min, draw.Src)
+	return canvas, nil
+}
+
+func uint24(b []byte) int {
+	return int(b[0]) | int(b[1])<<8 | int(b[2])<<16
+}
+
+func writeRIFFChunk(buf *bytes.Buffer, fourCC string, payload []byte) {
+	buf.WriteString(fourCC)
+	binary.Write(buf, binary.LittleEndian, uint32(len(payload)))
+	buf.Write(payload)
+	if len(payload)%2 == 1 {
+		buf.WriteByte(0)
+	}
+}
+
+func putUint24(b []byte, v int) {
+	b[0] = byte(v)
+	b[1] = byte(v >> 8)
+	b[2] = byte(v >> 16)
+}
+
+// gifAnimationEncoder 缩放后的帧按源调色板重新量化为 GIF
+type gifAnimationEncoder struct {
+	anim gif.GIF
+}
+
+func (e *gifAnimationEncoder) AddFrame(img image.Image, duration time.Duration, pal color.Palette) error {
+	if len(pal) == 0 {
+		pal = palette.Plan9
+	}
+	bounds := img.Bounds()
+	frame := image.NewPaletted(image.Rect(0, 0, bounds.Dx(), bounds.Dy()), pal)
+	draw.FloydSteinberg.Draw(frame, frame.Bounds(), img, bounds.Min)
+	e.anim.Image = append(e.anim.Image, frame)
+	e.anim.Delay = append(e.anim.Delay, int(duration/(10*time.Millisecond)))
+	e.anim.Disposal = append(e.anim.Disposal, gif.DisposalBackground)
+	return nil
+}
+
+func (e *gifAnimationEncoder) Encode(loopCount int) ([]byte, error) {
+	if len(e.anim.Image) == 0 {
+		return nil, errors.New("animation has no frames")
+	}
+	// gif.GIF 中 0 表示无限循环，n 表示额外重复 n 次，-1 表示只播放一次
+	switch loopCount {
+	case 0:
+		e.anim.LoopCount = 0
+	case 1:
+		e.anim.LoopCount = -1
+	default:
+		e.anim.LoopCount = loopCount - 1
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, &e.anim); err != nil {
+		return nil, fmt.Errorf("failed to encode gif: %v", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// animationTarget 一种动图输出：缩放框与编码器
+type animationTarget struct {
+	MaxWidth  int // 0 表示保持原尺寸
+	MaxHeight int
+	Crop      bool // 居中裁剪为固定尺寸（逐帧智能裁剪会导致画面跳动）
+	Encoder   animationEncoder
+}
+
+// isAnimatedGIF 判断是否为多帧 GIF
+func isAnimatedGIF(data []byte) bool {
+	info, err := scanGIF(data)
+	return err == nil && info.Frames > 1
+}
+
+// renderGIFAnimation 合成 GIF 各帧并逐帧写入各输出，返回播放次数（0 为无限循环）
+// 超出帧数、时长或像素限制时不解码像素，直接返回 errAnimationLimit
+func renderGIFAnimation(data []byte, limits AnimationSettings, targets []animationTarget) (int, error) {
+	info, err := scanGIF(data)
+	if err != nil {
+		return 0, err
+	}
+	if (limits.MaxFrames > 0 && info.Frames > limits.MaxFrames) ||
+		(limits.MaxDuration > 0 && info.Duration > limits.MaxDuration) ||
+		(limits.MaxPixels > 0 && int64(info.Frames)*int64(info.Width)*int64(info.Height) > limits.MaxPixels) {
+		return 0, errAnimationLimit
+	}
+
+	anim, err := gif.DecodeAll(bytes.NewReader(data))
+	if err != nil {
+		return 0, fmt.Errorf("failed to decode gif: %v", err)
+	}
+
+	canvasRect := image.Rect(0, 0, anim.Config.Width, anim.Config.Height)
+	canvas := image.NewNRGBA(canvasRect)
+	for i, frame := range anim.Image {
+		disposal := byte(0)
+		if i < len(anim.Disposal) {
+			disposal = anim.Disposal[i]
+		}
+		var previous *image.NRGBA
+		if disposal == gif.DisposalPrevious {
+			previous = imaging.Clone(canvas)
+		}
+
+		draw.Draw(canvas, frame.Bounds(), frame, frame.Bounds().Min, draw.Over)
+
+		delay := 0
+		if i < len(anim.Delay) {
+			delay = anim.Delay[i]
+		}
+		for _, target := range targets {
+			var img image.Image = canvas
+			if target.MaxWidth > 0 && target.MaxHeight > 0 {
+				if target.Crop {
+					img = fillImage(canvas, target.MaxWidth, target.MaxHeight, CropCenter)
+				} else {
+					img = imaging.Fit(canvas, target.MaxWidth, target.MaxHeight, imaging.Linear)
+				}
+			}
+			if err := target.Encoder.AddFrame(img, gifFrameDuration(delay), frame.Palette); err != nil {
+				return 0, err
+			}
+		}
+
+		switch disposal {
+		case gif.DisposalBackground:
+			draw.Draw(canvas, frame.Bounds(), image.Transparent, image.Point{}, draw.Src)
+		case gif.DisposalPrevious:
+			canvas = previous
+		}
+	}
+
+	// gif.GIF 中 0 表示无限循环，-1 表示只播放一次，n 表示额外重复 n 次
+	switch {
+	case anim.LoopCount == 0:
+		return 0, nil
+	case anim.LoopCount < 0:
+		return 1, nil
+	default:
+		return anim.LoopCount + 1, nil
+	}
+}
+
+// animatedRenditions 动图的缩略图、预览图，以及可选的动态 WebP 主图
+type animatedRenditions struct {
+	Thumbnail []byte
+	Preview   []byte
+	MimeType  string // 缩略图与预览图的 MIME 类型
+	Stored    []byte // 为空表示主图保持原 GIF
+}
+
+// processAnimatedGIF 一次解码同时生成动态缩略图、预览图和动态 WebP 主图，尺寸取自预设
+func (s *ImageService) processAnimatedGIF(data []byte, thumb, preview models.ImagePreset) (*animatedRenditions, error) {
+	settings := output.Animation
+	thumbEncoder, err := newAnimationEncoder(settings.Format, qualityFor(output.ThumbnailQuality, settings.Format))
+	if err != nil {
+		return nil, err
+	}
+	previewEncoder, _ := newAnimationEncoder(settings.Format, qualityFor(output.PreviewQuality, settings.Format))
+	targets := []animationTarget{
+		{MaxWidth: thumb.Width, MaxHeight: thumb.Height, Crop: thumb.Fit == "cover", Encoder: thumbEncoder},
+		{MaxWidth: preview.Width, MaxHeight: preview.Height, Crop: preview.Fit == "cover", Encoder: previewEncoder},
+	}
+
+	var storeEncoder animationEncoder
+	if settings.StoreAsWebP && int64(len(data)) >= settings.StoreMinSize {
+		storeEncoder = &webpAnimationEncoder{quality: settings.StoreQuality}
+		targets = append(targets, animationTarget{Encoder: storeEncoder})
+	}
+
+	loopCount, err := renderGIFAnimation(data, settings, targets)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &animatedRenditions{MimeType: MimeTypeOf(settings.Format)}
+	if result.Thumbnail, err = thumbEncoder.Encode(loopCount); err != nil {
+		return nil, err
+	}
+	if result.Preview, err = previewEncoder.Encode(loopCount); err != nil {
+		return nil, err
+	}
+	if storeEncoder != nil {
+		// 转换结果不比原图小时保留原 GIF
+		if stored, err := storeEncoder.Encode(loopCount); err == nil && len(stored) < len(data) {
+			result.Stored = stored
+		}
+	}
+	return result, nil
+}
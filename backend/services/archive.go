@@ -0,0 +1,273 @@
+package services
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"slices"
+	"strings"
+)
+
+// 压缩包格式
+const (
+	ArchiveZip   = "zip"
+	ArchiveTar   = "tar"
+	ArchiveTarGz = "tar.gz"
+)
+
+// ErrArchiveLimit 压缩包超出条目数或解压总大小限制，导入中止
+var ErrArchiveLimit = errors.New("archive exceeds import limits")
+
+// 导入时处理的图片扩展名，其余文件跳过
+var archiveImageExts = []string{
+	".jpg", ".jpeg", ".png", ".gif", ".webp", ".bmp", ".tif", ".tiff",
+	".heic", ".heif", ".avif", ".svg",
+}
+
+// ArchiveLimits 解压限制，防止压缩炸弹
+// 条目大小按实际解压出的字节计算，不信任文件头中声明的大小
+type ArchiveLimits struct {
+	MaxEntries   int   // 图片条目数上限
+	MaxEntrySize int64 // 单个条目解压后的大小上限
+	MaxTotalSize int64 // 解压总大小上限
+}
+
+// ArchiveEntry 压缩包中的一张图片
+type ArchiveEntry struct {
+	Name string // 清理后的相对路径（/ 分隔）
+	Data []byte
+	Err  error // 条目本身不可用（如超出大小），不影响后续条目
+}
+
+// DetectArchiveFormat 按文件头识别压缩包格式，无法识别时返回空
+func DetectArchiveFormat(header []byte) string {
+	switch {
+	case bytes.HasPrefix(header, []byte("PK\x03\x04")), bytes.HasPrefix(header, []byte("PK\x05\x06")):
+		return ArchiveZip
+	case bytes.HasPrefix(header, []byte{0x1f, 0x8b}):
+		return ArchiveTarGz
+	case len(header) >= 262 && string(header[257:262]) == "ustar":
+		return ArchiveTar
+	}
+	return ""
+}
+
+// ArchiveFormatOf 识别压缩包文件的格式，无法识别时返回空
+func ArchiveFormatOf(filePath string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	return detectArchiveReader(file)
+}
+
+// detectArchiveReader 读取文件头识别格式，并将读取位置恢复到开头
+func detectArchiveReader(file io.ReadSeeker) (string, error) {
+	header := make([]byte, 512)
+	n, _ := io.ReadFull(file, header)
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return DetectArchiveFormat(header[:n]), nil
+}
+
+// CleanArchivePath 清理条目路径，拒绝绝对路径与跳出根目录的路径（zip slip）
+// 同时跳过隐藏文件与 macOS 生成的 __MACOSX 元数据
+func CleanArchivePath(name string) (string, bool) {
+	name = strings.ReplaceAll(name, "\\", "/")
+	if name == "" || strings.HasPrefix(name, "/") || (len(name) > 1 && name[1] == ':') {
+		return "", false
+	}
+	cleaned := path.Clean(name)
+	if cleaned == "." || cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", false
+	}
+	for _, part := range strings.Split(cleaned, "/") {
+		if strings.HasPrefix(part, ".") || part == "__MACOSX" {
+			return "", false
+		}
+	}
+	return cleaned, true
+}
+
+// isArchiveImage 按扩展名判断条目是否需要导入
+func isArchiveImage(name string) bool {
+	return slices.Contains(archiveImageExts, strings.ToLower(path.Ext(name)))
+}
+
+// CountArchiveImages 统计压缩包中需要导入的图片数量（用于显示进度）
+func CountArchiveImages(filePath string, limits ArchiveLimits) (int, error) {
+	count := 0
+	err := walkArchive(filePath, limits, false, func(ArchiveEntry) error {
+		count++
+		return nil
+	})
+	return count, err
+}
+
+// WalkArchive 逐个解压压缩包中的图片并回调，回调返回错误时停止
+// 超出条目数或解压总大小限制时返回 ErrArchiveLimit
+func WalkArchive(filePath string, limits ArchiveLimits, fn func(ArchiveEntry) error) error {
+	return walkArchive(filePath, limits, true, fn)
+}
+
+func walkArchive(filePath string, limits ArchiveLimits, readData bool, fn func(ArchiveEntry) error) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	format, err := detectArchiveReader(file)
+	if err != nil {
+		return err
+	}
+
+	walker := &archiveWalker{limits: limits, readData: readData, fn: fn}
+	switch format {
+	case ArchiveZip:
+		info, err := file.Stat()
+		if err != nil {
+			return err
+		}
+		return walker.walkZip(file, info.Size())
+	case ArchiveTarGz:
+		gz, err := gzip.NewReader(bufio.NewReader(file))
+		if err != nil {
+			return fmt.Errorf("invalid gzip: %v", err)
+		}
+		defer gz.Close()
+		return walker.walkTar(gz)
+	case ArchiveTar:
+		return walker.walkTar(file)
+	default:
+		return errors.New("unsupported archive format, expected zip, tar or tar.gz")
+	}
+}
+
+type archiveWalker struct {
+	limits   ArchiveLimits
+	readData bool
+	fn       func(ArchiveEntry) error
+
+	entries int
+	total   int64
+}
+
+// visit 检查条目数后读取数据并回调
+func (w *archiveWalker) visit(name string, r io.Reader) error {
+	w.entries++
+	if w.limits.MaxEntries > 0 && w.entries > w.limits.MaxEntries {
+		return fmt.Errorf("%w: more than %d images", ErrArchiveLimit, w.limits.MaxEntries)
+	}
+	if !w.readData {
+		return w.fn(ArchiveEntry{Name: name})
+	}
+
+	reader := r
+	if w.limits.MaxEntrySize > 0 {
+		reader = io.LimitReader(r, w.limits.MaxEntrySize+1)
+	}
+	data, err := io.ReadAll(reader)
+	w.total += int64(len(data))
+	if w.limits.MaxTotalSize > 0 && w.total > w.limits.MaxTotalSize {
+		return fmt.Errorf("%w: uncompressed size exceeds %d bytes", ErrArchiveLimit, w.limits.MaxTotalSize)
+	}
+	switch {
+	case errors.Is(err, ErrArchiveLimit):
+		return err
+	case err != nil:
+		return w.fn(ArchiveEntry{Name: name, Err: rejectUpload(RejectCorruptImage, "解压失败: %v", err)})
+	case w.limits.MaxEntrySize > 0 && int64(len(data)) > w.limits.MaxEntrySize:
+		return w.fn(ArchiveEntry{Name: name, Err: rejectUpload(RejectFileTooLarge, "文件大小超出限制 (最大 %d 字节)", w.limits.MaxEntrySize)})
+	}
+	return w.fn(ArchiveEntry{Name: name, Data: data})
+}
+
+func (w *archiveWalker) walkZip(r io.ReaderAt, size int64) error {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return fmt.Errorf("invalid zip: %v", err)
+	}
+	for _, f := range archive.File {
+		if !f.Mode().IsRegular() {
+			continue
+		}
+		name, ok := CleanArchivePath(f.Name)
+		if !ok || !isArchiveImage(name) {
+			continue
+		}
+		if !w.readData {
+			if err := w.visit(name, nil); err != nil {
+				return err
+			}
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			if err := w.fn(ArchiveEntry{Name: name, Err: rejectUpload(RejectCorruptImage, "解压失败: %v", err)}); err != nil {
+				return err
+			}
+			continue
+		}
+		err = w.visit(name, rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *archiveWalker) walkTar(r io.Reader) error {
+	// tar 中跳过的条目同样需要解压，按读取的总字节数限制
+	counter := &limitedCounter{r: r, limit: w.limits.MaxTotalSize}
+	archive := tar.NewReader(counter)
+	for {
+		hdr, err := archive.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			if errors.Is(err, ErrArchiveLimit) {
+				return err
+			}
+			return fmt.Errorf("invalid tar: %v", err)
+		}
+		// 只处理普通文件，符号链接、硬链接与设备文件一律跳过
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		name, ok := CleanArchivePath(hdr.Name)
+		if !ok || !isArchiveImage(name) {
+			continue
+		}
+		if err := w.visit(name, archive); err != nil {
+			return err
+		}
+	}
+}
+
+// limitedCounter 读取超过 limit 字节时返回 ErrArchiveLimit
+type limitedCounter struct {
+	r     io.Reader
+	n     int64
+	limit int64
+}
+
+func (c *limitedCounter) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	if c.limit > 0 && c.n > c.limit {
+		return n, fmt.Errorf("%w: uncompressed size exceeds %d bytes", ErrArchiveLimit, c.limit)
+	}
+	return n, err
+}
@@ -0,0 +1,96 @@
+//go:build avif && cgo
+
+package services
+
+/*
+#cgo pkg-config: libavif
+#include <stdlib.h>
+#include <string.h>
+#include <avif/avif.h>
+
+// encode_avif 将 8 位非预乘 RGBA 像素编码为 AVIF，成功时 out 由调用方 free
+static int encode_avif(uint8_t *pixels, uint32_t width, uint32_t height, uint32_t stride,
+                       int quality, int speed, uint8_t **out, size_t *out_size) {
+	avifImage *image = avifImageCreate(width, height, 8, AVIF_PIXEL_FORMAT_YUV420);
+	if (image == NULL) {
+		return AVIF_RESULT_OUT_OF_MEMORY;
+	}
+
+	avifRGBImage rgb;
+	avifRGBImageSetDefaults(&rgb, image);
+	rgb.format = AVIF_RGB_FORMAT_RGBA;
+	rgb.depth = 8;
+	rgb.pixels = pixels;
+	rgb.rowBytes = stride;
+
+	avifResult result = avifImageRGBToYUV(image, &rgb);
+	if (result != AVIF_RESULT_OK) {
+		avifImageDestroy(image);
+		return result;
+	}
+
+	avifEncoder *encoder = avifEncoderCreate();
+	if (encoder == NULL) {
+		avifImageDestroy(image);
+		return AVIF_RESULT_OUT_OF_MEMORY;
+	}
+	encoder->quality = quality;
+	encoder->qualityAlpha = quality;
+	encoder->speed = speed;
+
+	avifRWData output = AVIF_DATA_EMPTY;
+	result = avifEncoderWrite(encoder, image, &output);
+	avifEncoderDestroy(encoder);
+	avifImageDestroy(image);
+	if (result != AVIF_RESULT_OK) {
+		avifRWDataFree(&output);
+		return result;
+	}
+
+	*out = malloc(output.size);
+	if (*out == NULL) {
+		avifRWDataFree(&output);
+		return AVIF_RESULT_OUT_OF_MEMORY;
+	}
+	memcpy(*out, output.data, output.size);
+	*out_size = output.size;
+	avifRWDataFree(&output);
+	return AVIF_RESULT_OK;
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"image"
+	"unsafe"
+
+	"github.com/disintegration/imaging"
+)
+
+// avifSupported 使用 -tags avif 构建并链接 libavif (>= 1.0) 时启用 AVIF 编码
+const avifSupported = true
+
+// encodeAVIF 通过 libavif 编码 AVIF，speed 取值 0(最慢/最小)~10(最快)
+func encodeAVIF(img image.Image, quality, speed int) ([]byte, error) {
+	nrgba := imaging.Clone(img)
+	bounds := nrgba.Bounds()
+	if bounds.Dx() == 0 || bounds.Dy() == 0 {
+		return nil, fmt.Errorf("failed to encode avif: empty image")
+	}
+
+	// 像素复制到 C 内存，避免向 C 传递 Go 指针
+	pixels := C.CBytes(nrgba.Pix)
+	defer C.free(pixels)
+
+	var out *C.uint8_t
+	var outSize C.size_t
+	result := C.encode_avif((*C.uint8_t)(pixels), C.uint32_t(bounds.Dx()), C.uint32_t(bounds.Dy()),
+		C.uint32_t(nrgba.Stride), C.int(quality), C.int(speed), &out, &outSize)
+	if result != C.AVIF_RESULT_OK {
+		return nil, fmt.Errorf("failed to encode avif: %s", C.GoString(C.avifResultToString(C.avifResult(result))))
+	}
+	defer C.free(unsafe.Pointer(out))
+
+	return C.GoBytes(unsafe.Pointer(out), C.int(outSize)), nil
+}
@@ -0,0 +1,14 @@
+//go:build !avif || !cgo
+
+package services
+
+import (
+	"image"
+)
+
+// avifSupported 默认构建不包含 AVIF 编码器，使用 -tags avif 并安装 libavif 后启用
+const avifSupported = false
+
+func encodeAVIF(img image.Image, quality, speed int) ([]byte, error) {
+	return nil, errAVIFUnsupported
+}
@@ -0,0 +1,89 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Lab CIELAB 颜色 (D65)，欧氏距离 ΔE 接近人眼感知的色差
+type Lab struct {
+	L, A, B float64
+}
+
+// namedColors 按颜色名搜索时使用的代表色
+// 取各色系中常见的中等饱和度色调，而不是纯色，更贴近照片与壁纸的实际主色
+var namedColors = map[string]string{
+	"red":    "#d03030",
+	"orange": "#f08c28",
+	"yellow": "#f0d23c",
+	"green":  "#3ca046",
+	"cyan":   "#3cbed2",
+	"blue":   "#3264c8",
+	"purple": "#7846b4",
+	"pink":   "#f08cb4",
+	"brown":  "#8c5a32",
+	"black":  "#141414",
+	"white":  "#f5f5f5",
+	"gray":   "#808080",
+	"grey":   "#808080",
+	"红":      "#d03030",
+	"橙":      "#f08c28",
+	"黄":      "#f0d23c",
+	"绿":      "#3ca046",
+	"青":      "#3cbed2",
+	"蓝":      "#3264c8",
+	"紫":      "#7846b4",
+	"粉":      "#f08cb4",
+	"棕":      "#8c5a32",
+	"黑":      "#141414",
+	"白":      "#f5f5f5",
+	"灰":      "#808080",
+}
+
+// ParseColor 解析颜色名或十六进制颜色 (#rgb / #rrggbb，# 可省略)
+func ParseColor(s string) (r, g, b uint8, err error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if hex, ok := namedColors[strings.TrimSuffix(s, "色")]; ok {
+		s = hex
+	}
+	s = strings.TrimPrefix(s, "#")
+	if len(s) == 3 {
+		s = string([]byte{s[0], s[0], s[1], s[1], s[2], s[2]})
+	}
+	if len(s) != 6 {
+		return 0, 0, 0, fmt.Errorf("invalid color: %q", s)
+	}
+	v, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("invalid color: %q", s)
+	}
+	return uint8(v >> 16), uint8(v >> 8), uint8(v), nil
+}
+
+// ParseColorLab 解析颜色并转换为 CIELAB
+func ParseColorLab(s string) (Lab, error) {
+	r, g, b, err := ParseColor(s)
+	if err != nil {
+		return Lab{}, err
+	}
+	return RGBToLab(r, g, b), nil
+}
+
+// RGBToLab sRGB 转 CIELAB (D65 白点)
+func RGBToLab(r, g, b uint8) Lab {
+	lr, lg, lb := sRGBToLinear(int(r)), sRGBToLinear(int(g)), sRGBToLinear(int(b))
+	x := (0.4124564*lr + 0.3575761*lg + 0.1804375*lb) / 0.95047
+	y := 0.2126729*lr + 0.7151522*lg + 0.0721750*lb
+	z := (0.0193339*lr + 0.1191920*lg + 0.9503041*lb) / 1.08883
+
+	f := func(t float64) float64 {
+		if t > 216.0/24389 {
+			return math.Cbrt(t)
+		}
+		return (24389.0/27*t + 16) / 116
+	}
+	fx, fy, fz := f(x), f(y), f(z)
+	return Lab{L: 116*fy - 16, A: 500 * (fx - fy), B: 200 * (fy - fz)}
+}
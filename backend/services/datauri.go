@@ -0,0 +1,57 @@
+package services
+
+import (
+	"encoding/base64"
+	"strings"
+)
+
+// 上传数据不是合法的 base64 或 data URI
+const RejectInvalidData = "invalid_data"
+
+// DecodeBase64Image 解码纯 base64 或 data:image/...;base64, 形式的图片数据
+// 解码前按编码长度估算大小，超出 maxSize 时不分配内存直接拒绝；返回 data URI 声明的 MIME 类型（可能为空）
+// 声明的类型只作参考，真实类型仍由 CheckUpload 按文件头识别
+func DecodeBase64Image(payload string, maxSize int64) ([]byte, string, error) {
+	payload = strings.TrimSpace(payload)
+	declaredType := ""
+	if len(payload) >= 5 && strings.EqualFold(payload[:5], "data:") {
+		header, encoded, ok := strings.Cut(payload[5:], ",")
+		if !ok {
+			return nil, "", rejectUpload(RejectInvalidData, "无效的 data URI")
+		}
+		params := strings.Split(header, ";")
+		if !strings.EqualFold(params[len(params)-1], "base64") {
+			return nil, "", rejectUpload(RejectInvalidData, "data URI 必须使用 base64 编码")
+		}
+		declaredType = strings.ToLower(strings.TrimSpace(params[0]))
+		if declaredType != "" && !strings.HasPrefix(declaredType, "image/") {
+			return nil, "", rejectUpload(RejectUnsupportedType, "不支持的文件类型: %s", declaredType)
+		}
+		payload = encoded
+	}
+
+	// 允许编码中夹带换行等空白
+	payload = strings.Map(func(r rune) rune {
+		if r == ' ' || r == '\t' || r == '\r' || r == '\n' {
+			return -1
+		}
+		return r
+	}, payload)
+	if payload == "" {
+		return nil, "", rejectUpload(RejectInvalidData, "图片数据为空")
+	}
+	if maxSize > 0 && int64(base64.RawStdEncoding.DecodedLen(len(strings.TrimRight(payload, "=")))) > maxSize {
+		return nil, "", rejectUpload(RejectFileTooLarge, "文件大小超出限制 (最大 %d 字节)", maxSize)
+	}
+
+	// 兼容标准与 URL 安全字母表，填充可省略
+	encoding := base64.RawStdEncoding
+	if strings.ContainsAny(payload, "-_") {
+		encoding = base64.RawURLEncoding
+	}
+	data, err := encoding.DecodeString(strings.TrimRight(payload, "="))
+	if err != nil {
+		return nil, "", rejectUpload(RejectInvalidData, "无效的 base64 数据")
+	}
+	return data, declaredType, nil
+}
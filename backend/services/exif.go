@@ -0,0 +1,529 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"math/big"
+	"time"
+
+	"github.com/disintegration/imaging"
+	"github.com/rwcarlsen/goexif/exif"
+)
+
+// EXIF 隐私处理模式
+const (
+	StripExifNone = "none" // 原样保留
+	StripExifGPS  = "gps"  // 清除 GPS 信息
+	StripExifAll  = "all"  // 清除全部 EXIF/XMP，仅保留方向
+)
+
+// ValidStripExifMode 判断隐私处理模式是否有效
+func ValidStripExifMode(mode string) bool {
+	return mode == StripExifNone || mode == StripExifGPS || mode == StripExifAll
+}
+
+// ExifInfo 从 EXIF 中提取的常用字段
+type ExifInfo struct {
+	Make         string
+	Model        string
+	LensModel    string
+	TakenAt      *time.Time
+	ExposureTime string // 如 1/125
+	FNumber      float64
+	ISO          int
+	FocalLength  float64 // 毫米
+	Latitude     *float64
+	Longitude    *float64
+	Orientation  int // 1~8，1 为正常方向
+}
+
+// xmpSignature JPEG APP1 中 XMP 数据的前缀
+const xmpSignature = "http://ns.adobe.com/xap/1.0/\x00"
+
+// extractExif 从 JPEG/PNG/WebP/TIFF/HEIC 中取出 EXIF 的 TIFF 结构数据
+func extractExif(data []byte, format string) []byte {
+	switch format {
+	case "tiff":
+		return data
+	case "heic":
+		return heifExifItem(data)
+	case "jpeg":
+		var tiff []byte
+		walkJPEGSegments(data, func(marker byte, payload []byte) {
+			if marker == 0xE1 && tiff == nil && bytes.HasPrefix(payload, []byte("Exif\x00\x00")) {
+				tiff = payload[6:]
+			}
+		})
+		return tiff
+	case "png":
+		var tiff []byte
+		walkPNGChunks(data, func(chunkType string, payload []byte) {
+			if chunkType == "eXIf" && tiff == nil {
+				tiff = payload
+			}
+		})
+		return tiff
+	case "webp":
+		var tiff []byte
+		walkWebPChunks(data, func(fourCC string, payload []byte) {
+			if fourCC == "EXIF" && tiff == nil {
+				tiff = bytes.TrimPrefix(payload, []byte("Exif\x00\x00"))
+			}
+		})
+		return tiff
+	}
+	return nil
+}
+
+// parseExif 解析图片中的 EXIF，没有 EXIF 时返回 nil
+func parseExif(data []byte, format string) *ExifInfo {
+	raw := extractExif(data, format)
+	if len(raw) < 8 {
+		return nil
+	}
+	x, err := exif.Decode(bytes.NewReader(raw))
+	if x == nil || (err != nil && exif.IsCriticalError(err)) {
+		return nil
+	}
+
+	info := &ExifInfo{Orientation: 1}
+	stringTag := func(name exif.FieldName) string {
+		if tag, err := x.Get(name); err == nil {
+			if s, err := tag.StringVal(); err == nil {
+				return string(bytes.TrimRight([]byte(s), "\x00 "))
+			}
+		}
+		return ""
+	}
+	ratTag := func(name exif.FieldName) (*big.Rat, bool) {
+		tag, err := x.Get(name)
+		if err != nil {
+			return nil, false
+		}
+		num, den, err := tag.Rat2(0)
+		if err != nil || den == 0 {
+			return nil, false
+		}
+		return big.NewRat(num, den), true
+	}
+
+	info.Make = stringTag(exif.Make)
+	info.Model = stringTag(exif.Model)
+	info.LensModel = stringTag(exif.LensModel)
+	// HEIC 解码时已按 irot/imir 校正方向，EXIF 中的方向仅供参考，不再重复旋转
+	if tag, err := x.Get(exif.Orientation); err == nil && format != "heic" {
+		if o, err := tag.Int(0); err == nil && o >= 1 && o <= 8 {
+			info.Orientation = o
+		}
+	}
+	if t, err := x.DateTime(); err == nil {
+		info.TakenAt = &t
+	}
+	if tag, err := x.Get(exif.ExposureTime); err == nil {
+		if num, den, err := tag.Rat2(0); err == nil && num > 0 && den > 0 {
+			if num < den {
+				info.ExposureTime = fmt.Sprintf("1/%d", (den+num/2)/num)
+			} else {
+				info.ExposureTime = fmt.Sprintf("%g", float64(num)/float64(den))
+			}
+		}
+	}
+	if r, ok := ratTag(exif.FNumber); ok {
+		info.FNumber, _ = r.Float64()
+	}
+	if r, ok := ratTag(exif.FocalLength); ok {
+		info.FocalLength, _ = r.Float64()
+	}
+	if tag, err := x.Get(exif.ISOSpeedRatings); err == nil {
+		info.ISO, _ = tag.Int(0)
+	}
+	if lat, long, err := x.LatLong(); err == nil {
+		info.Latitude, info.Longitude = &lat, &long
+	}
+	return info
+}
+
+// exifOrientation 读取方向标签，没有时返回 1
+func exifOrientation(data []byte, format string) int {
+	if info := parseExif(data, format); info != nil {
+		return info.Orientation
+	}
+	return 1
+}
+
+// applyOrientation 按 EXIF 方向旋转/翻转图片，使像素方向与显示方向一致
+func applyOrientation(img image.Image, orientation int) image.Image {
+	switch orientation {
+	case 2:
+		return imaging.FlipH(img)
+	case 3:
+		return imaging.Rotate180(img)
+	case 4:
+		return imaging.FlipV(img)
+	case 5:
+		return imaging.Transpose(img)
+	case 6:
+		return imaging.Rotate270(img)
+	case 7:
+		return imaging.Transverse(img)
+	case 8:
+		return imaging.Rotate90(img)
+	}
+	return img
+}
+
+// StripMetadata 按模式移除原图中的 EXIF/XMP 信息，像素数据保持不变
+// gps 模式仅清空 GPS 目录，all 模式只保留方向标签，两种模式都会移除可能含有位置的 XMP
+// 与 JPEG 中的 APP13（Photoshop IRB/IPTC，可能含有地点、作者与说明）
+// HEIC 与 TIFF 在原文件中就地清零，不改变文件结构；BMP 等不含元数据的格式原样返回
+func StripMetadata(data []byte, format, mode string) ([]byte, error) {
+	if mode == StripExifNone || mode == "" {
+		return data, nil
+	}
+	if mode != StripExifGPS && mode != StripExifAll {
+		return nil, fmt.Errorf("invalid strip mode: %s", mode)
+	}
+	switch format {
+	case "heic":
+		return stripHEIFMetadata(data, mode)
+	case "tiff":
+		return stripTIFFMetadata(data, mode)
+	case "jpeg", "png", "webp":
+	default:
+		return data, nil
+	}
+
+	var replacement []byte
+	if raw := extractExif(data, format); raw != nil {
+		switch mode {
+		case StripExifGPS:
+			replacement = bytes.Clone(raw)
+			if err := clearGPSDirectory(replacement); err != nil {
+				return nil, err
+			}
+		case StripExifAll:
+			// 保留方向，否则浏览器会按未旋转的像素显示
+			if orientation := exifOrientation(data, format); orientation != 1 {
+				replacement = orientationOnlyExif(orientation)
+			}
+		default:
+			return nil, fmt.Errorf("invalid strip mode: %s", mode)
+		}
+	}
+
+	switch format {
+	case "jpeg":
+		return rewriteJPEGMetadata(data, replacement)
+	case "png":
+		return rewritePNGMetadata(data, replacement)
+	default:
+		return rewriteWebPMetadata(data, replacement)
+	}
+}
+
+// tiffTypeSizes TIFF 各数据类型的字节数
+var tiffTypeSizes = map[uint16]int{1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8}
+
+// TIFF 标签
+const (
+	tiffTagXMP     = 0x02BC
+	tiffTagExifIFD = 0x8769
+	tiffTagGPSIFD  = 0x8825
+)
+
+// stripTIFFMetadata 原地清除 TIFF 文件中的元数据
+// gps 模式清零 GPS 目录，all 模式同时清零 EXIF 子目录；两种模式都清零 XMP
+// 图像本身需要的 IFD0 标签（含方向）保持不变
+func stripTIFFMetadata(data []byte, mode string) ([]byte, error) {
+	out := bytes.Clone(data)
+	tags := []uint16{tiffTagGPSIFD}
+	if mode == StripExifAll {
+		tags = append(tags, tiffTagExifIFD)
+	}
+	for _, tag := range tags {
+		if err := clearSubIFD(out, tag); err != nil {
+			return nil, err
+		}
+	}
+	if err := clearTagData(out, tiffTagXMP); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// clearGPSDirectory 原地清零 GPS 目录及其引用的数据，不改变 EXIF 长度和其他偏移
+func clearGPSDirectory(tiff []byte) error {
+	return clearSubIFD(tiff, tiffTagGPSIFD)
+}
+
+// tiffIFD0 返回字节序与 IFD0 的位置
+func tiffIFD0(tiff []byte) (binary.ByteOrder, int, error) {
+	if len(tiff) < 8 {
+		return nil, 0, errors.New("exif data too short")
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return nil, 0, errors.New("invalid exif byte order")
+	}
+
+	ifd0 := int(order.Uint32(tiff[4:8]))
+	if ifd0 < 0 || ifd0+2 > len(tiff) {
+		return nil, 0, errors.New("invalid exif ifd offset")
+	}
+	return order, ifd0, nil
+}
+
+// findIFD0Tag 查找 IFD0 中的标签条目，返回条目位置，不存在时返回 -1
+func findIFD0Tag(tiff []byte, order binary.ByteOrder, ifd0 int, tag uint16) int {
+	count := int(order.Uint16(tiff[ifd0:]))
+	for i := 0; i < count; i++ {
+		entry := ifd0 + 2 + i*12
+		if entry+12 > len(tiff) {
+			break
+		}
+		if order.Uint16(tiff[entry:]) == tag {
+			return entry
+		}
+	}
+	return -1
+}
+
+// clearSubIFD 原地清零 IFD0 中 tag 指向的子目录（GPS/EXIF）及其引用的数据
+func clearSubIFD(tiff []byte, tag uint16) error {
+	order, ifd0, err := tiffIFD0(tiff)
+	if err != nil {
+		return err
+	}
+	entry := findIFD0Tag(tiff, order, ifd0, tag)
+	if entry < 0 {
+		return nil
+	}
+	sub := int(order.Uint32(tiff[entry+8:]))
+	if sub < 0 || sub+2 > len(tiff) {
+		return nil
+	}
+	subCount := int(order.Uint16(tiff[sub:]))
+	for j := 0; j < subCount; j++ {
+		e := sub + 2 + j*12
+		if e+12 > len(tiff) {
+			break
+		}
+		size := tiffTypeSizes[order.Uint16(tiff[e+2:])] * int(order.Uint32(tiff[e+4:]))
+		if offset := int(order.Uint32(tiff[e+8:])); size > 4 && offset >= 0 && offset+size <= len(tiff) {
+			clear(tiff[offset : offset+size])
+		}
+	}
+	// 目录条目数置 0 后，原有条目和下一目录指针一并清零
+	end := min(sub+2+subCount*12+4, len(tiff))
+	clear(tiff[sub:end])
+	return nil
+}
+
+// clearTagData 原地清零 IFD0 中 tag 的数据（如 XMP），条目本身保留
+func clearTagData(tiff []byte, tag uint16) error {
+	order, ifd0, err := tiffIFD0(tiff)
+	if err != nil {
+		return err
+	}
+	entry := findIFD0Tag(tiff, order, ifd0, tag)
+	if entry < 0 {
+		return nil
+	}
+	size := tiffTypeSizes[order.Uint16(tiff[entry+2:])] * int(order.Uint32(tiff[entry+4:]))
+	if size <= 4 {
+		clear(tiff[entry+8 : entry+12])
+	} else if offset := int(order.Uint32(tiff[entry+8:])); offset >= 0 && offset+size <= len(tiff) {
+		clear(tiff[offset : offset+size])
+	}
+	return nil
+}
+
+// orientationOnlyExif 生成仅包含方向标签的最小 EXIF
+func orientationOnlyExif(orientation int) []byte {
+	buf := make([]byte, 26)
+	copy(buf, "II*\x00")
+	binary.LittleEndian.PutUint32(buf[4:], 8)
+	binary.LittleEndian.PutUint16(buf[8:], 1)
+	binary.LittleEndian.PutUint16(buf[10:], 0x0112)
+	binary.LittleEndian.PutUint16(buf[12:], 3)
+	binary.LittleEndian.PutUint32(buf[14:], 1)
+	binary.LittleEndian.PutUint16(buf[18:], uint16(orientation))
+	return buf
+}
+
+// walkJPEGSegments 遍历 SOS 之前的 JPEG 标记段
+func walkJPEGSegments(data []byte, fn func(marker byte, payload []byte)) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return
+	}
+	for pos := 2; pos+4 <= len(data) && data[pos] == 0xFF; {
+		marker := data[pos+1]
+		if marker == 0xDA || marker == 0xD9 {
+			return
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		if length < 2 || pos+2+length > len(data) {
+			return
+		}
+		fn(marker, data[pos+4:pos+2+length])
+		pos += 2 + length
+	}
+}
+
+// rewriteJPEGMetadata 移除 EXIF、XMP 与 APP13 段，exifData 不为空时写入新的 EXIF 段
+func rewriteJPEGMetadata(data []byte, exifData []byte) ([]byte, error) {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil, errors.New("invalid jpeg data")
+	}
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:2])
+	if exifData != nil {
+		payload := append([]byte("Exif\x00\x00"), exifData...)
+		if len(payload)+2 > 0xFFFF {
+			return nil, errors.New("exif data too large")
+		}
+		out.Write([]byte{0xFF, 0xE1})
+		binary.Write(out, binary.BigEndian, uint16(len(payload)+2))
+		out.Write(payload)
+	}
+
+	pos := 2
+	for pos+4 <= len(data) && data[pos] == 0xFF {
+		marker := data[pos+1]
+		if marker == 0xDA || marker == 0xD9 {
+			break
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2:]))
+		if length < 2 || pos+2+length > len(data) {
+			return nil, errors.New("invalid jpeg segment")
+		}
+		payload := data[pos+4 : pos+2+length]
+		isExif := marker == 0xE1 && bytes.HasPrefix(payload, []byte("Exif\x00\x00"))
+		isXMP := marker == 0xE1 && bytes.HasPrefix(payload, []byte(xmpSignature))
+		isIRB := marker == 0xED
+		if !isExif && !isXMP && !isIRB {
+			out.Write(data[pos : pos+2+length])
+		}
+		pos += 2 + length
+	}
+	out.Write(data[pos:])
+	return out.Bytes(), nil
+}
+
+// walkPNGChunks 遍历 PNG 数据块
+func walkPNGChunks(data []byte, fn func(chunkType string, payload []byte)) {
+	if len(data) < 8 || string(data[1:4]) != "PNG" {
+		return
+	}
+	for pos := 8; pos+12 <= len(data); {
+		length := int(binary.BigEndian.Uint32(data[pos:]))
+		if length < 0 || pos+12+length > len(data) {
+			return
+		}
+		fn(string(data[pos+4:pos+8]), data[pos+8:pos+8+length])
+		pos += 12 + length
+	}
+}
+
+func rewritePNGMetadata(data []byte, exifData []byte) ([]byte, error) {
+	if len(data) < 8 || string(data[1:4]) != "PNG" {
+		return nil, errors.New("invalid png data")
+	}
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:8])
+	for pos := 8; pos+12 <= len(data); {
+		length := int(binary.BigEndian.Uint32(data[pos:]))
+		if length < 0 || pos+12+length > len(data) {
+			return nil, errors.New("invalid png chunk")
+		}
+		chunkType := string(data[pos+4 : pos+8])
+		payload := data[pos+8 : pos+8+length]
+		isXMP := chunkType == "iTXt" && bytes.HasPrefix(payload, []byte("XML:com.adobe.xmp\x00"))
+		switch {
+		case chunkType == "eXIf" || isXMP:
+		case chunkType == "IDAT" && exifData != nil:
+			// eXIf 必须位于 IDAT 之前
+			writePNGChunk(out, "eXIf", exifData)
+			exifData = nil
+			fallthrough
+		default:
+			out.Write(data[pos : pos+12+length])
+		}
+		pos += 12 + length
+	}
+	return out.Bytes(), nil
+}
+
+func writePNGChunk(out *bytes.Buffer, chunkType string, payload []byte) {
+	binary.Write(out, binary.BigEndian, uint32(len(payload)))
+	crc := crc32.NewIEEE()
+	crc.Write([]byte(chunkType))
+	crc.Write(payload)
+	out.WriteString(chunkType)
+	out.Write(payload)
+	binary.Write(out, binary.BigEndian, crc.Sum32())
+}
+
+// walkWebPChunks 遍历 WebP RIFF 数据块
+func walkWebPChunks(data []byte, fn func(fourCC string, payload []byte)) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return
+	}
+	for pos := 12; pos+8 <= len(data); {
+		size := int(binary.LittleEndian.Uint32(data[pos+4:]))
+		if size < 0 || pos+8+size > len(data) {
+			return
+		}
+		fn(string(data[pos:pos+4]), data[pos+8:pos+8+size])
+		pos += 8 + size + size&1
+	}
+}
+
+func rewriteWebPMetadata(data []byte, exifData []byte) ([]byte, error) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, errors.New("invalid webp data")
+	}
+	var body bytes.Buffer
+	body.WriteString("WEBP")
+	for pos := 12; pos+8 <= len(data); {
+		fourCC := string(data[pos : pos+4])
+		size := int(binary.LittleEndian.Uint32(data[pos+4:]))
+		end := min(pos+8+size+size&1, len(data))
+		if size < 0 || pos+8+size > len(data) {
+			return nil, errors.New("invalid webp chunk")
+		}
+		switch fourCC {
+		case "EXIF", "XMP ":
+		case "VP8X":
+			// 同步 VP8X 中的 EXIF(0x08)/XMP(0x04) 标志位
+			chunk := bytes.Clone(data[pos:end])
+			chunk[8] &^= 0x0C
+			if exifData != nil {
+				chunk[8] |= 0x08
+			}
+			body.Write(chunk)
+		default:
+			body.Write(data[pos:end])
+		}
+		pos = end
+	}
+	// 只有扩展格式 (VP8X) 才能携带 EXIF，简单格式直接丢弃
+	if exifData != nil && bytes.Contains(body.Bytes()[:min(body.Len(), 16)], []byte("VP8X")) {
+		writeRIFFChunk(&body, "EXIF", exifData)
+	}
+
+	var out bytes.Buffer
+	out.WriteString("RIFF")
+	binary.Write(&out, binary.LittleEndian, uint32(body.Len()))
+	out.Write(body.Bytes())
+	return out.Bytes(), nil
+}
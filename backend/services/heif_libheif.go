@@ -0,0 +1,91 @@
+//go:build heif && cgo
+
+package services
+
+/*
+#cgo pkg-config: libheif
+#include <stdio.h>
+#include <stdlib.h>
+#include <string.h>
+#include <libheif/heif.h>
+
+// decode_heif 解码主图为 8 位非预乘 RGBA，成功时 out 由调用方 free，失败返回错误信息
+static const char *decode_heif(const void *data, size_t size, uint8_t **out, int *width, int *height) {
+	static __thread char message[256];
+	struct heif_context *ctx = heif_context_alloc();
+	if (ctx == NULL) {
+		return "failed to allocate heif context";
+	}
+
+	struct heif_image_handle *handle = NULL;
+	struct heif_image *image = NULL;
+	const char *result = NULL;
+
+	struct heif_error err = heif_context_read_from_memory_without_copy(ctx, data, size, NULL);
+	if (err.code == heif_error_Ok) {
+		err = heif_context_get_primary_image_handle(ctx, &handle);
+	}
+	if (err.code == heif_error_Ok) {
+		// 默认解码选项会应用 irot/imir 等变换，输出即为正确方向
+		err = heif_decode_image(handle, &image, heif_colorspace_RGB, heif_chroma_interleaved_RGBA, NULL);
+	}
+	if (err.code != heif_error_Ok) {
+		snprintf(message, sizeof(message), "%s", err.message);
+		result = message;
+		goto cleanup;
+	}
+
+	int stride = 0;
+	const uint8_t *plane = heif_image_get_plane_readonly(image, heif_channel_interleaved, &stride);
+	*width = heif_image_get_width(image, heif_channel_interleaved);
+	*height = heif_image_get_height(image, heif_channel_interleaved);
+	if (plane == NULL || *width <= 0 || *height <= 0) {
+		result = "heif image has no pixel data";
+		goto cleanup;
+	}
+
+	*out = malloc((size_t)(*width) * 4 * (size_t)(*height));
+	if (*out == NULL) {
+		result = "out of memory";
+		goto cleanup;
+	}
+	for (int y = 0; y < *height; y++) {
+		memcpy(*out + (size_t)y * (*width) * 4, plane + (size_t)y * stride, (size_t)(*width) * 4);
+	}
+
+cleanup:
+	if (image != NULL) {
+		heif_image_release(image);
+	}
+	if (handle != NULL) {
+		heif_image_handle_release(handle);
+	}
+	heif_context_free(ctx);
+	return result;
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"image"
+	"unsafe"
+)
+
+// decodeHEIF 通过 libheif 解码 HEIC/HEIF 主图，需使用 -tags heif 构建并安装 libheif
+func decodeHEIF(data []byte) (image.Image, error) {
+	// 数据复制到 C 内存，解码期间 libheif 直接引用该内存
+	input := C.CBytes(data)
+	defer C.free(input)
+
+	var out *C.uint8_t
+	var width, height C.int
+	if msg := C.decode_heif(input, C.size_t(len(data)), &out, &width, &height); msg != nil {
+		return nil, fmt.Errorf("failed to decode heif: %s", C.GoString(msg))
+	}
+	defer C.free(unsafe.Pointer(out))
+
+	img := image.NewNRGBA(image.Rect(0, 0, int(width), int(height)))
+	copy(img.Pix, unsafe.Slice((*byte)(unsafe.Pointer(out)), len(img.Pix)))
+	return img, nil
+}
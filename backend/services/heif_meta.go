@@ -0,0 +1,300 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// heifItem HEIF meta 中的一个数据项在文件中的位置
+type heifItem struct {
+	Type        string // infe 中的 item_type，如 Exif、mime
+	ContentType string // mime 项的内容类型，XMP 为 application/rdf+xml
+	Offset      int
+	Length      int
+	Located     bool // 数据以单段存放在文件中，Offset/Length 有效
+}
+
+// heifBox 读取 data 中 pos 处的盒子，返回类型、内容起止位置
+func heifBox(data []byte, pos int) (string, int, int, bool) {
+	if pos+8 > len(data) {
+		return "", 0, 0, false
+	}
+	size := int(binary.BigEndian.Uint32(data[pos:]))
+	boxType := string(data[pos+4 : pos+8])
+	start := pos + 8
+	switch size {
+	case 0:
+		size = len(data) - pos
+	case 1:
+		if pos+16 > len(data) {
+			return "", 0, 0, false
+		}
+		large := binary.BigEndian.Uint64(data[pos+8:])
+		if large > uint64(len(data)-pos) {
+			return "", 0, 0, false
+		}
+		size, start = int(large), pos+16
+	}
+	if size < start-pos || pos+size > len(data) {
+		return "", 0, 0, false
+	}
+	return boxType, start, pos + size, true
+}
+
+// walkHEIFBoxes 遍历 [start, end) 范围内的同级盒子
+func walkHEIFBoxes(data []byte, start, end int, fn func(boxType string, body []byte, bodyStart int)) {
+	for pos := start; pos < end; {
+		boxType, bodyStart, next, ok := heifBox(data[:end], pos)
+		if !ok {
+			return
+		}
+		fn(boxType, data[bodyStart:next], bodyStart)
+		pos = next
+	}
+}
+
+// heifMetadataItems 解析 meta 盒中的 iinf 与 iloc，得到各数据项的类型与位置
+// 只能定位按文件偏移存放 (construction_method 0) 且只有一段数据的项，其余项的 Located 为 false
+func heifMetadataItems(data []byte) []heifItem {
+	if !isHEIF(data) {
+		return nil
+	}
+	types := map[uint32]heifItem{}
+	var locations map[uint32][2]int
+	walkHEIFBoxes(data, 0, len(data), func(boxType string, meta []byte, metaStart int) {
+		if boxType != "meta" || len(meta) < 4 {
+			return
+		}
+		// meta 为 FullBox，跳过 version/flags
+		walkHEIFBoxes(data, metaStart+4, metaStart+len(meta), func(boxType string, body []byte, _ int) {
+			switch boxType {
+			case "iinf":
+				parseHEIFItemInfo(body, types)
+			case "iloc":
+				locations = parseHEIFItemLocations(body)
+			}
+		})
+	})
+
+	var items []heifItem
+	for id, item := range types {
+		if loc, ok := locations[id]; ok && loc[0] >= 0 && loc[1] > 0 && loc[0] <= len(data) && loc[1] <= len(data)-loc[0] {
+			item.Offset, item.Length, item.Located = loc[0], loc[1], true
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+// heifImageSize 返回 ipco 中 ispe 属性声明的最大图像尺寸，用于解码前检查像素上限
+// 网格图的主图与各分块都有 ispe，取面积最大者即解码输出的尺寸
+func heifImageSize(data []byte) (int, int, bool) {
+	var width, height uint64
+	walkHEIFBoxes(data, 0, len(data), func(boxType string, meta []byte, metaStart int) {
+		if boxType != "meta" || len(meta) < 4 {
+			return
+		}
+		walkHEIFBoxes(data, metaStart+4, metaStart+len(meta), func(boxType string, iprp []byte, iprpStart int) {
+			if boxType != "iprp" {
+				return
+			}
+			walkHEIFBoxes(data, iprpStart, iprpStart+len(iprp), func(boxType string, ipco []byte, ipcoStart int) {
+				if boxType != "ipco" {
+					return
+				}
+				walkHEIFBoxes(data, ipcoStart, ipcoStart+len(ipco), func(boxType string, ispe []byte, _ int) {
+					// ispe 为 FullBox，version/flags 之后是 32 位宽与高
+					if boxType != "ispe" || len(ispe) < 12 {
+						return
+					}
+					w, h := uint64(binary.BigEndian.Uint32(ispe[4:])), uint64(binary.BigEndian.Uint32(ispe[8:]))
+					if w*h > width*height {
+						width, height = w, h
+					}
+				})
+			})
+		})
+	})
+	if width == 0 || height == 0 || width > math.MaxInt32 || height > math.MaxInt32 {
+		return 0, 0, false
+	}
+	return int(width), int(height), true
+}
+
+// parseHEIFItemInfo 解析 iinf 中各 infe（版本 2/3）的项类型
+func parseHEIFItemInfo(body []byte, types map[uint32]heifItem) {
+	if len(body) < 6 {
+		return
+	}
+	start := 6 // version/flags + 16 位 entry_count
+	if body[0] != 0 {
+		start = 8
+	}
+	walkHEIFBoxes(body, start, len(body), func(boxType string, infe []byte, _ int) {
+		if boxType != "infe" || len(infe) < 4 {
+			return
+		}
+		version := infe[0]
+		var id uint32
+		var p int
+		switch version {
+		case 2:
+			if len(infe) < 12 {
+				return
+			}
+			id, p = uint32(binary.BigEndian.Uint16(infe[4:])), 8
+		case 3:
+			if len(infe) < 14 {
+				return
+			}
+			id, p = binary.BigEndian.Uint32(infe[4:]), 10
+		default:
+			return
+		}
+		item := heifItem{Type: string(infe[p : p+4])}
+		if item.Type == "mime" {
+			// item_name 之后是 content_type，均以 \0 结尾
+			rest := infe[p+4:]
+			if i := bytes.IndexByte(rest, 0); i >= 0 {
+				rest = rest[i+1:]
+				if j := bytes.IndexByte(rest, 0); j >= 0 {
+					item.ContentType = string(rest[:j])
+				}
+			}
+		}
+		types[id] = item
+	})
+}
+
+// parseHEIFItemLocations 解析 iloc，返回项 ID 到 [偏移, 长度] 的映射
+func parseHEIFItemLocations(body []byte) map[uint32][2]int {
+	locations := map[uint32][2]int{}
+	if len(body) < 8 {
+		return locations
+	}
+	version := body[0]
+	offsetSize, lengthSize := int(body[4]>>4), int(body[4]&0x0F)
+	baseOffsetSize, indexSize := int(body[5]>>4), 0
+	if version == 1 || version == 2 {
+		indexSize = int(body[5] & 0x0F)
+	}
+
+	p := 6
+	readUint := func(n int) (int, bool) {
+		if n == 0 {
+			return 0, true
+		}
+		if p+n > len(body) || (n != 2 && n != 4 && n != 8) {
+			return 0, false
+		}
+		var v uint64
+		for _, b := range body[p : p+n] {
+			v = v<<8 | uint64(b)
+		}
+		p += n
+		if v > uint64(int(^uint(0)>>1)) {
+			return 0, false
+		}
+		return int(v), true
+	}
+
+	idSize := 2
+	if version == 2 {
+		idSize = 4
+	}
+	count, ok := readUint(idSize)
+	if !ok {
+		return locations
+	}
+	for i := 0; i < count; i++ {
+		id, ok := readUint(idSize)
+		method := 0
+		if ok && (version == 1 || version == 2) {
+			var v int
+			v, ok = readUint(2)
+			method = v & 0x0F
+		}
+		var base, extents int
+		if ok {
+			_, ok = readUint(2) // data_reference_index
+		}
+		if ok {
+			base, ok = readUint(baseOffsetSize)
+		}
+		if ok {
+			extents, ok = readUint(2)
+		}
+		if !ok {
+			return locations
+		}
+		offset, length := 0, 0
+		for e := 0; e < extents; e++ {
+			_, ok1 := readUint(indexSize)
+			off, ok2 := readUint(offsetSize)
+			n, ok3 := readUint(lengthSize)
+			if !ok1 || !ok2 || !ok3 {
+				return locations
+			}
+			offset, length = off, n
+		}
+		if method == 0 && extents == 1 {
+			locations[uint32(id)] = [2]int{base + offset, length}
+		}
+	}
+	return locations
+}
+
+// heifExifItem 返回 HEIF 中 EXIF 项的 TIFF 数据，data 中的原始切片
+func heifExifItem(data []byte) []byte {
+	for _, item := range heifMetadataItems(data) {
+		if item.Type == "Exif" && item.Located {
+			return heifExifPayload(data[item.Offset : item.Offset+item.Length])
+		}
+	}
+	return nil
+}
+
+// heifExifPayload 跳过 EXIF 项开头的 TIFF 头偏移（通常指向 "Exif\0\0" 之后）
+func heifExifPayload(payload []byte) []byte {
+	if len(payload) < 4 {
+		return nil
+	}
+	skip := int(binary.BigEndian.Uint32(payload))
+	if skip < 0 || skip > len(payload)-4 {
+		return nil
+	}
+	return payload[4+skip:]
+}
+
+// stripHEIFMetadata 原地清除 HEIF 中的元数据，文件结构与各项偏移不变
+// gps 模式清零 GPS 目录，all 模式清零整个 EXIF；两种模式都清零 XMP
+// 存在无法定位或无法解析的 EXIF/XMP 项（如存放在 idat 中或分为多段）时返回错误，不保留未清除的文件
+// HEIF 的方向由 irot/imir 属性决定，不依赖 EXIF
+func stripHEIFMetadata(data []byte, mode string) ([]byte, error) {
+	out := bytes.Clone(data)
+	for _, item := range heifMetadataItems(out) {
+		isXMP := item.Type == "mime" && item.ContentType == "application/rdf+xml"
+		if item.Type != "Exif" && !isXMP {
+			continue
+		}
+		if !item.Located {
+			return nil, fmt.Errorf("cannot locate heif %s item", item.Type)
+		}
+		payload := out[item.Offset : item.Offset+item.Length]
+		if isXMP || mode == StripExifAll {
+			clear(payload)
+			continue
+		}
+		tiff := heifExifPayload(payload)
+		if tiff == nil {
+			return nil, errors.New("invalid heif exif item")
+		}
+		if err := clearGPSDirectory(tiff); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
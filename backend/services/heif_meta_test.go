@@ -0,0 +1,168 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+)
+
+func testBox(boxType string, body ...[]byte) []byte {
+	b := bytes.Join(body, nil)
+	return append(append(binary.BigEndian.AppendUint32(nil, uint32(8+len(b))), boxType...), b...)
+}
+
+// testEXIF 小端 TIFF：IFD0 含 Make=Apple 与指向 GPS 目录的指针，GPS 目录含北纬/东经
+func testEXIF() []byte {
+	le := binary.LittleEndian
+	b := le.AppendUint32([]byte("II*\x00"), 8)
+	entry := func(tag, typ uint16, count, value uint32) {
+		b = le.AppendUint16(b, tag)
+		b = le.AppendUint16(b, typ)
+		b = le.AppendUint32(b, count)
+		b = le.AppendUint32(b, value)
+	}
+	// IFD0 位于 8，共 2 项，Make 字符串位于 8+2+24+4=38，GPS 目录位于 44
+	b = le.AppendUint16(b, 2)
+	entry(0x010F, 2, 6, 38)
+	entry(0x8825, 4, 1, 44)
+	b = le.AppendUint32(b, 0)
+	b = append(b, "Apple\x00"...)
+	// GPS 目录共 4 项，纬度位于 44+2+48+4=98，经度位于 122
+	b = le.AppendUint16(b, 4)
+	entry(0x0001, 2, 2, 'N')
+	entry(0x0002, 5, 3, 98)
+	entry(0x0003, 2, 2, 'E')
+	entry(0x0004, 5, 3, 122)
+	b = le.AppendUint32(b, 0)
+	for _, v := range []uint32{30, 1, 15, 1, 0, 1, 120, 1, 0, 1, 0, 1} {
+		b = le.AppendUint32(b, v)
+	}
+	return b
+}
+
+// testHEIFItem 测试用的 HEIF 数据项，method 为 iloc 的 construction_method (0 文件偏移 / 1 idat)
+type testHEIFItem struct {
+	id      uint16
+	typ     string
+	extra   []byte // infe 中 item_name 之后的内容，如 mime 项的 content_type
+	payload []byte
+	method  uint16
+	extents int
+}
+
+// buildTestHEIF 生成只含元数据项的 HEIF：method 0 的数据放在 mdat，method 1 的放在 meta 内的 idat
+func buildTestHEIF(items ...testHEIFItem) []byte {
+	ftyp := testBox("ftyp", []byte("heic\x00\x00\x00\x00mif1heic"))
+
+	var infes [][]byte
+	for _, item := range items {
+		body := binary.BigEndian.AppendUint16([]byte{2, 0, 0, 0}, item.id)
+		body = append(append(body, 0, 0), item.typ...)
+		body = append(append(body, 0), item.extra...)
+		infes = append(infes, testBox("infe", body))
+	}
+	iinf := testBox("iinf", binary.BigEndian.AppendUint16([]byte{0, 0, 0, 0}, uint16(len(items))), bytes.Join(infes, nil))
+
+	// iloc 版本 1，offset/length 均为 4 字节，无 base_offset
+	meta := func(mdatStart int) []byte {
+		iloc := binary.BigEndian.AppendUint16([]byte{1, 0, 0, 0, 0x44, 0x00}, uint16(len(items)))
+		var idat []byte
+		offset := mdatStart
+		for _, item := range items {
+			iloc = binary.BigEndian.AppendUint16(iloc, item.id)
+			iloc = binary.BigEndian.AppendUint16(iloc, item.method)
+			iloc = binary.BigEndian.AppendUint16(iloc, 0)
+			extents := max(item.extents, 1)
+			iloc = binary.BigEndian.AppendUint16(iloc, uint16(extents))
+			start := offset
+			if item.method == 1 {
+				start = len(idat)
+				idat = append(idat, item.payload...)
+			} else {
+				offset += len(item.payload)
+			}
+			step := len(item.payload) / extents
+			for e := 0; e < extents; e++ {
+				n := step
+				if e == extents-1 {
+					n = len(item.payload) - step*e
+				}
+				iloc = binary.BigEndian.AppendUint32(iloc, uint32(start+step*e))
+				iloc = binary.BigEndian.AppendUint32(iloc, uint32(n))
+			}
+		}
+		return testBox("meta", []byte{0, 0, 0, 0}, testBox("hdlr", make([]byte, 24)), iinf, testBox("iloc", iloc), testBox("idat", idat))
+	}
+
+	var mdat []byte
+	for _, item := range items {
+		if item.method == 0 {
+			mdat = append(mdat, item.payload...)
+		}
+	}
+	mdatStart := len(ftyp) + len(meta(0)) + 8
+	return bytes.Join([][]byte{ftyp, meta(mdatStart), testBox("mdat", mdat)}, nil)
+}
+
+func testHEIFExifItem(method uint16, extents int) testHEIFItem {
+	payload := append(binary.BigEndian.AppendUint32(nil, 6), "Exif\x00\x00"...)
+	return testHEIFItem{id: 2, typ: "Exif", payload: append(payload, testEXIF()...), method: method, extents: extents}
+}
+
+var testHEIFXMPItem = testHEIFItem{id: 3, typ: "mime", extra: []byte("application/rdf+xml\x00"), payload: []byte("<x:xmpmeta>location</x:xmpmeta>")}
+
+func TestStripHEIFMetadata(t *testing.T) {
+	data := buildTestHEIF(testHEIFItem{id: 1, typ: "hvc1"}, testHEIFExifItem(0, 1), testHEIFXMPItem)
+	original := bytes.Clone(data)
+
+	info := parseExif(data, "heic")
+	if info == nil || info.Make != "Apple" || info.Latitude == nil {
+		t.Fatalf("parseExif = %+v", info)
+	}
+
+	stripped, err := StripMetadata(data, "heic", StripExifGPS)
+	if err != nil {
+		t.Fatalf("StripMetadata gps: %v", err)
+	}
+	if info := parseExif(stripped, "heic"); info == nil || info.Make != "Apple" || info.Latitude != nil {
+		t.Errorf("after gps strip = %+v", info)
+	}
+	if bytes.Contains(stripped, []byte("location")) {
+		t.Error("XMP kept after gps strip")
+	}
+
+	stripped, err = StripMetadata(data, "heic", StripExifAll)
+	if err != nil {
+		t.Fatalf("StripMetadata all: %v", err)
+	}
+	if info := parseExif(stripped, "heic"); info != nil {
+		t.Errorf("after all strip = %+v", info)
+	}
+	if len(stripped) != len(data) || !bytes.Equal(data, original) {
+		t.Error("strip changed the file layout or the input")
+	}
+}
+
+func TestStripHEIFMetadataUnlocatedItems(t *testing.T) {
+	xmpInIdat := testHEIFXMPItem
+	xmpInIdat.method = 1
+	cases := map[string][]testHEIFItem{
+		"exif in idat":      {testHEIFExifItem(1, 1)},
+		"exif in 2 extents": {testHEIFExifItem(0, 2)},
+		"xmp in idat":       {testHEIFExifItem(0, 1), xmpInIdat},
+	}
+	for name, items := range cases {
+		data := buildTestHEIF(items...)
+		for _, mode := range []string{StripExifGPS, StripExifAll} {
+			if _, err := StripMetadata(data, "heic", mode); err == nil {
+				t.Errorf("%s, %s: metadata left in place without an error", name, mode)
+			}
+		}
+	}
+
+	// 没有元数据项时原样返回
+	data := buildTestHEIF(testHEIFItem{id: 1, typ: "hvc1"})
+	if stripped, err := StripMetadata(data, "heic", StripExifAll); err != nil || !bytes.Equal(stripped, data) {
+		t.Errorf("no metadata: %v", err)
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !heif || !cgo
+
+package services
+
+import (
+	"errors"
+	"image"
+)
+
+// 默认构建不包含 HEIC/HEIF 解码器，使用 -tags heif 并安装 libheif 后启用
+var errHEIFUnsupported = errors.New("heic/heif decoding is not supported in this build (rebuild with -tags heif)")
+
+func decodeHEIF(data []byte) (image.Image, error) {
+	return nil, errHEIFUnsupported
+}
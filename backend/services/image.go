@@ -8,20 +8,30 @@ import (
 	"image/jpeg"
 	"image/png"
 	"io"
+	"log"
 	"mime/multipart"
 	"slices"
 	"strings"
 
 	"github.com/chai2010/webp"
 	"github.com/disintegration/imaging"
+	_ "golang.org/x/image/bmp"
+	_ "golang.org/x/image/tiff"
 )
 
+// 浏览器无法直接显示的源格式，上传时转换为网页可用格式保存
+var renditionSourceFormats = []string{"heic", "tiff", "bmp"}
+
 type ImageService struct{}
 
 var ImageSvc *ImageService
 
 // InitImageService 初始化图片服务
-func InitImageService() {
+func InitImageService(settings OutputSettings) {
+	if !avifSupported {
+		log.Println("当前构建不支持 AVIF 编码（需使用 -tags avif 构建并安装 libavif），avif 格式不可用")
+	}
+	configureOutput(settings)
 	ImageSvc = &ImageService{}
 }
 
@@ -41,19 +51,49 @@ func (s *ImageService) ProcessImage(file multipart.File, header *multipart.FileH
 	// 重置文件指针
 	file.Seek(0, 0)
 
+	return s.ProcessImageBytes(fileBytes, header.Header.Get("Content-Type"))
+}
+
+// ProcessImageBytes 处理内存中的图片数据，contentType 仅在无法按文件头识别类型时使用
+func (s *ImageService) ProcessImageBytes(fileBytes []byte, contentType string) (*ProcessedImage, error) {
+	var err error
+
+	// SVG 先清理脚本与外部引用，保存与后续处理都使用清理后的内容
+	isVector := isSVG(fileBytes)
+	if isVector {
+		if fileBytes, err = SanitizeSVG(fileBytes); err != nil {
+			return nil, err
+		}
+	}
+
 	// 解码图片
 	img, format, err := s.decodeImage(bytes.NewReader(fileBytes))
 	if err != nil {
 		return nil, fmt.Errorf("failed to decode image: %v", err)
 	}
 
+	// 解析 EXIF 并按方向校正，缩略图、预览图及转换后的主图都基于校正后的像素
+	exifInfo := parseExif(fileBytes, format)
+	if exifInfo != nil {
+		img = applyOrientation(img, exifInfo.Orientation)
+	}
+
 	// 获取图片尺寸
 	bounds := img.Bounds()
 	width := bounds.Dx()
 	height := bounds.Dy()
+	// SVG 记录声明的尺寸而不是栅格化后的尺寸
+	if isVector {
+		if width, height, err = svgSize(fileBytes); err != nil {
+			return nil, err
+		}
+	}
 
-	// 检查是否为特殊格式（保持原格式）
-	mimeType := header.Header.Get("Content-Type")
+	// 检查是否为特殊格式（保持原格式），MIME 类型以文件头识别结果为准
+	mimeType := SniffImageType(fileBytes)
+	if mimeType == "" {
+		mimeType = contentType
+	}
 	var processedBytes []byte
 	var finalFormat string
 	var finalMimeType string
@@ -63,38 +103,86 @@ func (s *ImageService) ProcessImage(file multipart.File, header *multipart.FileH
 	finalFormat = format
 	finalMimeType = mimeType
 
-	// 生成缩略图 (300x300)
+	// HEIC/TIFF/BMP 等格式浏览器无法显示，主图改为保存 JPEG/WebP 版本
+	if slices.Contains(renditionSourceFormats, format) {
+		processedBytes, err = s.encodeImage(img, output.RenditionFormat, output.RenditionQuality)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert %s to %s: %v", format, output.RenditionFormat, err)
+		}
+		finalFormat = output.RenditionFormat
+		finalMimeType = MimeTypeOf(output.RenditionFormat)
+	}
+
+	// 生成缩略图 (thumb 预设，默认 300x300)
 	var thumbnailBytes []byte
-	// 生成预览图 (Max 1920x1080)
+	// 生成预览图 (preview 预设，默认 Max 1920x1080)
 	var previewBytes []byte
 	
-	// 对于 GIF，我们尝试生成 WebP 缩略图（取第一帧），如果失败则使用原图
-	// 对于其他格式，统一生成 WebP 缩略图
-	if format == "gif" {
-		// GIF 缩略图处理：尝试生成静态 WebP 缩略图
-		thumbnailBytes, err = s.generateWebPThumbnail(img, 300, 300, 80)
+	// 对于 GIF，我们尝试生成静态缩略图（取第一帧），如果失败则使用原图
+	// 缩略图、预览图的尺寸、格式与质量由预设决定（默认取自 OutputSettings）
+	thumbPreset, _ := FindPreset(PresetThumb)
+	previewPreset, _ := FindPreset(PresetPreview)
+	thumbnailMimeType, previewMimeType := MimeTypeOf(thumbPreset.Format), MimeTypeOf(previewPreset.Format)
+	wm := CurrentWatermark()
+	// 多帧 GIF 优先生成保留动画的缩略图与预览图，超出限制或失败时退回静态处理
+	var animated *animatedRenditions
+	if format == "gif" && output.Animation.Enabled && isAnimatedGIF(fileBytes) {
+		animated, err = s.processAnimatedGIF(fileBytes, thumbPreset, previewPreset)
+		if err != nil && err != errAnimationLimit {
+			log.Printf("动图处理失败，退回静态缩略图: %v", err)
+		}
+	}
+
+	if animated != nil {
+		thumbnailBytes, thumbnailMimeType = animated.Thumbnail, animated.MimeType
+		previewBytes, previewMimeType = animated.Preview, animated.MimeType
+		// 预览图比原图还大时直接使用原图
+		if len(previewBytes) > len(fileBytes) {
+			previewBytes, previewMimeType = fileBytes, mimeType
+		}
+		if animated.Stored != nil {
+			processedBytes = animated.Stored
+			finalFormat = "webp"
+			finalMimeType = "image/webp"
+		}
+	} else if format == "gif" {
+		// GIF 缩略图处理：尝试生成静态缩略图
+		thumbnailBytes, err = s.renderPreset(img, thumbPreset, wm)
 		if err != nil {
-			thumbnailBytes = fileBytes
+			thumbnailBytes, thumbnailMimeType = fileBytes, mimeType
 		}
-		// GIF 预览图：尝试生成静态 WebP 预览图
-		previewBytes, err = s.generateWebPThumbnail(img, 1920, 1080, 75)
+		// GIF 预览图：尝试生成静态预览图
+		previewBytes, err = s.renderPreset(img, previewPreset, wm)
 		if err != nil {
-			previewBytes = fileBytes
+			previewBytes, previewMimeType = fileBytes, mimeType
 		}
 	} else {
-		// 普通格式生成 webp 缩略图
-		thumbnailBytes, err = s.generateWebPThumbnail(img, 300, 300, 80)
+		// 普通格式生成缩略图
+		thumbnailBytes, err = s.renderPreset(img, thumbPreset, wm)
 		if err != nil {
-			return nil, fmt.Errorf("failed to generate webp thumbnail: %v", err)
+			return nil, fmt.Errorf("failed to generate %s thumbnail: %v", thumbPreset.Format, err)
 		}
-		// 普通格式生成 webp 预览图
-		previewBytes, err = s.generateWebPThumbnail(img, 1920, 1080, 75)
+		// 普通格式生成预览图
+		previewBytes, err = s.renderPreset(img, previewPreset, wm)
 		if err != nil {
 			// 如果生成失败，使用原图
-			previewBytes = fileBytes
+			previewBytes, previewMimeType = fileBytes, mimeType
 		}
 	}
 
+	// 自定义预设（动图取第一帧）
+	presetRenditions := s.renderCustomPresets(img, wm)
+
+	// 水印写入原图，未加水印的原图保留在 CleanBytes 中（动图不处理）
+	var cleanBytes []byte
+	if wm.BakeOriginal() && animated == nil && finalFormat != "gif" && finalFormat != "svg" {
+		watermarked, err := s.encodeImage(wm.Apply(img), finalFormat, output.RenditionQuality)
+		if err != nil {
+			return nil, fmt.Errorf("failed to apply watermark: %v", err)
+		}
+		cleanBytes, processedBytes = processedBytes, watermarked
+	}
+
 	return &ProcessedImage{
 		OriginalBytes:   fileBytes,
 		CompressedBytes: processedBytes, // 这里现在是原图数据
@@ -104,6 +192,16 @@ func (s *ImageService) ProcessImage(file multipart.File, header *multipart.FileH
 		Height:          height,
 		Format:          finalFormat,
 		MimeType:        finalMimeType,
+
+		ThumbnailMimeType: thumbnailMimeType,
+		PreviewMimeType:   previewMimeType,
+		SourceFormat:      format,
+		SourceMimeType:    mimeType,
+		Exif:              exifInfo,
+		CleanBytes:        cleanBytes,
+		PHash:             FormatPHash(PerceptualHash(img)),
+		Placeholder:       ComputePlaceholder(img),
+		Presets:           presetRenditions,
 	}, nil
 }
 
@@ -128,7 +226,16 @@ func (s *ImageService) isSpecialFormat(format, mimeType string) bool {
 	return false
 }
 
-// decodeImage 解码图片，支持webp格式
+// decodeOriented 解码图片并按 EXIF 方向校正
+func (s *ImageService) decodeOriented(data []byte) (image.Image, error) {
+	img, format, err := s.decodeImage(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	return applyOrientation(img, exifOrientation(data, format)), nil
+}
+
+// decodeImage 解码图片，支持webp格式，SVG 栅格化后返回
 func (s *ImageService) decodeImage(reader io.Reader) (image.Image, string, error) {
 	// 读取数据到缓冲区
 	data, err := io.ReadAll(reader)
@@ -136,10 +243,22 @@ func (s *ImageService) decodeImage(reader io.Reader) (image.Image, string, error
 		return nil, "", err
 	}
 
-	// 尝试解码webp
+	// SVG 栅格化为位图
+	if isSVG(data) {
+		img, err := rasterizeSVG(data)
+		if err != nil {
+			return nil, "", err
+		}
+		return img, "svg", nil
+	}
+
+	// 尝试解码webp，动态 WebP 取第一帧
 	if img, err := webp.Decode(bytes.NewReader(data)); err == nil {
 		return img, "webp", nil
 	}
+	if img, err := decodeWebPFirstFrame(data); err == nil {
+		return img, "webp", nil
+	}
 
 	// 尝试解码gif
 	if img, err := gif.Decode(bytes.NewReader(data)); err == nil {
@@ -151,6 +270,15 @@ func (s *ImageService) decodeImage(reader io.Reader) (image.Image, string, error
 		return img, "png", nil
 	}
 
+	// HEIC/HEIF 需要 libheif 支持
+	if isHEIF(data) {
+		img, err := decodeHEIF(data)
+		if err != nil {
+			return nil, "", err
+		}
+		return img, "heic", nil
+	}
+
 	// 使用标准库解码其他格式
 	img, format, err := image.Decode(bytes.NewReader(data))
 	if err != nil {
@@ -160,6 +288,18 @@ func (s *ImageService) decodeImage(reader io.Reader) (image.Image, string, error
 	return img, format, nil
 }
 
+// isHEIF 根据 ftyp 主品牌判断是否为 HEIC/HEIF 文件
+func isHEIF(data []byte) bool {
+	if len(data) < 12 || string(data[4:8]) != "ftyp" {
+		return false
+	}
+	switch string(data[8:12]) {
+	case "heic", "heix", "heim", "heis", "hevc", "hevx", "mif1", "msf1":
+		return true
+	}
+	return false
+}
+
 // convertToWebP 将图片转换为webp格式
 func (s *ImageService) convertToWebP(img image.Image, quality int) ([]byte, error) {
 	// 使用chai2010/webp包进行webp编码
@@ -175,24 +315,28 @@ func (s *ImageService) compressWebP(img image.Image, quality int) ([]byte, error
 	return s.convertToWebP(img, quality)
 }
 
-// ValidateImage 验证图片格式和大小
-func (s *ImageService) ValidateImage(header *multipart.FileHeader, allowedTypes []string, maxSize int64) error {
+// ValidateImage 解码前验证上传文件的大小、真实类型（文件头魔数，不信任 Content-Type）、尺寸与帧数
+// 通过时返回读取到的文件内容，供后续处理使用；未通过时返回 *UploadRejection
+func (s *ImageService) ValidateImage(header *multipart.FileHeader, limits UploadLimits) ([]byte, *ImageCheck, error) {
 	// 检查文件大小
-	if header.Size > maxSize {
-		return fmt.Errorf("file size exceeds limit: %d bytes", maxSize)
+	if header.Size > limits.MaxFileSize {
+		return nil, nil, rejectUpload(RejectFileTooLarge, "文件大小超出限制 (最大 %d 字节)", limits.MaxFileSize)
 	}
 
-	// 检查文件类型
-	mimeType := header.Header.Get("Content-Type")
-	if mimeType == "" {
-		return fmt.Errorf("missing content type")
+	file, err := header.Open()
+	if err != nil {
+		return nil, nil, err
 	}
-
-	if slices.Contains(allowedTypes, mimeType) {
-		return nil
+	defer file.Close()
+	data, err := io.ReadAll(io.LimitReader(file, limits.MaxFileSize+1))
+	if err != nil {
+		return nil, nil, err
 	}
-
-	return fmt.Errorf("unsupported file type: %s", mimeType)
+	check, err := CheckUpload(data, limits)
+	if err != nil {
+		return nil, nil, err
+	}
+	return data, check, nil
 }
 
 // generateJPEGThumbnail 生成JPEG格式缩略图
@@ -228,4 +372,27 @@ type ProcessedImage struct {
 	Height          int
 	Format          string
 	MimeType        string
+
+	// 缩略图、预览图实际的 MIME 类型（格式可配置，生成失败时为原图类型）
+	ThumbnailMimeType string
+	PreviewMimeType   string
+
+	// 上传文件的原始格式，与 Format 不同时说明主图为转换后的版本
+	SourceFormat   string
+	SourceMimeType string
+
+	// 上传文件中的 EXIF 信息，没有时为 nil
+	Exif *ExifInfo
+
+	// 原图已写入水印时，未加水印的原图数据；否则为 nil
+	CleanBytes []byte
+
+	// 感知哈希 (dHash)，用于查找相似图片
+	PHash string
+
+	// BlurHash 与主色调
+	Placeholder Placeholder
+
+	// 内置预设以外的自定义预设衍生图
+	Presets []PresetRendition
 }
@@ -0,0 +1,248 @@
+package services
+
+import (
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// 仍在写入中的临时文件后缀，等待重命名后再处理
+var inboxPartialSuffixes = []string{".tmp", ".part", ".partial", ".crdownload", ".download", ".swp"}
+
+// IsInboxCandidate 判断收件目录中的文件是否需要处理（跳过隐藏文件与下载中的临时文件）
+func IsInboxCandidate(name string) bool {
+	base := filepath.Base(name)
+	if strings.HasPrefix(base, ".") || strings.HasPrefix(base, "~") {
+		return false
+	}
+	lower := strings.ToLower(base)
+	for _, suffix := range inboxPartialSuffixes {
+		if strings.HasSuffix(lower, suffix) {
+			return false
+		}
+	}
+	return true
+}
+
+// isExcludedDir 目录是否为（或位于）排除的目录中，归档与隔离目录放在收件目录内时不能再次处理
+func isExcludedDir(dir string, exclude []string) bool {
+	for _, ex := range exclude {
+		if rel, err := filepath.Rel(ex, dir); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// absPaths 转换为绝对路径，忽略空路径
+func absPaths(paths []string) []string {
+	var result []string
+	for _, p := range paths {
+		if p == "" {
+			continue
+		}
+		if abs, err := filepath.Abs(p); err == nil {
+			result = append(result, abs)
+		}
+	}
+	return result
+}
+
+// ScanInbox 列出收件目录（含子目录）中待处理的文件，按路径排序
+func ScanInbox(root string, exclude []string) ([]string, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	exclude = absPaths(exclude)
+
+	var files []string
+	err = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if p != root && (strings.HasPrefix(d.Name(), ".") || isExcludedDir(p, exclude)) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.Type().IsRegular() && IsInboxCandidate(p) {
+			files = append(files, p)
+		}
+		return nil
+	})
+	sort.Strings(files)
+	return files, err
+}
+
+// InboxWatcher 监听收件目录，文件在 settle 时间内没有新的写入后依次交给 handle 处理
+// 启动时先处理目录中已有的文件；新建的子目录自动加入监听
+type InboxWatcher struct {
+	root    string
+	exclude []string
+	settle  time.Duration
+	handle  func(path string)
+
+	watcher *fsnotify.Watcher
+	queue   chan string
+	done    chan struct{}
+
+	mu     sync.Mutex
+	timers map[string]*time.Timer
+}
+
+// NewInboxWatcher 创建收件目录监听，目录不存在时自动创建
+func NewInboxWatcher(root string, exclude []string, settle time.Duration, handle func(path string)) (*InboxWatcher, error) {
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, err
+	}
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	return &InboxWatcher{
+		root:    root,
+		exclude: absPaths(exclude),
+		settle:  settle,
+		handle:  handle,
+		watcher: watcher,
+		queue:   make(chan string, 1024),
+		done:    make(chan struct{}),
+		timers:  make(map[string]*time.Timer),
+	}, nil
+}
+
+// Start 开始监听并处理已有文件
+func (w *InboxWatcher) Start() error {
+	if err := w.addTree(w.root); err != nil {
+		w.watcher.Close()
+		return err
+	}
+	go w.loop()
+	go w.work()
+
+	files, err := ScanInbox(w.root, w.exclude)
+	if err != nil {
+		log.Printf("扫描收件目录失败: %v", err)
+	}
+	for _, file := range files {
+		w.schedule(file)
+	}
+	return nil
+}
+
+// Close 停止监听，正在处理的文件会处理完
+func (w *InboxWatcher) Close() error {
+	close(w.done)
+	w.mu.Lock()
+	for _, timer := range w.timers {
+		timer.Stop()
+	}
+	w.mu.Unlock()
+	return w.watcher.Close()
+}
+
+// addTree 监听目录及其所有子目录
+func (w *InboxWatcher) addTree(dir string) error {
+	return filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if p != w.root && (strings.HasPrefix(d.Name(), ".") || isExcludedDir(p, w.exclude)) {
+			return filepath.SkipDir
+		}
+		return w.watcher.Add(p)
+	})
+}
+
+func (w *InboxWatcher) loop() {
+	for {
+		select {
+		case <-w.done:
+			return
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			if !event.Has(fsnotify.Create) && !event.Has(fsnotify.Write) {
+				continue
+			}
+			info, err := os.Stat(event.Name)
+			if err != nil {
+				continue
+			}
+			if info.IsDir() {
+				// 新目录中可能已有文件（如整个文件夹移入），一并处理
+				if isExcludedDir(event.Name, w.exclude) {
+					continue
+				}
+				if err := w.addTree(event.Name); err != nil {
+					log.Printf("监听目录失败 %s: %v", event.Name, err)
+				}
+				files, _ := ScanInbox(event.Name, w.exclude)
+				for _, file := range files {
+					w.schedule(file)
+				}
+				continue
+			}
+			if info.Mode().IsRegular() && IsInboxCandidate(event.Name) {
+				w.schedule(event.Name)
+			}
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("收件目录监听错误: %v", err)
+		}
+	}
+}
+
+// schedule 文件在 settle 时间内没有新事件时加入处理队列
+func (w *InboxWatcher) schedule(path string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if timer, ok := w.timers[path]; ok {
+		timer.Reset(w.settle)
+		return
+	}
+	w.timers[path] = time.AfterFunc(w.settle, func() {
+		w.mu.Lock()
+		delete(w.timers, path)
+		w.mu.Unlock()
+		select {
+		case w.queue <- path:
+		case <-w.done:
+		}
+	})
+}
+
+// work 依次处理队列中的文件
+func (w *InboxWatcher) work() {
+	for {
+		select {
+		case <-w.done:
+			return
+		case path := <-w.queue:
+			// 同一文件可能被多次加入队列，已处理（移走）的跳过
+			if _, err := os.Stat(path); err != nil {
+				continue
+			}
+			w.handle(path)
+		}
+	}
+}
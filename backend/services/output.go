@@ -0,0 +1,146 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// OutputSettings 衍生图（缩略图、预览图、按需变换）的输出格式与各格式质量
+type OutputSettings struct {
+	ThumbnailFormat  string         // 缩略图格式: webp / avif / jpeg
+	PreviewFormat    string         // 预览图格式: webp / avif / jpeg
+	ThumbnailQuality map[string]int // 缩略图各格式质量
+	PreviewQuality   map[string]int // 预览图各格式质量
+	TransformQuality map[string]int // 按需变换未指定 q 时各格式的默认质量
+	AVIFSpeed        int            // AVIF 编码速度 0(最慢/最小)~10(最快)
+	RenditionFormat  string         // HEIC/TIFF/BMP 上传转换后的主图格式: jpeg / webp
+	RenditionQuality int            // 转换主图的质量
+	ThumbnailCrop    string         // 缩略图裁剪方式: none 等比缩放 / center / smart 裁剪为正方形
+	TransformCrop    string         // 按需变换 fit=cover 未指定 crop 时的裁剪方式: center / smart
+	Animation        AnimationSettings
+}
+
+// output 当前生效的输出配置
+var output = DefaultOutputSettings()
+
+// DefaultOutputSettings 默认配置，与引入 AVIF 之前的行为保持一致
+func DefaultOutputSettings() OutputSettings {
+	return OutputSettings{
+		ThumbnailFormat:  "webp",
+		PreviewFormat:    "webp",
+		ThumbnailQuality: map[string]int{"webp": 80, "avif": 60, "jpeg": 85},
+		PreviewQuality:   map[string]int{"webp": 75, "avif": 55, "jpeg": 80},
+		TransformQuality: map[string]int{"webp": 80, "avif": 60, "jpeg": 85},
+		AVIFSpeed:        8,
+		RenditionFormat:  "jpeg",
+		RenditionQuality: 90,
+		ThumbnailCrop:    CropNone,
+		TransformCrop:    CropCenter,
+		Animation: AnimationSettings{
+			Enabled:      true,
+			Format:       "webp",
+			MaxFrames:    300,
+			MaxDuration:  60 * time.Second,
+			MaxPixels:    200_000_000,
+			StoreMinSize: 1 << 20,
+			StoreQuality: 80,
+		},
+	}
+}
+
+// configureOutput 应用输出配置，未配置的项沿用默认值，当前构建不支持的格式回退为 WebP
+func configureOutput(settings OutputSettings) {
+	defaults := DefaultOutputSettings()
+	if settings.ThumbnailFormat == "" {
+		settings.ThumbnailFormat = defaults.ThumbnailFormat
+	}
+	if settings.PreviewFormat == "" {
+		settings.PreviewFormat = defaults.PreviewFormat
+	}
+	for _, format := range []*string{&settings.ThumbnailFormat, &settings.PreviewFormat} {
+		if !FormatSupported(*format) {
+			log.Printf("不支持的衍生图格式 %s，已回退为 webp", *format)
+			*format = "webp"
+		}
+	}
+	settings.ThumbnailQuality = mergeQualities(defaults.ThumbnailQuality, settings.ThumbnailQuality)
+	settings.PreviewQuality = mergeQualities(defaults.PreviewQuality, settings.PreviewQuality)
+	settings.TransformQuality = mergeQualities(defaults.TransformQuality, settings.TransformQuality)
+	if settings.AVIFSpeed < 0 || settings.AVIFSpeed > 10 {
+		settings.AVIFSpeed = defaults.AVIFSpeed
+	}
+	if settings.RenditionFormat != "jpeg" && settings.RenditionFormat != "webp" {
+		if settings.RenditionFormat != "" {
+			log.Printf("不支持的转换格式 %s，已回退为 jpeg", settings.RenditionFormat)
+		}
+		settings.RenditionFormat = defaults.RenditionFormat
+	}
+	if settings.RenditionQuality < 1 || settings.RenditionQuality > 100 {
+		settings.RenditionQuality = defaults.RenditionQuality
+	}
+	if settings.ThumbnailCrop != CropCenter && settings.ThumbnailCrop != CropSmart {
+		settings.ThumbnailCrop = defaults.ThumbnailCrop
+	}
+	if settings.TransformCrop != CropSmart {
+		settings.TransformCrop = defaults.TransformCrop
+	}
+	if settings.Animation.Format != "webp" && settings.Animation.Format != "gif" {
+		settings.Animation.Format = defaults.Animation.Format
+	}
+	if settings.Animation.StoreQuality < 1 || settings.Animation.StoreQuality > 100 {
+		settings.Animation.StoreQuality = defaults.Animation.StoreQuality
+	}
+	output = settings
+}
+
+func mergeQualities(defaults, overrides map[string]int) map[string]int {
+	merged := make(map[string]int, len(defaults))
+	for format, quality := range defaults {
+		merged[format] = quality
+	}
+	for format, quality := range overrides {
+		if quality >= 1 && quality <= 100 {
+			merged[format] = quality
+		}
+	}
+	return merged
+}
+
+// qualityFor 查找格式对应的质量，未配置时返回 80
+func qualityFor(qualities map[string]int, format string) int {
+	if quality, ok := qualities[format]; ok {
+		return quality
+	}
+	return 80
+}
+
+var errAVIFUnsupported = errors.New("avif encoding is not supported in this build (rebuild with -tags avif)")
+
+// formatAvailable 当前构建无法编码该格式时返回说明原因的错误
+func formatAvailable(format string) error {
+	if FormatSupported(format) {
+		return nil
+	}
+	if format == "avif" {
+		return errAVIFUnsupported
+	}
+	return fmt.Errorf("unsupported format: %s", format)
+}
+
+// FormatSupported 判断当前构建能否编码该格式
+func FormatSupported(format string) bool {
+	switch format {
+	case "webp", "jpeg", "png":
+		return true
+	case "avif":
+		return avifSupported
+	}
+	return false
+}
+
+// MimeTypeOf 输出格式对应的 MIME 类型
+func MimeTypeOf(format string) string {
+	return "image/" + format
+}
@@ -0,0 +1,67 @@
+package services
+
+import (
+	"fmt"
+	"image"
+	"math/bits"
+	"strconv"
+
+	"github.com/disintegration/imaging"
+)
+
+// 相似图片上传处理方式
+const (
+	NearDuplicateOff    = "off"    // 不检测
+	NearDuplicateWarn   = "warn"   // 正常保存，返回相似图片列表
+	NearDuplicateReject = "reject" // 拒绝上传
+)
+
+// ValidNearDuplicateMode 判断相似图片处理方式是否有效
+func ValidNearDuplicateMode(mode string) bool {
+	return mode == NearDuplicateOff || mode == NearDuplicateWarn || mode == NearDuplicateReject
+}
+
+// PerceptualHash 计算 64 位差异哈希 (dHash)
+// 缩放为 9x8 灰度图后比较每行相邻像素的明暗，对缩放、重新压缩、轻微调色不敏感
+func PerceptualHash(img image.Image) uint64 {
+	small := imaging.Resize(imaging.Grayscale(img), 9, 8, imaging.Box)
+	var hash uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			left := small.Pix[small.PixOffset(x, y)]
+			right := small.Pix[small.PixOffset(x+1, y)]
+			hash <<= 1
+			if left > right {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+// FormatPHash 将哈希格式化为 16 位十六进制字符串，用于存储
+func FormatPHash(hash uint64) string {
+	return fmt.Sprintf("%016x", hash)
+}
+
+// ParsePHash 解析存储的十六进制哈希
+func ParsePHash(s string) (uint64, error) {
+	if len(s) != 16 {
+		return 0, fmt.Errorf("invalid perceptual hash: %q", s)
+	}
+	return strconv.ParseUint(s, 16, 64)
+}
+
+// HammingDistance 两个哈希不同的位数，0 表示几乎相同，大于 10 通常为不同图片
+func HammingDistance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// PerceptualHashBytes 解码图片数据并计算感知哈希（按 EXIF 方向校正）
+func (s *ImageService) PerceptualHashBytes(data []byte) (string, error) {
+	img, err := s.decodeOriented(data)
+	if err != nil {
+		return "", err
+	}
+	return FormatPHash(PerceptualHash(img)), nil
+}
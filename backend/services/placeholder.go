@@ -0,0 +1,229 @@
+package services
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/disintegration/imaging"
+)
+
+// BlurHash 分量数，4x3 在 20~30 个字符内能表现大致构图
+const (
+	blurHashXComponents = 4
+	blurHashYComponents = 3
+)
+
+// 主色调数量
+const paletteSize = 5
+
+// Placeholder 图片占位信息
+type Placeholder struct {
+	BlurHash string
+	Palette  []string // 主色调，按占比从高到低，格式 #rrggbb
+	Dominant *Lab     // 占比最高颜色的 CIELAB 值，用于按颜色搜索；全透明图片为 nil
+}
+
+// ComputePlaceholder 计算 BlurHash 与主色调
+func ComputePlaceholder(img image.Image) Placeholder {
+	// 缩小后计算，结果与原图几乎一致
+	small := imaging.Fit(img, 64, 64, imaging.Box)
+	placeholder := Placeholder{
+		BlurHash: encodeBlurHash(small, blurHashXComponents, blurHashYComponents),
+		Palette:  dominantColors(small, paletteSize),
+	}
+	if len(placeholder.Palette) > 0 {
+		if lab, err := ParseColorLab(placeholder.Palette[0]); err == nil {
+			placeholder.Dominant = &lab
+		}
+	}
+	return placeholder
+}
+
+// ImageFeatures 可由图片内容重新计算的特征
+type ImageFeatures struct {
+	PHash       string
+	Placeholder Placeholder
+}
+
+// ImageFeaturesOf 解码图片数据并计算感知哈希与占位信息（按 EXIF 方向校正），用于回填历史图片
+func (s *ImageService) ImageFeaturesOf(data []byte) (ImageFeatures, error) {
+	img, err := s.decodeOriented(data)
+	if err != nil {
+		return ImageFeatures{}, err
+	}
+	return ImageFeatures{
+		PHash:       FormatPHash(PerceptualHash(img)),
+		Placeholder: ComputePlaceholder(img),
+	}, nil
+}
+
+// encodeBlurHash 按 https://github.com/woltapp/blurhash 的算法编码
+func encodeBlurHash(img *image.NRGBA, xComponents, yComponents int) string {
+	width, height := img.Bounds().Dx(), img.Bounds().Dy()
+
+	// 预先转换为线性 RGB，透明像素按黑色背景合成
+	linear := make([][3]float64, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			i := img.PixOffset(x, y)
+			alpha := float64(img.Pix[i+3]) / 255
+			for c := 0; c < 3; c++ {
+				linear[y*width+x][c] = sRGBToLinear(int(float64(img.Pix[i+c])*alpha + 0.5))
+			}
+		}
+	}
+
+	factors := make([][3]float64, 0, xComponents*yComponents)
+	for j := 0; j < yComponents; j++ {
+		for i := 0; i < xComponents; i++ {
+			normalisation := 2.0
+			if i == 0 && j == 0 {
+				normalisation = 1
+			}
+			var factor [3]float64
+			for y := 0; y < height; y++ {
+				basisY := math.Cos(math.Pi * float64(j) * float64(y) / float64(height))
+				for x := 0; x < width; x++ {
+					basis := normalisation * math.Cos(math.Pi*float64(i)*float64(x)/float64(width)) * basisY
+					pixel := linear[y*width+x]
+					factor[0] += basis * pixel[0]
+					factor[1] += basis * pixel[1]
+					factor[2] += basis * pixel[2]
+				}
+			}
+			scale := 1 / float64(width*height)
+			factors = append(factors, [3]float64{factor[0] * scale, factor[1] * scale, factor[2] * scale})
+		}
+	}
+
+	var hash strings.Builder
+	hash.WriteString(encodeBase83((xComponents-1)+(yComponents-1)*9, 1))
+
+	dc, ac := factors[0], factors[1:]
+	maximumValue := 1.0
+	if len(ac) > 0 {
+		actualMaximum := 0.0
+		for _, factor := range ac {
+			for _, v := range factor {
+				actualMaximum = math.Max(actualMaximum, math.Abs(v))
+			}
+		}
+		quantisedMaximum := int(math.Max(0, math.Min(82, math.Floor(actualMaximum*166-0.5))))
+		maximumValue = float64(quantisedMaximum+1) / 166
+		hash.WriteString(encodeBase83(quantisedMaximum, 1))
+	} else {
+		hash.WriteString(encodeBase83(0, 1))
+	}
+
+	dcValue := linearToSRGB(dc[0])<<16 + linearToSRGB(dc[1])<<8 + linearToSRGB(dc[2])
+	hash.WriteString(encodeBase83(dcValue, 4))
+	for _, factor := range ac {
+		quant := func(v float64) int {
+			return int(math.Max(0, math.Min(18, math.Floor(signPow(v/maximumValue, 0.5)*9+9.5))))
+		}
+		hash.WriteString(encodeBase83(quant(factor[0])*19*19+quant(factor[1])*19+quant(factor[2]), 2))
+	}
+	return hash.String()
+}
+
+const base83Chars = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+
+func encodeBase83(value, length int) string {
+	result := make([]byte, length)
+	for i := 1; i <= length; i++ {
+		digit := (value / int(math.Pow(83, float64(length-i)))) % 83
+		result[i-1] = base83Chars[digit]
+	}
+	return string(result)
+}
+
+func sRGBToLinear(value int) float64 {
+	v := float64(value) / 255
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+func linearToSRGB(value float64) int {
+	v := math.Max(0, math.Min(1, value))
+	if v <= 0.0031308 {
+		return int(v*12.92*255 + 0.5)
+	}
+	return int((1.055*math.Pow(v, 1/2.4)-0.055)*255 + 0.5)
+}
+
+func signPow(value, exp float64) float64 {
+	return math.Copysign(math.Pow(math.Abs(value), exp), value)
+}
+
+// dominantColors 统计主色调
+// 按每通道 4 位量化后统计像素数，取占比最高的颜色并合并过于接近的颜色
+func dominantColors(img *image.NRGBA, n int) []string {
+	type bucket struct {
+		count   int
+		r, g, b int
+	}
+	buckets := make(map[int]*bucket)
+	bounds := img.Bounds()
+	for y := 0; y < bounds.Dy(); y++ {
+		for x := 0; x < bounds.Dx(); x++ {
+			i := img.PixOffset(x, y)
+			// 忽略大部分透明的像素
+			if img.Pix[i+3] < 128 {
+				continue
+			}
+			r, g, b := int(img.Pix[i]), int(img.Pix[i+1]), int(img.Pix[i+2])
+			key := r>>4<<8 | g>>4<<4 | b>>4
+			bk := buckets[key]
+			if bk == nil {
+				bk = &bucket{}
+				buckets[key] = bk
+			}
+			bk.count++
+			bk.r += r
+			bk.g += g
+			bk.b += b
+		}
+	}
+
+	sorted := make([]*bucket, 0, len(buckets))
+	for _, bk := range buckets {
+		sorted = append(sorted, bk)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].count != sorted[j].count {
+			return sorted[i].count > sorted[j].count
+		}
+		return sorted[i].r+sorted[i].g+sorted[i].b < sorted[j].r+sorted[j].g+sorted[j].b
+	})
+
+	var picked [][3]int
+	for _, bk := range sorted {
+		color := [3]int{bk.r / bk.count, bk.g / bk.count, bk.b / bk.count}
+		similar := false
+		for _, p := range picked {
+			dr, dg, db := color[0]-p[0], color[1]-p[1], color[2]-p[2]
+			if dr*dr+dg*dg+db*db < 32*32 {
+				similar = true
+				break
+			}
+		}
+		if similar {
+			continue
+		}
+		picked = append(picked, color)
+		if len(picked) == n {
+			break
+		}
+	}
+
+	palette := make([]string, len(picked))
+	for i, p := range picked {
+		palette[i] = fmt.Sprintf("#%02x%02x%02x", p[0], p[1], p[2])
+	}
+	return palette
+}
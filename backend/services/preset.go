@@ -0,0 +1,206 @@
+package services
+
+import (
+	"fmt"
+	"image"
+	"log"
+	"regexp"
+	"slices"
+	"sync/atomic"
+
+	"oneimg/backend/models"
+)
+
+// 内置预设，文件名沿用原有的 name_thumb.ext 与 name_preview.webp
+const (
+	PresetThumb   = "thumb"
+	PresetPreview = "preview"
+)
+
+// 预设尺寸上限
+const maxPresetSize = 8192
+
+var presetNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,31}$`)
+
+// reservedPresetNames 已被其他衍生文件占用的后缀
+var reservedPresetNames = []string{"source"}
+
+// presets 当前生效的预设，未加载时使用 DefaultPresets
+var presets atomic.Pointer[[]models.ImagePreset]
+
+// DefaultPresets 内置的缩略图与预览图预设，格式与质量取自输出配置
+func DefaultPresets() []models.ImagePreset {
+	thumb := models.ImagePreset{
+		Name:    PresetThumb,
+		Width:   300,
+		Height:  300,
+		Fit:     "contain",
+		Format:  output.ThumbnailFormat,
+		Quality: qualityFor(output.ThumbnailQuality, output.ThumbnailFormat),
+	}
+	if output.ThumbnailCrop != CropNone {
+		thumb.Fit, thumb.Crop = "cover", output.ThumbnailCrop
+	}
+	preview := models.ImagePreset{
+		Name:    PresetPreview,
+		Width:   1920,
+		Height:  1080,
+		Fit:     "contain",
+		Format:  output.PreviewFormat,
+		Quality: qualityFor(output.PreviewQuality, output.PreviewFormat),
+	}
+	return []models.ImagePreset{thumb, preview}
+}
+
+// NormalizePresets 校验预设并补全默认值，缺少的内置预设使用默认配置
+func NormalizePresets(list []models.ImagePreset) ([]models.ImagePreset, error) {
+	normalized := make([]models.ImagePreset, 0, len(list)+2)
+	seen := make(map[string]bool)
+	for _, preset := range list {
+		if !presetNamePattern.MatchString(preset.Name) || slices.Contains(reservedPresetNames, preset.Name) {
+			return nil, fmt.Errorf("invalid preset name: %q", preset.Name)
+		}
+		if seen[preset.Name] {
+			return nil, fmt.Errorf("duplicate preset: %s", preset.Name)
+		}
+		seen[preset.Name] = true
+
+		if preset.Width < 1 || preset.Height < 1 || preset.Width > maxPresetSize || preset.Height > maxPresetSize {
+			return nil, fmt.Errorf("preset %s: size must be within 1~%d", preset.Name, maxPresetSize)
+		}
+		if preset.Fit == "" {
+			preset.Fit = "contain"
+		}
+		if !slices.Contains(transformFits, preset.Fit) {
+			return nil, fmt.Errorf("preset %s: unsupported fit: %s", preset.Name, preset.Fit)
+		}
+		if preset.Fit != "cover" {
+			preset.Crop = ""
+		} else if preset.Crop == "" {
+			preset.Crop = CropCenter
+		} else if !slices.Contains(transformCrops, preset.Crop) {
+			return nil, fmt.Errorf("preset %s: unsupported crop: %s", preset.Name, preset.Crop)
+		}
+		if preset.Format == "" {
+			preset.Format = "webp"
+		}
+		if !slices.Contains(transformFormats, preset.Format) {
+			return nil, fmt.Errorf("preset %s: unsupported format: %s", preset.Name, preset.Format)
+		}
+		if err := formatAvailable(preset.Format); err != nil {
+			return nil, fmt.Errorf("preset %s: %v", preset.Name, err)
+		}
+		if preset.Quality == 0 {
+			preset.Quality = qualityFor(output.TransformQuality, preset.Format)
+		}
+		if preset.Quality < 1 || preset.Quality > 100 {
+			return nil, fmt.Errorf("preset %s: quality must be within 1~100", preset.Name)
+		}
+		normalized = append(normalized, preset)
+	}
+
+	// 缩略图与预览图必须存在
+	for i, preset := range DefaultPresets() {
+		if !seen[preset.Name] {
+			normalized = slices.Insert(normalized, min(i, len(normalized)), preset)
+		}
+	}
+	return normalized, nil
+}
+
+// SetPresets 校验并应用预设
+func SetPresets(list []models.ImagePreset) error {
+	normalized, err := NormalizePresets(list)
+	if err != nil {
+		return err
+	}
+	presets.Store(&normalized)
+	return nil
+}
+
+// CurrentPresets 当前生效的预设（含内置预设）
+func CurrentPresets() []models.ImagePreset {
+	if list := presets.Load(); list != nil {
+		return *list
+	}
+	return DefaultPresets()
+}
+
+// FindPreset 按名称查找预设
+func FindPreset(name string) (models.ImagePreset, bool) {
+	for _, preset := range CurrentPresets() {
+		if preset.Name == name {
+			return preset, true
+		}
+	}
+	return models.ImagePreset{}, false
+}
+
+// IsBuiltinPreset 是否为内置的缩略图或预览图预设
+func IsBuiltinPreset(name string) bool {
+	return name == PresetThumb || name == PresetPreview
+}
+
+// PresetExt 预设输出格式对应的扩展名
+func PresetExt(format string) string {
+	if format == "jpeg" {
+		return ".jpg"
+	}
+	return "." + format
+}
+
+// renderPreset 按预设缩放并编码，除缩略图外按水印配置写入水印
+func (s *ImageService) renderPreset(img image.Image, preset models.ImagePreset, wm *Watermark) ([]byte, error) {
+	resized := s.resize(img, TransformOptions{Width: preset.Width, Height: preset.Height, Fit: preset.Fit, Crop: preset.Crop})
+	if preset.Name != PresetThumb && wm.BakePreview() {
+		resized = wm.Apply(resized)
+	}
+	return s.encodeImage(resized, preset.Format, preset.Quality)
+}
+
+// PresetRendition 按预设生成的衍生图
+type PresetRendition struct {
+	Preset models.ImagePreset
+	Bytes  []byte
+}
+
+// renderCustomPresets 生成内置预设以外的所有预设，单个预设失败时跳过
+func (s *ImageService) renderCustomPresets(img image.Image, wm *Watermark) []PresetRendition {
+	var renditions []PresetRendition
+	for _, preset := range CurrentPresets() {
+		if IsBuiltinPreset(preset.Name) {
+			continue
+		}
+		data, err := s.renderPreset(img, preset, wm)
+		if err != nil {
+			log.Printf("生成预设 %s 失败: %v", preset.Name, err)
+			continue
+		}
+		renditions = append(renditions, PresetRendition{Preset: preset, Bytes: data})
+	}
+	return renditions
+}
+
+// RenderPresets 由原图重新生成指定预设，用于预设变更后的批量重建
+// 多帧 GIF 的缩略图与预览图保留上传时生成的动图，不在此重建
+func (s *ImageService) RenderPresets(data []byte, list []models.ImagePreset) ([]PresetRendition, error) {
+	img, err := s.decodeOriented(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %v", err)
+	}
+	animated := output.Animation.Enabled && isAnimatedGIF(data)
+	wm := CurrentWatermark()
+
+	var renditions []PresetRendition
+	for _, preset := range list {
+		if animated && IsBuiltinPreset(preset.Name) {
+			continue
+		}
+		encoded, err := s.renderPreset(img, preset, wm)
+		if err != nil {
+			return renditions, fmt.Errorf("preset %s: %v", preset.Name, err)
+		}
+		renditions = append(renditions, PresetRendition{Preset: preset, Bytes: encoded})
+	}
+	return renditions, nil
+}
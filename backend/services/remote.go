@@ -0,0 +1,179 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"path"
+	"syscall"
+	"time"
+)
+
+// 远程下载失败的原因
+const (
+	RejectInvalidURL     = "invalid_url"
+	RejectBlockedAddress = "blocked_address"
+	RejectFetchFailed    = "fetch_failed"
+	RejectFetchTimeout   = "fetch_timeout"
+)
+
+// 远程下载最多跟随的重定向次数
+const maxRemoteRedirects = 5
+
+var errBlockedAddress = errors.New("target address is not allowed")
+
+// blockedPrefixes 除回环、私有、链路本地、组播地址外同样禁止访问的保留网段
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"), // 运营商级 NAT
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("192.0.2.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("198.51.100.0/24"),
+	netip.MustParsePrefix("203.0.113.0/24"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"), // NAT64 可映射到内网 IPv4
+	netip.MustParsePrefix("2001:db8::/32"),
+}
+
+// RemoteFetchOptions 远程图片下载限制
+type RemoteFetchOptions struct {
+	MaxSize      int64
+	Timeout      time.Duration // 包含连接、等待响应与读取响应体的总时长
+	AllowPrivate bool          // 允许访问内网地址，仅用于测试或内网部署
+
+	// allowed 即使属于内网也允许访问的网段，供测试访问本机 httptest 服务
+	allowed []netip.Prefix
+}
+
+// RemoteImage 下载得到的远程图片
+type RemoteImage struct {
+	Data     []byte
+	FileName string // 取自最终地址的路径
+}
+
+// isBlockedIP 判断地址是否属于禁止访问的内网或保留地址
+func isBlockedIP(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return true
+	}
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// newRemoteClient 创建下载用的 HTTP 客户端
+// 在建立连接时检查解析后的 IP，重定向与 DNS 重绑定同样受限；不使用环境变量中的代理
+func newRemoteClient(opts RemoteFetchOptions) *http.Client {
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	if !opts.AllowPrivate {
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip, err := netip.ParseAddr(host)
+			if err != nil {
+				return errBlockedAddress
+			}
+			for _, prefix := range opts.allowed {
+				if prefix.Contains(ip.Unmap()) {
+					return nil
+				}
+			}
+			if isBlockedIP(ip) {
+				return errBlockedAddress
+			}
+			return nil
+		}
+	}
+
+	return &http.Client{
+		Timeout: opts.Timeout,
+		Transport: &http.Transport{
+			Proxy:                 nil,
+			DialContext:           dialer.DialContext,
+			TLSHandshakeTimeout:   5 * time.Second,
+			ResponseHeaderTimeout: min(opts.Timeout, 10*time.Second),
+			MaxIdleConns:          1,
+			DisableKeepAlives:     true,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > maxRemoteRedirects {
+				return errors.New("too many redirects")
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return fmt.Errorf("unsupported redirect scheme: %s", req.URL.Scheme)
+			}
+			return nil
+		},
+	}
+}
+
+// FetchRemoteImage 下载远程图片，失败时返回 *UploadRejection
+func FetchRemoteImage(ctx context.Context, rawURL string, opts RemoteFetchOptions) (*RemoteImage, error) {
+	target, err := url.Parse(rawURL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return nil, rejectUpload(RejectInvalidURL, "无效的图片地址: %s", rawURL)
+	}
+	if target.User != nil {
+		return nil, rejectUpload(RejectInvalidURL, "图片地址不能包含用户名或密码")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+	if err != nil {
+		return nil, rejectUpload(RejectInvalidURL, "无效的图片地址: %v", err)
+	}
+	req.Header.Set("Accept", "image/*")
+	req.Header.Set("User-Agent", "oneimg")
+
+	resp, err := newRemoteClient(opts).Do(req)
+	if err != nil {
+		return nil, remoteFetchError(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, rejectUpload(RejectFetchFailed, "远程服务器返回 %d", resp.StatusCode)
+	}
+	if opts.MaxSize > 0 && resp.ContentLength > opts.MaxSize {
+		return nil, rejectUpload(RejectFileTooLarge, "文件大小超出限制 (最大 %d 字节)", opts.MaxSize)
+	}
+
+	reader := io.Reader(resp.Body)
+	if opts.MaxSize > 0 {
+		reader = io.LimitReader(resp.Body, opts.MaxSize+1)
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, remoteFetchError(err)
+	}
+	if opts.MaxSize > 0 && int64(len(data)) > opts.MaxSize {
+		return nil, rejectUpload(RejectFileTooLarge, "文件大小超出限制 (最大 %d 字节)", opts.MaxSize)
+	}
+
+	return &RemoteImage{Data: data, FileName: path.Base(resp.Request.URL.Path)}, nil
+}
+
+// remoteFetchError 将下载错误转换为拒绝原因
+func remoteFetchError(err error) *UploadRejection {
+	var netErr net.Error
+	switch {
+	case errors.Is(err, errBlockedAddress):
+		return rejectUpload(RejectBlockedAddress, "不允许访问内网或保留地址")
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		return rejectUpload(RejectFetchTimeout, "下载超时")
+	default:
+		return rejectUpload(RejectFetchFailed, "下载失败: %v", err)
+	}
+}
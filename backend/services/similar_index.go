@@ -0,0 +1,216 @@
+package services
+
+import (
+	"container/heap"
+	"sort"
+	"sync"
+)
+
+// SimilarMatch 相似图片查询结果
+type SimilarMatch struct {
+	ImageID  int
+	Distance int
+}
+
+// bkNode BK 树节点，子节点按与当前节点哈希的汉明距离索引
+type bkNode struct {
+	hash     uint64
+	ids      []int // 哈希完全相同的图片共用一个节点
+	children map[int]*bkNode
+}
+
+// SimilarIndex 基于 BK 树的感知哈希内存索引
+// 利用汉明距离的三角不等式剪枝，10 万级图片库的近邻查询只需访问少量节点
+type SimilarIndex struct {
+	mu     sync.RWMutex
+	root   *bkNode
+	hashes map[int]uint64 // 图片 ID -> 哈希，用于删除与按 ID 查询
+	nodes  map[uint64]*bkNode
+}
+
+// Similar 全局相似图片索引
+var Similar = NewSimilarIndex()
+
+// NewSimilarIndex 创建空索引
+func NewSimilarIndex() *SimilarIndex {
+	return &SimilarIndex{
+		hashes: make(map[int]uint64),
+		nodes:  make(map[uint64]*bkNode),
+	}
+}
+
+// Len 已索引的图片数量
+func (idx *SimilarIndex) Len() int {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return len(idx.hashes)
+}
+
+// Hash 返回已索引图片的哈希
+func (idx *SimilarIndex) Hash(imageID int) (uint64, bool) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	hash, ok := idx.hashes[imageID]
+	return hash, ok
+}
+
+// Add 添加或更新图片的哈希
+func (idx *SimilarIndex) Add(imageID int, hash uint64) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if old, ok := idx.hashes[imageID]; ok {
+		if old == hash {
+			return
+		}
+		idx.removeLocked(imageID, old)
+	}
+	idx.hashes[imageID] = hash
+
+	if node, ok := idx.nodes[hash]; ok {
+		node.ids = append(node.ids, imageID)
+		return
+	}
+	node := &bkNode{hash: hash, ids: []int{imageID}}
+	idx.nodes[hash] = node
+	if idx.root == nil {
+		idx.root = node
+		return
+	}
+	current := idx.root
+	for {
+		distance := HammingDistance(current.hash, hash)
+		child, ok := current.children[distance]
+		if !ok {
+			if current.children == nil {
+				current.children = make(map[int]*bkNode)
+			}
+			current.children[distance] = node
+			return
+		}
+		current = child
+	}
+}
+
+// Remove 从索引中移除图片
+// BK 树不便删除节点，节点没有图片后仍保留用于路由，查询时跳过
+func (idx *SimilarIndex) Remove(imageID int) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if hash, ok := idx.hashes[imageID]; ok {
+		idx.removeLocked(imageID, hash)
+	}
+}
+
+func (idx *SimilarIndex) removeLocked(imageID int, hash uint64) {
+	delete(idx.hashes, imageID)
+	node := idx.nodes[hash]
+	if node == nil {
+		return
+	}
+	for i, id := range node.ids {
+		if id == imageID {
+			node.ids = append(node.ids[:i], node.ids[i+1:]...)
+			break
+		}
+	}
+}
+
+// Within 查询与 hash 的距离不超过 maxDistance 的所有图片，按距离升序
+func (idx *SimilarIndex) Within(hash uint64, maxDistance int) []SimilarMatch {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	var matches []SimilarMatch
+	if idx.root == nil {
+		return matches
+	}
+	stack := []*bkNode{idx.root}
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		distance := HammingDistance(node.hash, hash)
+		if distance <= maxDistance {
+			for _, id := range node.ids {
+				matches = append(matches, SimilarMatch{ImageID: id, Distance: distance})
+			}
+		}
+		for d, child := range node.children {
+			if d >= distance-maxDistance && d <= distance+maxDistance {
+				stack = append(stack, child)
+			}
+		}
+	}
+	sortMatches(matches)
+	return matches
+}
+
+// Nearest 查询距离最近的 n 张图片（不超过 maxDistance），exclude 中的图片不参与结果
+// 结果数量达到 n 后以当前第 n 近的距离收缩搜索半径
+func (idx *SimilarIndex) Nearest(hash uint64, n, maxDistance int, exclude map[int]bool) []SimilarMatch {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	if idx.root == nil || n <= 0 {
+		return []SimilarMatch{}
+	}
+	best := &matchHeap{}
+	radius := maxDistance
+	stack := []*bkNode{idx.root}
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		distance := HammingDistance(node.hash, hash)
+		if distance <= radius {
+			for _, id := range node.ids {
+				if exclude[id] {
+					continue
+				}
+				heap.Push(best, SimilarMatch{ImageID: id, Distance: distance})
+				if best.Len() > n {
+					heap.Pop(best)
+				}
+			}
+			if best.Len() == n {
+				radius = (*best)[0].Distance
+			}
+		}
+		for d, child := range node.children {
+			if d >= distance-radius && d <= distance+radius {
+				stack = append(stack, child)
+			}
+		}
+	}
+
+	matches := make([]SimilarMatch, best.Len())
+	copy(matches, *best)
+	sortMatches(matches)
+	return matches
+}
+
+func sortMatches(matches []SimilarMatch) {
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Distance != matches[j].Distance {
+			return matches[i].Distance < matches[j].Distance
+		}
+		return matches[i].ImageID < matches[j].ImageID
+	})
+}
+
+// matchHeap 按距离的大顶堆，堆顶为当前结果中最远的图片
+type matchHeap []SimilarMatch
+
+func (h matchHeap) Len() int { return len(h) }
+func (h matchHeap) Less(i, j int) bool {
+	if h[i].Distance != h[j].Distance {
+		return h[i].Distance > h[j].Distance
+	}
+	return h[i].ImageID > h[j].ImageID
+}
+func (h matchHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *matchHeap) Push(x interface{}) { *h = append(*h, x.(SimilarMatch)) }
+func (h *matchHeap) Pop() interface{} {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
@@ -0,0 +1,121 @@
+package services
+
+import (
+	"image"
+	"math"
+
+	"github.com/disintegration/imaging"
+)
+
+// 裁剪方式
+const (
+	CropNone   = "none"   // 不裁剪，等比缩放至框内（仅缩略图）
+	CropCenter = "center" // 居中裁剪
+	CropSmart  = "smart"  // 按内容显著性选择裁剪区域
+)
+
+// 显著性分析时缩小到的最长边，足以区分主体位置
+const smartCropAnalysisSize = 160
+
+// SmartCropRect 在图片中寻找宽高比为 width:height 的最大区域里内容最丰富的位置
+// 显著性以亮度梯度（边缘密度）为主，饱和度为辅，并略微偏向画面中心
+func SmartCropRect(img image.Image, width, height int) image.Rectangle {
+	bounds := img.Bounds()
+	srcW, srcH := bounds.Dx(), bounds.Dy()
+
+	// 裁剪框只在一个方向上滑动：原图更宽时横向，更高时纵向
+	cropW, cropH := srcW, srcH
+	horizontal := srcW*height > srcH*width
+	if horizontal {
+		cropW = max(1, int(math.Round(float64(srcH)*float64(width)/float64(height))))
+	} else {
+		cropH = max(1, int(math.Round(float64(srcW)*float64(height)/float64(width))))
+	}
+	if cropW == srcW && cropH == srcH {
+		return bounds
+	}
+
+	small := imaging.Fit(img, smartCropAnalysisSize, smartCropAnalysisSize, imaging.Box)
+	energy := saliencyProfile(small, horizontal)
+
+	// 前缀和计算每个位置的显著性总和
+	scale := float64(srcW) / float64(small.Bounds().Dx())
+	window := cropW
+	span := srcW
+	if !horizontal {
+		scale = float64(srcH) / float64(small.Bounds().Dy())
+		window, span = cropH, srcH
+	}
+	n := len(energy)
+	win := min(n, max(1, int(math.Round(float64(window)/scale))))
+	prefix := make([]float64, n+1)
+	for i, e := range energy {
+		prefix[i+1] = prefix[i] + e
+	}
+
+	best, bestScore := (n-win)/2, -1.0
+	for pos := 0; pos+win <= n; pos++ {
+		score := prefix[pos+win] - prefix[pos]
+		// 中心偏置：离中心越远得分越低，最多降低 20%
+		if n > win {
+			offset := math.Abs(float64(pos)+float64(win)/2-float64(n)/2) / (float64(n-win) / 2)
+			score *= 1 - 0.2*offset
+		}
+		if score > bestScore {
+			best, bestScore = pos, score
+		}
+	}
+
+	start := min(max(0, int(math.Round(float64(best)*scale))), span-window)
+	if horizontal {
+		return image.Rect(bounds.Min.X+start, bounds.Min.Y, bounds.Min.X+start+cropW, bounds.Max.Y)
+	}
+	return image.Rect(bounds.Min.X, bounds.Min.Y+start, bounds.Max.X, bounds.Min.Y+start+cropH)
+}
+
+// saliencyProfile 计算每列（horizontal）或每行的显著性之和
+func saliencyProfile(img *image.NRGBA, horizontal bool) []float64 {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	luma := make([]float64, w*h)
+	saturation := make([]float64, w*h)
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			i := img.PixOffset(x, y)
+			alpha := float64(img.Pix[i+3]) / 255
+			r, g, b := float64(img.Pix[i])*alpha, float64(img.Pix[i+1])*alpha, float64(img.Pix[i+2])*alpha
+			luma[y*w+x] = 0.299*r + 0.587*g + 0.114*b
+			saturation[y*w+x] = max(r, g, b) - min(r, g, b)
+		}
+	}
+
+	profile := make([]float64, w)
+	if !horizontal {
+		profile = make([]float64, h)
+	}
+	at := func(x, y int) float64 {
+		return luma[min(max(y, 0), h-1)*w+min(max(x, 0), w-1)]
+	}
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			// Sobel 梯度幅值
+			gx := at(x+1, y-1) + 2*at(x+1, y) + at(x+1, y+1) - at(x-1, y-1) - 2*at(x-1, y) - at(x-1, y+1)
+			gy := at(x-1, y+1) + 2*at(x, y+1) + at(x+1, y+1) - at(x-1, y-1) - 2*at(x, y-1) - at(x+1, y-1)
+			value := math.Hypot(gx, gy) + 0.5*saturation[y*w+x]
+			if horizontal {
+				profile[x] += value
+			} else {
+				profile[y] += value
+			}
+		}
+	}
+	return profile
+}
+
+// fillImage 等比缩放并裁剪为 width x height，不放大原图：原图不足时按比例缩小目标尺寸
+func fillImage(img image.Image, width, height int, crop string) *image.NRGBA {
+	width, height = shrinkToSource(width, height, img.Bounds())
+	if crop == CropSmart {
+		return imaging.Resize(imaging.Crop(img, SmartCropRect(img, width, height)), width, height, imaging.Lanczos)
+	}
+	return imaging.Fill(img, width, height, imaging.Center, imaging.Lanczos)
+}
@@ -0,0 +1,238 @@
+package services
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"math"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/srwiley/oksvg"
+	"github.com/srwiley/rasterx"
+)
+
+// SVG 栅格化时长边的像素数，缩略图、预览图与按需变换都基于该尺寸的位图
+const svgRasterSize = 2048
+
+// svgBlockedElements 连同子节点整体移除的元素（小写）
+var svgBlockedElements = []string{
+	"script", "foreignobject", "iframe", "embed", "object",
+	"audio", "video", "handler", "listener",
+}
+
+// svgAnimationElements 可以通过 attributeName 改写其他属性的动画元素（小写）
+var svgAnimationElements = []string{"set", "animate", "animatemotion", "animatetransform", "animatecolor"}
+
+// svgInlineImagePattern <image> 允许的内嵌位图
+var svgInlineImagePattern = regexp.MustCompile(`^data:image/(png|jpeg|gif|webp);base64,`)
+
+var cssURLPattern = regexp.MustCompile(`(?i)url\(\s*['"]?\s*([^'")\s]*)`)
+
+var (
+	svgTextEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+	svgAttrEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;")
+)
+
+// isSVG 判断数据是否为 SVG 文档（文本格式，没有固定的魔数）
+func isSVG(data []byte) bool {
+	head := data[:min(len(data), 1024)]
+	head = bytes.TrimPrefix(head, []byte("\xef\xbb\xbf"))
+	head = bytes.TrimLeft(head, " \t\r\n")
+	return bytes.HasPrefix(head, []byte("<")) && bytes.Contains(head, []byte("<svg"))
+}
+
+// SanitizeSVG 清理 SVG 中的脚本、事件属性、外部引用与 foreignObject
+// 注释、处理指令与 DOCTYPE（含实体声明）一并移除，根元素不是 <svg> 时返回错误
+func SanitizeSVG(data []byte) ([]byte, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	decoder.Strict = true
+
+	var out bytes.Buffer
+	depth, skipDepth, styleDepth := 0, 0, 0
+	rooted := false
+	for {
+		token, err := decoder.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid svg: %v", err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			depth++
+			if skipDepth > 0 {
+				continue
+			}
+			local := strings.ToLower(t.Name.Local)
+			if !rooted {
+				if local != "svg" {
+					return nil, errors.New("invalid svg: root element is not <svg>")
+				}
+				rooted = true
+			} else if depth == 1 {
+				return nil, errors.New("invalid svg: multiple root elements")
+			}
+			if slices.Contains(svgBlockedElements, local) || (slices.Contains(svgAnimationElements, local) && animatesUnsafeAttr(t.Attr)) {
+				skipDepth = depth
+				continue
+			}
+			if local == "style" {
+				styleDepth = depth
+			}
+			out.WriteString("<" + qualifiedName(t.Name))
+			for _, attr := range t.Attr {
+				if safeSVGAttr(local, attr) {
+					out.WriteString(" " + qualifiedName(attr.Name) + `="` + svgAttrEscaper.Replace(attr.Value) + `"`)
+				}
+			}
+			out.WriteString(">")
+		case xml.EndElement:
+			if skipDepth == 0 {
+				out.WriteString("</" + qualifiedName(t.Name) + ">")
+			}
+			if depth == skipDepth {
+				skipDepth = 0
+			}
+			if depth == styleDepth {
+				styleDepth = 0
+			}
+			depth--
+		case xml.CharData:
+			if skipDepth > 0 || depth == 0 {
+				continue
+			}
+			// 样式表中包含外部引用时整段丢弃
+			if styleDepth > 0 && unsafeCSS(string(t)) {
+				continue
+			}
+			out.WriteString(svgTextEscaper.Replace(string(t)))
+		}
+	}
+	if !rooted {
+		return nil, errors.New("invalid svg: no <svg> element")
+	}
+	return out.Bytes(), nil
+}
+
+// qualifiedName 还原 RawToken 中带前缀的名称
+func qualifiedName(name xml.Name) string {
+	if name.Space == "" {
+		return name.Local
+	}
+	return name.Space + ":" + name.Local
+}
+
+// safeSVGAttr 判断属性是否可以保留
+func safeSVGAttr(element string, attr xml.Attr) bool {
+	local := strings.ToLower(attr.Name.Local)
+	value := strings.TrimSpace(attr.Value)
+	switch {
+	case strings.HasPrefix(local, "on"):
+		return false
+	case attr.Name.Space == "xml" && local == "base":
+		return false
+	case local == "href":
+		// 只允许文档内引用，<image> 另外允许内嵌位图
+		return strings.HasPrefix(value, "#") || (element == "image" && svgInlineImagePattern.MatchString(value))
+	case containsJavaScriptURL(value):
+		return false
+	case local == "style":
+		return !unsafeCSS(value)
+	}
+	return !hasExternalURL(value)
+}
+
+// animatesUnsafeAttr 动画元素是否会改写链接或事件属性
+func animatesUnsafeAttr(attrs []xml.Attr) bool {
+	for _, attr := range attrs {
+		if attr.Name.Local == "attributeName" {
+			target := strings.ToLower(strings.TrimSpace(attr.Value))
+			return strings.HasSuffix(target, "href") || strings.HasPrefix(target, "on")
+		}
+	}
+	return false
+}
+
+// containsJavaScriptURL 忽略空白与大小写检查 javascript: 协议
+func containsJavaScriptURL(value string) bool {
+	compact := strings.Map(func(r rune) rune {
+		if r == ' ' || r == '\t' || r == '\r' || r == '\n' {
+			return -1
+		}
+		return r
+	}, strings.ToLower(value))
+	return strings.Contains(compact, "javascript:")
+}
+
+// hasExternalURL 检查 url(...) 是否引用文档外的资源
+func hasExternalURL(value string) bool {
+	for _, match := range cssURLPattern.FindAllStringSubmatch(value, -1) {
+		if !strings.HasPrefix(match[1], "#") {
+			return true
+		}
+	}
+	return false
+}
+
+// unsafeCSS 样式中是否包含外部引用或脚本
+func unsafeCSS(css string) bool {
+	lower := strings.ToLower(css)
+	return strings.Contains(lower, "@import") || strings.Contains(lower, "expression(") ||
+		strings.Contains(lower, "-moz-binding") || strings.Contains(lower, "behavior:") ||
+		containsJavaScriptURL(lower) || hasExternalURL(css)
+}
+
+// loadSVGIcon 解析 SVG，解析器遇到异常输入时可能 panic
+func loadSVGIcon(data []byte) (icon *oksvg.SvgIcon, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			icon, err = nil, fmt.Errorf("failed to parse svg: %v", r)
+		}
+	}()
+	icon, err = oksvg.ReadIconStream(bytes.NewReader(data), oksvg.IgnoreErrorMode)
+	if err != nil {
+		return nil, err
+	}
+	if icon.ViewBox.W <= 0 || icon.ViewBox.H <= 0 || math.IsInf(icon.ViewBox.W, 0) || math.IsInf(icon.ViewBox.H, 0) {
+		return nil, errors.New("svg has no width/height or viewBox")
+	}
+	return icon, nil
+}
+
+// svgSize SVG 声明的尺寸（viewBox，缺省时为 width/height）
+func svgSize(data []byte) (int, int, error) {
+	icon, err := loadSVGIcon(data)
+	if err != nil {
+		return 0, 0, err
+	}
+	return max(1, int(math.Round(icon.ViewBox.W))), max(1, int(math.Round(icon.ViewBox.H))), nil
+}
+
+// rasterizeSVG 将 SVG 按长边 svgRasterSize 像素栅格化
+func rasterizeSVG(data []byte) (img image.Image, err error) {
+	icon, err := loadSVGIcon(data)
+	if err != nil {
+		return nil, err
+	}
+	scale := svgRasterSize / max(icon.ViewBox.W, icon.ViewBox.H)
+	width := max(1, int(math.Round(icon.ViewBox.W*scale)))
+	height := max(1, int(math.Round(icon.ViewBox.H*scale)))
+
+	defer func() {
+		if r := recover(); r != nil {
+			img, err = nil, fmt.Errorf("failed to rasterize svg: %v", r)
+		}
+	}()
+	icon.SetTarget(0, 0, float64(width), float64(height))
+	canvas := image.NewRGBA(image.Rect(0, 0, width, height))
+	scanner := rasterx.NewScannerGV(width, height, canvas, canvas.Bounds())
+	icon.Draw(rasterx.NewDasher(width, height, scanner), 1)
+	return canvas, nil
+}
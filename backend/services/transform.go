@@ -0,0 +1,253 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/disintegration/imaging"
+)
+
+// TransformOptions 按需变换参数
+type TransformOptions struct {
+	Width   int    // 目标宽度，0 表示按比例
+	Height  int    // 目标高度，0 表示按比例
+	Fit     string // contain: 等比缩放至框内; cover: 等比裁剪填满; fill: 拉伸
+	Crop    string // cover 的裁剪方式: center / smart
+	Format  string // webp / avif / jpeg / png
+	Quality int
+
+	// 需要添加的水印，由调用方根据访问者设置，nil 表示不加
+	Watermark *Watermark
+}
+
+// 支持的缩放模式与输出格式
+var (
+	transformFits    = []string{"contain", "cover", "fill"}
+	transformCrops   = []string{CropCenter, CropSmart}
+	transformFormats = []string{"webp", "avif", "jpeg", "png"}
+)
+
+// TransformLimits 变换参数白名单，防止任意尺寸请求耗尽 CPU 与缓存
+type TransformLimits struct {
+	Sizes     []int
+	Qualities []int
+}
+
+// ParseTransformQuery 解析查询参数形式: w=640&h=480&fit=cover&crop=smart&fmt=webp&q=75
+func ParseTransformQuery(get func(string) string) (TransformOptions, error) {
+	return parseTransformParams(map[string]string{
+		"w":    get("w"),
+		"h":    get("h"),
+		"fit":  get("fit"),
+		"crop": get("crop"),
+		"fmt":  get("fmt"),
+		"q":    get("q"),
+	})
+}
+
+// ParseTransformPath 解析路径段形式: w_640,h_480,fit_cover,crop_smart,fmt_webp,q_75
+func ParseTransformPath(segment string) (TransformOptions, error) {
+	params := make(map[string]string)
+	for _, part := range strings.Split(strings.Trim(segment, "/"), ",") {
+		if part == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(part, "_")
+		if !ok {
+			return TransformOptions{}, fmt.Errorf("invalid transform parameter: %s", part)
+		}
+		params[name] = value
+	}
+	return parseTransformParams(params)
+}
+
+func parseTransformParams(params map[string]string) (TransformOptions, error) {
+	opts := TransformOptions{Fit: "contain", Format: "webp"}
+	var err error
+
+	if v := params["w"]; v != "" {
+		if opts.Width, err = strconv.Atoi(v); err != nil || opts.Width < 0 {
+			return opts, fmt.Errorf("invalid width: %s", v)
+		}
+	}
+	if v := params["h"]; v != "" {
+		if opts.Height, err = strconv.Atoi(v); err != nil || opts.Height < 0 {
+			return opts, fmt.Errorf("invalid height: %s", v)
+		}
+	}
+	if v := params["q"]; v != "" {
+		if opts.Quality, err = strconv.Atoi(v); err != nil || opts.Quality < 1 || opts.Quality > 100 {
+			return opts, fmt.Errorf("invalid quality: %s", v)
+		}
+	}
+	if v := params["fit"]; v != "" {
+		opts.Fit = strings.ToLower(v)
+	}
+	if v := params["fmt"]; v != "" {
+		opts.Format = strings.ToLower(v)
+		if opts.Format == "jpg" {
+			opts.Format = "jpeg"
+		}
+	}
+
+	if !slices.Contains(transformFits, opts.Fit) {
+		return opts, fmt.Errorf("unsupported fit: %s", opts.Fit)
+	}
+	if v := params["crop"]; v != "" {
+		if opts.Fit != "cover" {
+			return opts, fmt.Errorf("crop requires fit=cover")
+		}
+		opts.Crop = strings.ToLower(v)
+		if !slices.Contains(transformCrops, opts.Crop) {
+			return opts, fmt.Errorf("unsupported crop: %s", v)
+		}
+	} else if opts.Fit == "cover" {
+		opts.Crop = output.TransformCrop
+	}
+	if !slices.Contains(transformFormats, opts.Format) {
+		return opts, fmt.Errorf("unsupported format: %s", opts.Format)
+	}
+	if err := formatAvailable(opts.Format); err != nil {
+		return opts, err
+	}
+	if opts.Quality == 0 {
+		opts.Quality = qualityFor(output.TransformQuality, opts.Format)
+	}
+	if opts.Width == 0 && opts.Height == 0 {
+		return opts, fmt.Errorf("width or height is required")
+	}
+	return opts, nil
+}
+
+// Validate 检查参数是否在白名单内
+func (o TransformOptions) Validate(limits TransformLimits) error {
+	if o.Width != 0 && !slices.Contains(limits.Sizes, o.Width) {
+		return fmt.Errorf("width %d is not allowed", o.Width)
+	}
+	if o.Height != 0 && !slices.Contains(limits.Sizes, o.Height) {
+		return fmt.Errorf("height %d is not allowed", o.Height)
+	}
+	if !slices.Contains(limits.Qualities, o.Quality) {
+		return fmt.Errorf("quality %d is not allowed", o.Quality)
+	}
+	return nil
+}
+
+// CacheKey 规范化的参数串，用作缓存键
+func (o TransformOptions) CacheKey() string {
+	// 居中裁剪沿用原有缓存键
+	fit := o.Fit
+	if o.Crop == CropSmart {
+		fit += "-smart"
+	}
+	if o.Watermark != nil {
+		return fmt.Sprintf("w%d_h%d_%s_q%d_wm%s.%s", o.Width, o.Height, fit, o.Quality, o.Watermark.Version, o.Format)
+	}
+	return fmt.Sprintf("w%d_h%d_%s_q%d.%s", o.Width, o.Height, fit, o.Quality, o.Format)
+}
+
+// MimeType 输出格式对应的 MIME 类型
+func (o TransformOptions) MimeType() string {
+	return MimeTypeOf(o.Format)
+}
+
+// Transform 按参数对原图进行缩放/裁剪/格式转换
+func (s *ImageService) Transform(data []byte, opts TransformOptions) ([]byte, error) {
+	img, err := s.decodeOriented(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %v", err)
+	}
+	img = s.resize(img, opts)
+	if opts.Watermark != nil {
+		img = opts.Watermark.Apply(img)
+	}
+	return s.encodeImage(img, opts.Format, opts.Quality)
+}
+
+// ConvertFormat 保持尺寸不变，仅转换编码格式
+func (s *ImageService) ConvertFormat(data []byte, format string, quality int) ([]byte, error) {
+	img, err := s.decodeOriented(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %v", err)
+	}
+	return s.encodeImage(img, format, quality)
+}
+
+// resize 按缩放模式调整尺寸，不放大原图
+func (s *ImageService) resize(img image.Image, opts TransformOptions) image.Image {
+	bounds := img.Bounds()
+	width, height := opts.Width, opts.Height
+
+	switch opts.Fit {
+	case "cover":
+		if width == 0 {
+			width = height
+		}
+		if height == 0 {
+			height = width
+		}
+		return fillImage(img, width, height, opts.Crop)
+	case "fill":
+		// 只指定一边时 imaging.Resize 会按比例计算另一边
+		width, height = shrinkToSource(width, height, bounds)
+		return imaging.Resize(img, width, height, imaging.Lanczos)
+	default:
+		if width == 0 || width > bounds.Dx() {
+			width = bounds.Dx()
+		}
+		if height == 0 || height > bounds.Dy() {
+			height = bounds.Dy()
+		}
+		return imaging.Fit(img, width, height, imaging.Lanczos)
+	}
+}
+
+// shrinkToSource 目标尺寸超出原图时两边按同一比例缩小，保持目标宽高比且不放大原图
+// 为 0 的一边表示按比例计算，保持为 0
+func shrinkToSource(width, height int, bounds image.Rectangle) (int, int) {
+	if width <= bounds.Dx() && height <= bounds.Dy() {
+		return width, height
+	}
+	scale := 1.0
+	if width > 0 {
+		scale = float64(bounds.Dx()) / float64(width)
+	}
+	if height > 0 {
+		scale = min(scale, float64(bounds.Dy())/float64(height))
+	}
+	if width > 0 {
+		width = max(1, int(float64(width)*scale))
+	}
+	if height > 0 {
+		height = max(1, int(float64(height)*scale))
+	}
+	return width, height
+}
+
+// encodeImage 按格式编码图片
+func (s *ImageService) encodeImage(img image.Image, format string, quality int) ([]byte, error) {
+	var buf bytes.Buffer
+	switch format {
+	case "webp":
+		return s.convertToWebP(img, quality)
+	case "avif":
+		return encodeAVIF(img, quality, output.AVIFSpeed)
+	case "jpeg":
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+			return nil, fmt.Errorf("failed to encode jpeg: %v", err)
+		}
+	case "png":
+		if err := png.Encode(&buf, img); err != nil {
+			return nil, fmt.Errorf("failed to encode png: %v", err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported format: %s", format)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,267 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+)
+
+var (
+	ErrTusNotFound       = errors.New("upload not found")
+	ErrTusOffsetMismatch = errors.New("upload offset mismatch")
+	ErrTusLocked         = errors.New("upload is locked by another request")
+	ErrTusCompleted      = errors.New("upload already completed")
+)
+
+var tusIDPattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// TusUpload 一次可续传上传的状态
+// 数据写入 <dir>/<id>.bin，状态保存在 <id>.json；完成后删除数据文件，只保留处理结果直到过期
+type TusUpload struct {
+	ID        string            `json:"id"`
+	Length    int64             `json:"length"`
+	Offset    int64             `json:"offset"`
+	Metadata  map[string]string `json:"metadata"`
+	CreatedAt time.Time         `json:"created_at"`
+	ExpiresAt time.Time         `json:"expires_at"` // 每次写入后顺延
+	Completed bool              `json:"completed"`
+	Result    json.RawMessage   `json:"result,omitempty"` // 交给上传流程处理后的结果
+}
+
+// TusStore 可续传上传的磁盘存储
+type TusStore struct {
+	dir        string
+	expiration time.Duration
+
+	mu   sync.Mutex
+	busy map[string]bool // 正在写入或处理的上传，同一上传不允许并发 PATCH
+}
+
+var Tus *TusStore
+
+// InitTusStore 初始化可续传上传存储，并定期清理过期的上传
+func InitTusStore(dir string, expiration time.Duration) {
+	store, err := NewTusStore(dir, expiration)
+	if err != nil {
+		log.Fatal("可续传上传目录初始化失败:", err)
+	}
+	Tus = store
+
+	interval := min(max(expiration/4, time.Minute), time.Hour)
+	go func() {
+		for {
+			if n := store.Cleanup(); n > 0 {
+				log.Printf("已清理 %d 个过期的可续传上传", n)
+			}
+			time.Sleep(interval)
+		}
+	}()
+}
+
+// NewTusStore 创建可续传上传存储
+func NewTusStore(dir string, expiration time.Duration) (*TusStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &TusStore{dir: dir, expiration: expiration, busy: make(map[string]bool)}, nil
+}
+
+func (s *TusStore) dataPath(id string) string { return filepath.Join(s.dir, id+".bin") }
+func (s *TusStore) infoPath(id string) string { return filepath.Join(s.dir, id+".json") }
+
+// Create 创建上传，返回的状态中 Offset 为 0
+func (s *TusStore) Create(length int64, metadata map[string]string) (*TusUpload, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	upload := &TusUpload{
+		ID:        hex.EncodeToString(buf),
+		Length:    length,
+		Metadata:  metadata,
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.expiration),
+	}
+	if err := os.WriteFile(s.dataPath(upload.ID), nil, 0644); err != nil {
+		return nil, err
+	}
+	if err := s.save(upload); err != nil {
+		os.Remove(s.dataPath(upload.ID))
+		return nil, err
+	}
+	return upload, nil
+}
+
+// Get 读取上传状态，不存在或已过期时返回 ErrTusNotFound
+func (s *TusStore) Get(id string) (*TusUpload, error) {
+	if !tusIDPattern.MatchString(id) {
+		return nil, ErrTusNotFound
+	}
+	data, err := os.ReadFile(s.infoPath(id))
+	if err != nil {
+		return nil, ErrTusNotFound
+	}
+	var upload TusUpload
+	if err := json.Unmarshal(data, &upload); err != nil {
+		return nil, ErrTusNotFound
+	}
+	if time.Now().After(upload.ExpiresAt) {
+		return nil, ErrTusNotFound
+	}
+	return &upload, nil
+}
+
+func (s *TusStore) save(upload *TusUpload) error {
+	data, err := json.Marshal(upload)
+	if err != nil {
+		return err
+	}
+	tmp := s.infoPath(upload.ID) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, s.infoPath(upload.ID)); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// Lock 占用上传，已被其他请求占用时返回 ErrTusLocked，使用完毕后调用返回的函数释放
+func (s *TusStore) Lock(id string) (func(), error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.busy[id] {
+		return nil, ErrTusLocked
+	}
+	s.busy[id] = true
+	return func() {
+		s.mu.Lock()
+		delete(s.busy, id)
+		s.mu.Unlock()
+	}, nil
+}
+
+// WriteChunk 从 offset 处追加数据，最多写到声明的总长度，调用方需先 Lock
+// 连接中断时已写入的部分同样计入 Offset，客户端可以从新的位置续传
+func (s *TusStore) WriteChunk(id string, offset int64, r io.Reader) (*TusUpload, error) {
+	upload, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if upload.Completed {
+		return upload, ErrTusCompleted
+	}
+	if upload.Offset != offset {
+		return upload, ErrTusOffsetMismatch
+	}
+
+	file, err := os.OpenFile(s.dataPath(id), os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	// 以状态中的 Offset 为准，丢弃上次中断时未记录的尾部数据
+	if err := file.Truncate(offset); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+	n, copyErr := io.Copy(file, io.LimitReader(r, upload.Length-offset))
+	if err := file.Close(); err != nil && copyErr == nil {
+		copyErr = err
+	}
+
+	upload.Offset += n
+	upload.ExpiresAt = time.Now().Add(s.expiration)
+	if err := s.save(upload); err != nil {
+		return nil, err
+	}
+	return upload, copyErr
+}
+
+// ReadData 读取已上传的数据
+func (s *TusStore) ReadData(id string) ([]byte, error) {
+	return os.ReadFile(s.dataPath(id))
+}
+
+// Complete 记录处理结果并删除数据文件
+func (s *TusStore) Complete(upload *TusUpload, result any) error {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	upload.Completed = true
+	upload.Result = data
+	if err := s.save(upload); err != nil {
+		return err
+	}
+	os.Remove(s.dataPath(upload.ID))
+	return nil
+}
+
+// Delete 终止并删除上传
+func (s *TusStore) Delete(id string) error {
+	if !tusIDPattern.MatchString(id) {
+		return ErrTusNotFound
+	}
+	os.Remove(s.dataPath(id))
+	if err := os.Remove(s.infoPath(id)); err != nil {
+		return ErrTusNotFound
+	}
+	return nil
+}
+
+// Cleanup 删除过期的上传（含已完成的处理结果），返回删除数量
+func (s *TusStore) Cleanup() int {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return 0
+	}
+	removed := 0
+	now := time.Now()
+	for _, entry := range entries {
+		name := entry.Name()
+		id := name[:len(name)-len(filepath.Ext(name))]
+		if !tusIDPattern.MatchString(id) {
+			continue
+		}
+		if filepath.Ext(name) == ".bin" {
+			// 创建时异常退出留下的数据文件
+			if _, err := os.Stat(s.infoPath(id)); os.IsNotExist(err) {
+				os.Remove(s.dataPath(id))
+			}
+			continue
+		}
+		if filepath.Ext(name) != ".json" {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(s.dir, name))
+		var upload TusUpload
+		if err == nil && json.Unmarshal(data, &upload) == nil && now.Before(upload.ExpiresAt) {
+			continue
+		}
+		// 正在写入的上传不清理
+		s.mu.Lock()
+		busy := s.busy[id]
+		s.mu.Unlock()
+		if busy {
+			continue
+		}
+		os.Remove(s.dataPath(id))
+		os.Remove(s.infoPath(id))
+		removed++
+	}
+	return removed
+}
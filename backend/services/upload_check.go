@@ -0,0 +1,137 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"slices"
+)
+
+// 上传被拒绝的原因，随上传结果返回供前端区分处理
+const (
+	RejectFileTooLarge    = "file_too_large"
+	RejectUnsupportedType = "unsupported_type"
+	RejectTooManyPixels   = "too_many_pixels"
+	RejectTooManyFrames   = "too_many_frames"
+	RejectCorruptImage    = "corrupt_image"
+	RejectNearDuplicate   = "near_duplicate"
+)
+
+// UploadLimits 解码前检查的上传限制
+type UploadLimits struct {
+	MaxFileSize   int64
+	AllowedTypes  []string
+	MaxMegapixels float64 // 0 表示不限制
+	MaxGIFFrames  int     // 0 表示不限制
+}
+
+// UploadRejection 上传检查未通过
+type UploadRejection struct {
+	Reason  string
+	Message string
+}
+
+func (e *UploadRejection) Error() string {
+	return e.Message
+}
+
+func rejectUpload(reason, format string, args ...any) *UploadRejection {
+	return &UploadRejection{Reason: reason, Message: fmt.Sprintf(format, args...)}
+}
+
+// ImageCheck 通过检查的图片信息（来自文件头，未解码像素）
+type ImageCheck struct {
+	MimeType string
+	Width    int
+	Height   int
+	Frames   int
+}
+
+// SniffImageType 按文件头魔数识别图片的真实 MIME 类型，无法识别时返回空
+func SniffImageType(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xFF, 0xD8, 0xFF}):
+		return "image/jpeg"
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		return "image/png"
+	case bytes.HasPrefix(data, []byte("GIF87a")), bytes.HasPrefix(data, []byte("GIF89a")):
+		return "image/gif"
+	case len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WEBP":
+		return "image/webp"
+	case bytes.HasPrefix(data, []byte("BM")):
+		return "image/bmp"
+	case bytes.HasPrefix(data, []byte("II*\x00")), bytes.HasPrefix(data, []byte("MM\x00*")):
+		return "image/tiff"
+	case len(data) >= 12 && string(data[4:8]) == "ftyp":
+		switch string(data[8:12]) {
+		case "avif", "avis":
+			return "image/avif"
+		case "heic", "heix", "heim", "heis", "hevc", "hevx":
+			return "image/heic"
+		case "mif1", "msf1":
+			return "image/heif"
+		}
+	case isSVG(data):
+		return "image/svg+xml"
+	}
+	return ""
+}
+
+// CheckUpload 在解码像素之前检查上传数据：大小、真实类型、声明的像素尺寸与 GIF 帧数
+// 未通过时返回 *UploadRejection
+func CheckUpload(data []byte, limits UploadLimits) (*ImageCheck, error) {
+	if limits.MaxFileSize > 0 && int64(len(data)) > limits.MaxFileSize {
+		return nil, rejectUpload(RejectFileTooLarge, "文件大小超出限制 (最大 %d 字节)", limits.MaxFileSize)
+	}
+
+	check := &ImageCheck{MimeType: SniffImageType(data), Frames: 1}
+	if check.MimeType == "" {
+		return nil, rejectUpload(RejectUnsupportedType, "无法识别的文件类型")
+	}
+	if !slices.Contains(limits.AllowedTypes, check.MimeType) {
+		return nil, rejectUpload(RejectUnsupportedType, "不支持的文件类型: %s", check.MimeType)
+	}
+
+	switch check.MimeType {
+	case "image/heic", "image/heif", "image/avif":
+		// 标准库无法读取 HEIF 容器，按 ispe 属性声明的尺寸检查
+		width, height, ok := heifImageSize(data)
+		if !ok {
+			return nil, rejectUpload(RejectCorruptImage, "无法读取图片尺寸")
+		}
+		if err := checkPixels(check, width, height, limits); err != nil {
+			return nil, err
+		}
+		return check, nil
+	case "image/svg+xml":
+		// 矢量图按固定尺寸栅格化，声明的尺寸不影响解码开销
+		return check, nil
+	case "image/gif":
+		info, err := scanGIF(data)
+		if err != nil {
+			return nil, rejectUpload(RejectCorruptImage, "GIF 文件已损坏: %v", err)
+		}
+		check.Frames = info.Frames
+		if limits.MaxGIFFrames > 0 && info.Frames > limits.MaxGIFFrames {
+			return nil, rejectUpload(RejectTooManyFrames, "GIF 帧数 %d 超出限制 (最多 %d 帧)", info.Frames, limits.MaxGIFFrames)
+		}
+	}
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, rejectUpload(RejectCorruptImage, "无法读取图片尺寸: %v", err)
+	}
+	if err := checkPixels(check, config.Width, config.Height, limits); err != nil {
+		return nil, err
+	}
+	return check, nil
+}
+
+// checkPixels 记录图片尺寸并检查像素上限
+func checkPixels(check *ImageCheck, width, height int, limits UploadLimits) error {
+	check.Width, check.Height = width, height
+	if limits.MaxMegapixels > 0 && float64(width)*float64(height) > limits.MaxMegapixels*1e6 {
+		return rejectUpload(RejectTooManyPixels, "图片尺寸 %dx%d 超出限制 (最大 %g 百万像素)", width, height, limits.MaxMegapixels)
+	}
+	return nil
+}
@@ -0,0 +1,212 @@
+package services
+
+import (
+	"container/list"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// VariantCache 衍生图片的磁盘缓存，按总大小上限做 LRU 淘汰
+// 文件按图片 ID 分目录存放: <dir>/<imageID>/<参数串>，便于删除图片时一并清理
+type VariantCache struct {
+	dir      string
+	maxBytes int64
+
+	mu      sync.Mutex
+	size    int64
+	lru     *list.List               // 队首为最近使用
+	entries map[string]*list.Element // 相对路径 -> 节点
+}
+
+type variantEntry struct {
+	key  string
+	size int64
+}
+
+var Variants *VariantCache
+
+// InitVariantCache 初始化衍生图缓存
+func InitVariantCache(dir string, maxBytes int64) {
+	cache, err := NewVariantCache(dir, maxBytes)
+	if err != nil {
+		log.Fatal("衍生图缓存初始化失败:", err)
+	}
+	Variants = cache
+}
+
+// NewVariantCache 创建缓存并从磁盘恢复索引，按修改时间还原使用顺序
+func NewVariantCache(dir string, maxBytes int64) (*VariantCache, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	c := &VariantCache{
+		dir:      dir,
+		maxBytes: maxBytes,
+		lru:      list.New(),
+		entries:  make(map[string]*list.Element),
+	}
+
+	type diskFile struct {
+		key     string
+		size    int64
+		modTime time.Time
+	}
+	var files []diskFile
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		// 清理上次异常退出留下的临时文件
+		if strings.HasSuffix(p, ".tmp") {
+			os.Remove(p)
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		rel, _ := filepath.Rel(dir, p)
+		files = append(files, diskFile{key: filepath.ToSlash(rel), size: info.Size(), modTime: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.After(files[j].modTime) })
+	for _, f := range files {
+		c.entries[f.key] = c.lru.PushBack(&variantEntry{key: f.key, size: f.size})
+		c.size += f.size
+	}
+	c.mu.Lock()
+	c.evictLocked()
+	c.mu.Unlock()
+	return c, nil
+}
+
+func (c *VariantCache) entryKey(imageID int, name string) string {
+	return strconv.Itoa(imageID) + "/" + name
+}
+
+// Get 读取缓存，命中时刷新使用顺序
+func (c *VariantCache) Get(imageID int, name string) ([]byte, bool) {
+	key := c.entryKey(imageID, name)
+
+	c.mu.Lock()
+	elem, ok := c.entries[key]
+	if ok {
+		c.lru.MoveToFront(elem)
+	}
+	c.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+
+	fullPath := filepath.Join(c.dir, filepath.FromSlash(key))
+	data, err := os.ReadFile(fullPath)
+	if err != nil {
+		c.remove(key)
+		return nil, false
+	}
+	// 持久化访问时间，重启后仍能还原 LRU 顺序
+	now := time.Now()
+	os.Chtimes(fullPath, now, now)
+	return data, true
+}
+
+// Put 写入缓存，超出容量时淘汰最久未使用的条目
+func (c *VariantCache) Put(imageID int, name string, data []byte) error {
+	if c.maxBytes > 0 && int64(len(data)) > c.maxBytes {
+		return nil
+	}
+	key := c.entryKey(imageID, name)
+	fullPath := filepath.Join(c.dir, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(fullPath), 0755); err != nil {
+		return err
+	}
+	// 每次写入使用独立的临时文件，同一衍生图并发生成时不会互相覆盖写了一半的内容
+	tmp, err := os.CreateTemp(filepath.Dir(fullPath), filepath.Base(fullPath)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), fullPath)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		entry := elem.Value.(*variantEntry)
+		c.size -= entry.size
+		entry.size = int64(len(data))
+		c.lru.MoveToFront(elem)
+	} else {
+		c.entries[key] = c.lru.PushFront(&variantEntry{key: key, size: int64(len(data))})
+	}
+	c.size += int64(len(data))
+	c.evictLocked()
+	return nil
+}
+
+// Purge 删除某张图片的所有衍生缓存
+func (c *VariantCache) Purge(imageID int) {
+	prefix := strconv.Itoa(imageID) + "/"
+
+	c.mu.Lock()
+	for key, elem := range c.entries {
+		if strings.HasPrefix(key, prefix) {
+			c.size -= elem.Value.(*variantEntry).size
+			c.lru.Remove(elem)
+			delete(c.entries, key)
+		}
+	}
+	c.mu.Unlock()
+
+	os.RemoveAll(filepath.Join(c.dir, strconv.Itoa(imageID)))
+}
+
+func (c *VariantCache) remove(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[key]; ok {
+		c.size -= elem.Value.(*variantEntry).size
+		c.lru.Remove(elem)
+		delete(c.entries, key)
+	}
+}
+
+// evictLocked 淘汰队尾条目直到总大小不超过上限，调用方需持有锁
+func (c *VariantCache) evictLocked() {
+	if c.maxBytes <= 0 {
+		return
+	}
+	for c.size > c.maxBytes {
+		elem := c.lru.Back()
+		if elem == nil {
+			return
+		}
+		entry := elem.Value.(*variantEntry)
+		c.lru.Remove(elem)
+		delete(c.entries, entry.key)
+		c.size -= entry.size
+		os.Remove(filepath.Join(c.dir, filepath.FromSlash(entry.key)))
+	}
+}
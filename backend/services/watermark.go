@@ -0,0 +1,289 @@
+package services
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"oneimg/backend/models"
+	"oneimg/backend/storage"
+
+	"github.com/disintegration/imaging"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// Watermark 已加载的水印：配置与预先渲染好的水印图
+type Watermark struct {
+	Config  models.WatermarkConfig
+	Version string // 配置与水印图的摘要，用于区分不同水印下的缓存
+	overlay *image.NRGBA
+}
+
+// watermark 当前生效的水印，未启用时为 nil
+var watermark atomic.Pointer[Watermark]
+
+// DefaultWatermarkConfig 默认水印配置（未启用）
+func DefaultWatermarkConfig() models.WatermarkConfig {
+	return models.WatermarkConfig{
+		Type:         "text",
+		Color:        "#FFFFFF",
+		Position:     "bottom-right",
+		Opacity:      0.5,
+		Scale:        0.2,
+		Margin:       0.02,
+		ApplyPreview: true,
+	}
+}
+
+// SetWatermark 校验配置并渲染水印图，overlayPNG 为图片水印的 PNG 数据
+func SetWatermark(cfg models.WatermarkConfig, overlayPNG []byte) error {
+	if !cfg.Enabled {
+		watermark.Store(nil)
+		return nil
+	}
+	if err := ValidateWatermarkConfig(cfg); err != nil {
+		return err
+	}
+
+	var overlay image.Image
+	var err error
+	switch cfg.Type {
+	case "image":
+		overlay, err = png.Decode(bytes.NewReader(overlayPNG))
+		if err != nil {
+			return fmt.Errorf("failed to decode watermark png: %v", err)
+		}
+	default:
+		overlay, err = renderWatermarkText(cfg)
+		if err != nil {
+			return err
+		}
+	}
+
+	configJSON, _ := json.Marshal(cfg)
+	sum := sha256.New()
+	sum.Write(configJSON)
+	sum.Write(overlayPNG)
+	watermark.Store(&Watermark{
+		Config:  cfg,
+		Version: hex.EncodeToString(sum.Sum(nil))[:8],
+		overlay: imaging.Clone(overlay),
+	})
+	return nil
+}
+
+// WatermarkImageKey 图片水印在存储中的 key，位于不对外提供访问的目录
+const WatermarkImageKey = ".watermark/watermark.png"
+
+// LoadWatermark 按配置加载水印，图片水印从存储中读取
+func LoadWatermark(cfg models.WatermarkConfig) error {
+	var overlayPNG []byte
+	if cfg.Enabled && cfg.Type == "image" && cfg.ImageKey != "" {
+		reader, _, err := storage.GetStorage().Get(cfg.ImageKey)
+		if err != nil {
+			return fmt.Errorf("failed to read watermark image: %v", err)
+		}
+		defer reader.Close()
+		if overlayPNG, err = io.ReadAll(reader); err != nil {
+			return fmt.Errorf("failed to read watermark image: %v", err)
+		}
+	}
+	return SetWatermark(cfg, overlayPNG)
+}
+
+// CurrentWatermark 当前生效的水印，未启用时返回 nil
+func CurrentWatermark() *Watermark {
+	return watermark.Load()
+}
+
+// ValidateWatermarkConfig 校验水印配置
+func ValidateWatermarkConfig(cfg models.WatermarkConfig) error {
+	switch cfg.Type {
+	case "text":
+		if strings.TrimSpace(cfg.Text) == "" {
+			return fmt.Errorf("watermark text is empty")
+		}
+		if _, err := parseHexColor(cfg.Color); err != nil {
+			return err
+		}
+	case "image":
+		if cfg.ImageKey == "" {
+			return fmt.Errorf("watermark image is not uploaded")
+		}
+	default:
+		return fmt.Errorf("unsupported watermark type: %s", cfg.Type)
+	}
+	if _, ok := watermarkAnchors[cfg.Position]; !ok {
+		return fmt.Errorf("unsupported watermark position: %s", cfg.Position)
+	}
+	if cfg.Opacity <= 0 || cfg.Opacity > 1 {
+		return fmt.Errorf("opacity must be in (0, 1]")
+	}
+	if cfg.Scale <= 0 || cfg.Scale > 1 {
+		return fmt.Errorf("scale must be in (0, 1]")
+	}
+	if cfg.Margin < 0 || cfg.Margin > 0.5 {
+		return fmt.Errorf("margin must be in [0, 0.5]")
+	}
+	return nil
+}
+
+// BakeOriginal 上传时将水印写入原图（未加水印的原图另行保留）
+func (w *Watermark) BakeOriginal() bool {
+	return w != nil && w.Config.ApplyOriginal && !w.Config.AnonymousOnly
+}
+
+// BakePreview 上传时将水印写入预览图
+func (w *Watermark) BakePreview() bool {
+	return w != nil && w.Config.ApplyPreview && !w.Config.AnonymousOnly
+}
+
+// ForVariants 按需生成的衍生图是否需要添加水印
+// 原图已含水印时衍生图自然带有水印，无需重复添加
+func (w *Watermark) ForVariants(anonymous bool) bool {
+	if w == nil || !w.Config.ApplyPreview || w.BakeOriginal() {
+		return false
+	}
+	return !w.Config.AnonymousOnly || anonymous
+}
+
+// CoversOriginal 原图是否受水印保护（上传时写入或对访客即时添加），此时无水印的文件不能公开提供
+func (w *Watermark) CoversOriginal() bool {
+	return w != nil && w.Config.ApplyOriginal
+}
+
+// ServeOriginal 访问原图时是否需要即时添加水印
+func (w *Watermark) ServeOriginal(anonymous bool) bool {
+	return w != nil && w.Config.AnonymousOnly && w.Config.ApplyOriginal && anonymous
+}
+
+// ServePreview 访问预览图时是否需要即时添加水印
+func (w *Watermark) ServePreview(anonymous bool) bool {
+	return w != nil && w.Config.AnonymousOnly && w.Config.ApplyPreview && anonymous
+}
+
+// 九宫格位置对应的水平/垂直锚点 (0 左/上, 1 中, 2 右/下)
+var watermarkAnchors = map[string][2]int{
+	"top-left": {0, 0}, "top": {1, 0}, "top-right": {2, 0},
+	"left": {0, 1}, "center": {1, 1}, "right": {2, 1},
+	"bottom-left": {0, 2}, "bottom": {1, 2}, "bottom-right": {2, 2},
+}
+
+// Apply 在图片上绘制水印，返回新图片
+func (w *Watermark) Apply(img image.Image) image.Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	// 按图片宽度缩放水印，同时不超过图片高度
+	overlayWidth := max(1, int(float64(width)*w.Config.Scale))
+	overlayHeight := max(1, overlayWidth*w.overlay.Bounds().Dy()/max(1, w.overlay.Bounds().Dx()))
+	if overlayHeight > height {
+		overlayHeight = height
+		overlayWidth = max(1, overlayHeight*w.overlay.Bounds().Dx()/max(1, w.overlay.Bounds().Dy()))
+	}
+	overlay := imaging.Resize(w.overlay, overlayWidth, overlayHeight, imaging.Lanczos)
+	mask := image.NewUniform(color.Alpha{A: uint8(w.Config.Opacity * 255)})
+
+	dst := imaging.Clone(img)
+	margin := int(float64(min(width, height)) * w.Config.Margin)
+	if w.Config.Tile {
+		// 平铺时水印之间留出与水印同等大小的间隔，奇数行错开半个身位
+		stepX, stepY := overlayWidth*2, overlayHeight*3
+		for row, y := 0, margin; y < height; row, y = row+1, y+stepY {
+			offset := (row % 2) * overlayWidth
+			for x := margin - offset; x < width; x += stepX {
+				r := image.Rect(x, y, x+overlayWidth, y+overlayHeight)
+				draw.DrawMask(dst, r, overlay, image.Point{}, mask, image.Point{}, draw.Over)
+			}
+		}
+		return dst
+	}
+
+	anchor := watermarkAnchors[w.Config.Position]
+	x := []int{margin, (width - overlayWidth) / 2, width - overlayWidth - margin}[anchor[0]]
+	y := []int{margin, (height - overlayHeight) / 2, height - overlayHeight - margin}[anchor[1]]
+	r := image.Rect(x, y, x+overlayWidth, y+overlayHeight)
+	draw.DrawMask(dst, r, overlay, image.Point{}, mask, image.Point{}, draw.Over)
+	return dst
+}
+
+// WatermarkBytes 解码图片、添加水印并按原格式重新编码，GIF 等不支持的格式原样返回
+func (s *ImageService) WatermarkBytes(data []byte, w *Watermark) ([]byte, error) {
+	img, format, err := s.decodeImage(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %v", err)
+	}
+	if format != "jpeg" && format != "png" && format != "webp" {
+		return data, nil
+	}
+	img = applyOrientation(img, exifOrientation(data, format))
+	return s.encodeImage(w.Apply(img), format, qualityFor(output.TransformQuality, format))
+}
+
+// renderWatermarkText 以较大字号渲染文字，使用时再按图片尺寸缩放
+func renderWatermarkText(cfg models.WatermarkConfig) (image.Image, error) {
+	fontData := goregular.TTF
+	if cfg.FontPath != "" {
+		data, err := os.ReadFile(cfg.FontPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read font: %v", err)
+		}
+		fontData = data
+	}
+	parsed, err := opentype.Parse(fontData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse font: %v", err)
+	}
+	face, err := opentype.NewFace(parsed, &opentype.FaceOptions{Size: 96, DPI: 72, Hinting: font.HintingFull})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create font face: %v", err)
+	}
+	defer face.Close()
+
+	textColor, _ := parseHexColor(cfg.Color)
+	metrics := face.Metrics()
+	advance := font.MeasureString(face, cfg.Text)
+	padding := 8
+	width := advance.Ceil() + padding*2
+	height := (metrics.Ascent + metrics.Descent).Ceil() + padding*2
+
+	canvas := image.NewNRGBA(image.Rect(0, 0, width, height))
+	drawer := &font.Drawer{
+		Dst:  canvas,
+		Src:  image.NewUniform(textColor),
+		Face: face,
+		Dot:  fixed.P(padding, padding+metrics.Ascent.Ceil()),
+	}
+	drawer.DrawString(cfg.Text)
+	return canvas, nil
+}
+
+// parseHexColor 解析 #RRGGBB 或 #RRGGBBAA
+func parseHexColor(s string) (color.NRGBA, error) {
+	hexStr := strings.TrimPrefix(s, "#")
+	if len(hexStr) != 6 && len(hexStr) != 8 {
+		return color.NRGBA{}, fmt.Errorf("invalid color: %s", s)
+	}
+	v, err := strconv.ParseUint(hexStr, 16, 32)
+	if err != nil {
+		return color.NRGBA{}, fmt.Errorf("invalid color: %s", s)
+	}
+	if len(hexStr) == 6 {
+		v = v<<8 | 0xFF
+	}
+	return color.NRGBA{R: uint8(v >> 24), G: uint8(v >> 16), B: uint8(v >> 8), A: uint8(v)}, nil
+}
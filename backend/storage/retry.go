@@ -0,0 +1,48 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"time"
+)
+
+// retry 执行 fn，失败时按指数退避重试；ErrNotExist 视为确定结果，不再重试
+func retry(attempts int, fn func() error) error {
+	if attempts < 1 {
+		attempts = 1
+	}
+	var err error
+	for i := 0; i < attempts; i++ {
+		if err = fn(); err == nil || errors.Is(err, ErrNotExist) {
+			return err
+		}
+		if i < attempts-1 {
+			time.Sleep(time.Duration(1<<i) * 200 * time.Millisecond)
+		}
+	}
+	return err
+}
+
+// retryPut 带重试地写入 reader，每次重试前将 reader 复位到起始位置
+// 不可 Seek 的 reader 会先读入内存
+func retryPut(attempts int, reader io.Reader, fn func(io.Reader) error) error {
+	rs, ok := reader.(io.ReadSeeker)
+	if !ok {
+		data, err := io.ReadAll(reader)
+		if err != nil {
+			return err
+		}
+		rs = bytes.NewReader(data)
+	}
+	start, err := rs.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	return retry(attempts, func() error {
+		if _, err := rs.Seek(start, io.SeekStart); err != nil {
+			return err
+		}
+		return fn(rs)
+	})
+}
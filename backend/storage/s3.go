@@ -0,0 +1,205 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"strings"
+
+	"oneimg/backend/config"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// S3Storage S3 兼容对象存储，支持 AWS S3、MinIO、Cloudflare R2 等
+type S3Storage struct {
+	client    *minio.Client
+	bucket    string
+	prefix    string
+	publicURL string
+}
+
+// NewS3Storage 创建 S3 存储
+// Endpoint 可以带协议头（http://127.0.0.1:9000），此时以协议头决定是否使用 TLS
+func NewS3Storage(cfg config.S3Config) (*S3Storage, error) {
+	if cfg.Bucket == "" {
+		return nil, fmt.Errorf("S3_BUCKET is required for s3 storage")
+	}
+
+	endpoint := cfg.Endpoint
+	secure := cfg.UseSSL
+	if strings.Contains(endpoint, "://") {
+		u, err := url.Parse(endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("invalid S3 endpoint: %v", err)
+		}
+		endpoint = u.Host
+		secure = u.Scheme == "https"
+	}
+
+	lookup := minio.BucketLookupAuto
+	if cfg.PathStyle {
+		lookup = minio.BucketLookupPath
+	}
+
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds:        credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+		Secure:       secure,
+		Region:       cfg.Region,
+		BucketLookup: lookup,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	exists, err := client.BucketExists(context.Background(), cfg.Bucket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check bucket %s: %v", cfg.Bucket, err)
+	}
+	if !exists {
+		return nil, fmt.Errorf("bucket %s does not exist", cfg.Bucket)
+	}
+
+	prefix := strings.Trim(cfg.Prefix, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+	if cfg.PublicURL != "" {
+		log.Printf("警告: 已设置 S3_PUBLIC_URL，原图直接由存储桶提供，防盗链、SVG CSP 与匿名访问水印不生效；请确保 %s.originals/ 不可匿名访问", prefix)
+	}
+
+	return &S3Storage{
+		client:    client,
+		bucket:    cfg.Bucket,
+		prefix:    prefix,
+		publicURL: cfg.PublicURL,
+	}, nil
+}
+
+// objectName 将 key 转换为桶内对象名
+func (s *S3Storage) objectName(key string) (string, error) {
+	cleaned, err := CleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	return s.prefix + cleaned, nil
+}
+
+func (s *S3Storage) Put(key string, reader io.Reader, contentType string) error {
+	name, err := s.objectName(key)
+	if err != nil {
+		return err
+	}
+	if contentType == "" {
+		contentType = ContentTypeByKey(key)
+	}
+
+	// 已知长度时直接上传，避免 SDK 为未知长度缓冲分片
+	size := int64(-1)
+	if l, ok := reader.(interface{ Len() int }); ok {
+		size = int64(l.Len())
+	}
+
+	_, err = s.client.PutObject(context.Background(), s.bucket, name, reader, size, minio.PutObjectOptions{
+		ContentType: contentType,
+	})
+	return err
+}
+
+func (s *S3Storage) Get(key string) (io.ReadCloser, *FileInfo, error) {
+	name, err := s.objectName(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	obj, err := s.client.GetObject(context.Background(), s.bucket, name, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, nil, s.convertError(err)
+	}
+	stat, err := obj.Stat()
+	if err != nil {
+		obj.Close()
+		return nil, nil, s.convertError(err)
+	}
+	// *minio.Object 实现了 io.ReadSeeker，可直接用于 Range 请求
+	return obj, s.fileInfo(key, stat), nil
+}
+
+func (s *S3Storage) Delete(key string) error {
+	name, err := s.objectName(key)
+	if err != nil {
+		return err
+	}
+	return s.client.RemoveObject(context.Background(), s.bucket, name, minio.RemoveObjectOptions{})
+}
+
+func (s *S3Storage) Stat(key string) (*FileInfo, error) {
+	name, err := s.objectName(key)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := s.client.StatObject(context.Background(), s.bucket, name, minio.StatObjectOptions{})
+	if err != nil {
+		return nil, s.convertError(err)
+	}
+	return s.fileInfo(key, stat), nil
+}
+
+func (s *S3Storage) List(prefix string) ([]FileInfo, error) {
+	var files []FileInfo
+	for obj := range s.client.ListObjects(context.Background(), s.bucket, minio.ListObjectsOptions{
+		Prefix:    s.prefix + prefix,
+		Recursive: true,
+	}) {
+		if obj.Err != nil {
+			return nil, obj.Err
+		}
+		files = append(files, *s.fileInfo(strings.TrimPrefix(obj.Key, s.prefix), obj))
+	}
+	return files, nil
+}
+
+// URL 配置了 S3_PUBLIC_URL 时直接指向存储桶，否则经由本应用代理
+// 直接指向存储桶的地址不经过本应用的防盗链、签名校验、SVG CSP 与水印处理
+func (s *S3Storage) URL(key string) string {
+	if s.publicURL != "" {
+		return s.publicURL + "/" + s.prefix + strings.TrimPrefix(key, "/")
+	}
+	return "/uploads/" + strings.TrimPrefix(key, "/")
+}
+
+// KeyFromURL 从公开访问地址中还原 key
+func (s *S3Storage) KeyFromURL(u string) (string, bool) {
+	if s.publicURL == "" {
+		return "", false
+	}
+	base := s.publicURL + "/" + s.prefix
+	if !strings.HasPrefix(u, base) {
+		return "", false
+	}
+	return strings.TrimPrefix(u, base), true
+}
+
+func (s *S3Storage) fileInfo(key string, stat minio.ObjectInfo) *FileInfo {
+	contentType := stat.ContentType
+	if contentType == "" {
+		contentType = ContentTypeByKey(key)
+	}
+	return &FileInfo{
+		Key:         key,
+		Size:        stat.Size,
+		ContentType: contentType,
+		ModTime:     stat.LastModified,
+	}
+}
+
+// convertError 将对象不存在的错误统一转换为 ErrNotExist
+func (s *S3Storage) convertError(err error) error {
+	switch minio.ToErrorResponse(err).Code {
+	case "NoSuchKey", "NotFound":
+		return ErrNotExist
+	}
+	return err
+}
@@ -0,0 +1,152 @@
+package storage
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"oneimg/backend/config"
+)
+
+// newTestS3Storage 连接 S3_TEST_ENDPOINT 指定的 MinIO，未设置时跳过
+// 例如: docker run -p 9000:9000 minio/minio server /data 并创建存储桶后
+// S3_TEST_ENDPOINT=http://127.0.0.1:9000 S3_TEST_BUCKET=oneimg-test go test ./backend/storage/
+func newTestS3Storage(t *testing.T) *S3Storage {
+	endpoint := os.Getenv("S3_TEST_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("S3_TEST_ENDPOINT is not set")
+	}
+	bucket := os.Getenv("S3_TEST_BUCKET")
+	if bucket == "" {
+		bucket = "oneimg-test"
+	}
+	accessKey, secretKey := os.Getenv("S3_TEST_ACCESS_KEY"), os.Getenv("S3_TEST_SECRET_KEY")
+	if accessKey == "" {
+		accessKey, secretKey = "minioadmin", "minioadmin"
+	}
+
+	s, err := NewS3Storage(config.S3Config{
+		Endpoint:  endpoint,
+		Region:    "us-east-1",
+		Bucket:    bucket,
+		Prefix:    "test-" + strconv.FormatInt(time.Now().UnixNano(), 36),
+		AccessKey: accessKey,
+		SecretKey: secretKey,
+		PathStyle: true,
+	})
+	if err != nil {
+		t.Fatalf("NewS3Storage: %v", err)
+	}
+	return s
+}
+
+func TestS3RoundTrip(t *testing.T) {
+	s := newTestS3Storage(t)
+	content := []byte("\x89PNG\r\n\x1a\nround trip")
+
+	if err := s.Put("2024/01/a.png", bytes.NewReader(content), "image/png"); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	// 未知长度的 reader
+	if err := s.Put("2024/01/b.webp", io.MultiReader(bytes.NewReader(content)), ""); err != nil {
+		t.Fatalf("Put without length: %v", err)
+	}
+	t.Cleanup(func() {
+		s.Delete("2024/01/a.png")
+		s.Delete("2024/01/b.webp")
+	})
+
+	reader, info, err := s.Get("2024/01/a.png")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	data, err := io.ReadAll(reader)
+	reader.Close()
+	if err != nil || !bytes.Equal(data, content) {
+		t.Fatalf("Get content = %q, %v", data, err)
+	}
+	if info.Size != int64(len(content)) || info.ContentType != "image/png" {
+		t.Errorf("Get info = %+v", info)
+	}
+
+	// Range 请求依赖 Seek
+	reader, _, err = s.Get("2024/01/a.png")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	seeker, ok := reader.(io.ReadSeeker)
+	if !ok {
+		t.Fatal("Get reader does not implement io.Seeker")
+	}
+	if _, err := seeker.Seek(8, io.SeekStart); err != nil {
+		t.Fatalf("Seek: %v", err)
+	}
+	data, _ = io.ReadAll(seeker)
+	reader.Close()
+	if string(data) != "round trip" {
+		t.Errorf("read after Seek = %q", data)
+	}
+
+	info, err = s.Stat("2024/01/b.webp")
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if info.ContentType != "image/webp" {
+		t.Errorf("Stat content type = %q, want type from extension", info.ContentType)
+	}
+
+	files, err := s.List("2024/")
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	keys := map[string]bool{}
+	for _, f := range files {
+		keys[f.Key] = true
+	}
+	if len(files) != 2 || !keys["2024/01/a.png"] || !keys["2024/01/b.webp"] {
+		t.Errorf("List = %+v", files)
+	}
+
+	if err := s.Delete("2024/01/a.png"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := s.Stat("2024/01/a.png"); err != ErrNotExist {
+		t.Errorf("Stat after Delete = %v, want ErrNotExist", err)
+	}
+	if _, _, err := s.Get("2024/01/a.png"); err != ErrNotExist {
+		t.Errorf("Get after Delete = %v, want ErrNotExist", err)
+	}
+	// 删除不存在的对象不报错
+	if err := s.Delete("2024/01/a.png"); err != nil {
+		t.Errorf("Delete missing: %v", err)
+	}
+}
+
+func TestS3RejectsTraversalKeys(t *testing.T) {
+	s := newTestS3Storage(t)
+	if err := s.Put("../escape.png", bytes.NewReader(nil), ""); err == nil {
+		t.Error("Put accepted a key outside the prefix")
+	}
+}
+
+func TestS3PublicURL(t *testing.T) {
+	s := &S3Storage{prefix: "img/", publicURL: "https://cdn.example.com"}
+	u := s.URL("2024/01/a.png")
+	if u != "https://cdn.example.com/img/2024/01/a.png" {
+		t.Fatalf("URL = %q", u)
+	}
+	if key, ok := s.KeyFromURL(u); !ok || key != "2024/01/a.png" {
+		t.Errorf("KeyFromURL = %q, %v", key, ok)
+	}
+	if _, ok := s.KeyFromURL("https://other.example.com/img/a.png"); ok {
+		t.Error("KeyFromURL accepted a foreign URL")
+	}
+
+	proxied := &S3Storage{}
+	if u := proxied.URL("/2024/01/a.png"); u != "/uploads/2024/01/a.png" {
+		t.Errorf("URL without public url = %q", u)
+	}
+}
@@ -0,0 +1,393 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"oneimg/backend/config"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// SFTPStorage SFTP 存储
+// 维护一个 SSH 连接池，同时打开的连接数不超过 MaxConns，连接断开时自动重连并重试
+type SFTPStorage struct {
+	addr      string
+	sshConfig *ssh.ClientConfig
+	root      string
+	retries   int
+	idle      chan *sftpConn
+	// slots 每个已打开的连接占用一个位置，满时等待其他连接归还
+	slots chan struct{}
+}
+
+// sftpConn 一条 SSH 连接及其上的 SFTP 会话
+type sftpConn struct {
+	ssh    *ssh.Client
+	client *sftp.Client
+	broken bool
+}
+
+func (c *sftpConn) Close() error {
+	c.client.Close()
+	return c.ssh.Close()
+}
+
+// NewSFTPStorage 创建 SFTP 存储
+func NewSFTPStorage(cfg config.SFTPConfig, retries int) (*SFTPStorage, error) {
+	if cfg.Host == "" {
+		return nil, fmt.Errorf("SFTP_HOST is required for sftp storage")
+	}
+
+	var auth []ssh.AuthMethod
+	if cfg.PrivateKey != "" {
+		keyBytes, err := os.ReadFile(cfg.PrivateKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read sftp private key: %v", err)
+		}
+		signer, err := ssh.ParsePrivateKey(keyBytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse sftp private key: %v", err)
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if cfg.Password != "" {
+		auth = append(auth, ssh.Password(cfg.Password))
+	}
+
+	hostKeyCallback, err := sftpHostKeyCallback(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	maxConns := cfg.MaxConns
+	if maxConns < 1 {
+		maxConns = 4
+	}
+
+	s := &SFTPStorage{
+		addr: net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port)),
+		sshConfig: &ssh.ClientConfig{
+			User:            cfg.Username,
+			Auth:            auth,
+			HostKeyCallback: hostKeyCallback,
+			Timeout:         10 * time.Second,
+		},
+		root:    path.Clean("/" + cfg.RootPath),
+		retries: retries,
+		idle:    make(chan *sftpConn, maxConns),
+		slots:   make(chan struct{}, maxConns),
+	}
+
+	// 启动时验证连接并确保根目录存在
+	if err := s.do(func(conn *sftpConn) error {
+		return s.mkdirAll(conn, s.root)
+	}); err != nil {
+		return nil, fmt.Errorf("failed to connect sftp: %v", err)
+	}
+	return s, nil
+}
+
+// sftpHostKeyCallback 服务器公钥校验：SFTP_HOST_KEY 优先，其次 known_hosts 文件
+// 两者都未配置时拒绝启动，只有显式设置 SFTP_INSECURE_IGNORE_HOST_KEY=true 才跳过校验
+func sftpHostKeyCallback(cfg config.SFTPConfig) (ssh.HostKeyCallback, error) {
+	switch {
+	case cfg.HostKey != "":
+		hostKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(cfg.HostKey))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse sftp host key: %v", err)
+		}
+		return ssh.FixedHostKey(hostKey), nil
+	case cfg.KnownHosts != "":
+		callback, err := knownhosts.New(cfg.KnownHosts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load sftp known_hosts: %v", err)
+		}
+		return callback, nil
+	case cfg.InsecureIgnoreHostKey:
+		log.Printf("警告: SFTP_INSECURE_IGNORE_HOST_KEY=true，不校验 SFTP 服务器公钥，连接可能被中间人劫持")
+		return ssh.InsecureIgnoreHostKey(), nil
+	}
+	return nil, fmt.Errorf("SFTP_HOST_KEY or SFTP_KNOWN_HOSTS is required for sftp storage (set SFTP_INSECURE_IGNORE_HOST_KEY=true to skip host key verification)")
+}
+
+// dial 新建 SSH 连接并打开 SFTP 会话
+func (s *SFTPStorage) dial() (*sftpConn, error) {
+	sshClient, err := ssh.Dial("tcp", s.addr, s.sshConfig)
+	if err != nil {
+		return nil, err
+	}
+	client, err := sftp.NewClient(sshClient)
+	if err != nil {
+		sshClient.Close()
+		return nil, err
+	}
+	return &sftpConn{ssh: sshClient, client: client}, nil
+}
+
+// acquire 优先使用空闲连接；连接数未满时新建，否则等待其他连接归还
+func (s *SFTPStorage) acquire() (*sftpConn, error) {
+	select {
+	case conn := <-s.idle:
+		return conn, nil
+	default:
+	}
+	select {
+	case conn := <-s.idle:
+		return conn, nil
+	case s.slots <- struct{}{}:
+		conn, err := s.dial()
+		if err != nil {
+			<-s.slots
+			return nil, err
+		}
+		return conn, nil
+	}
+}
+
+// release 归还连接，已损坏的连接关闭并让出位置
+func (s *SFTPStorage) release(conn *sftpConn) {
+	if !conn.broken {
+		select {
+		case s.idle <- conn:
+			return
+		default:
+		}
+	}
+	conn.Close()
+	<-s.slots
+}
+
+// do 在一个池化连接上执行 fn，遇到网络错误时换新连接重试
+func (s *SFTPStorage) do(fn func(conn *sftpConn) error) error {
+	return retry(s.retries, func() error {
+		return s.once(fn)
+	})
+}
+
+// once 在一个池化连接上执行一次 fn
+func (s *SFTPStorage) once(fn func(conn *sftpConn) error) error {
+	conn, err := s.acquire()
+	if err != nil {
+		return err
+	}
+	err = fn(conn)
+	if isSFTPNetworkError(err) {
+		conn.broken = true
+	}
+	s.release(conn)
+	return err
+}
+
+func (s *SFTPStorage) remotePath(key string) (string, error) {
+	cleaned, err := CleanKey(key)
+	if err != nil {
+		return "", err
+	}
+	return path.Join(s.root, cleaned), nil
+}
+
+// mkdirAll 逐级创建远程目录
+func (s *SFTPStorage) mkdirAll(conn *sftpConn, dir string) error {
+	if err := conn.client.MkdirAll(dir); err != nil {
+		// 可能被并发创建，再确认一次
+		if info, statErr := conn.client.Stat(dir); statErr == nil && info.IsDir() {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+func (s *SFTPStorage) Put(key string, reader io.Reader, contentType string) error {
+	remote, err := s.remotePath(key)
+	if err != nil {
+		return err
+	}
+	return retryPut(s.retries, reader, func(r io.Reader) error {
+		// 重试由外层 retryPut 负责，这里只执行一次
+		return s.once(func(conn *sftpConn) error {
+			return s.upload(conn, remote, r)
+		})
+	})
+}
+
+func (s *SFTPStorage) upload(conn *sftpConn, remote string, r io.Reader) error {
+	if err := s.mkdirAll(conn, path.Dir(remote)); err != nil {
+		return err
+	}
+	file, err := conn.client.OpenFile(remote, os.O_WRONLY|os.O_CREATE|os.O_TRUNC)
+	if err != nil {
+		return err
+	}
+	if _, err := file.ReadFrom(r); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func (s *SFTPStorage) Get(key string) (io.ReadCloser, *FileInfo, error) {
+	remote, err := s.remotePath(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var file *sftpFile
+	var info *FileInfo
+	err = retry(s.retries, func() error {
+		conn, err := s.acquire()
+		if err != nil {
+			return err
+		}
+		remoteFile, err := conn.client.Open(remote)
+		var stat os.FileInfo
+		if err == nil {
+			if stat, err = remoteFile.Stat(); err == nil && stat.IsDir() {
+				err = ErrNotExist
+			}
+			if err != nil {
+				remoteFile.Close()
+			}
+		}
+		if err != nil {
+			err = sftpError(err)
+			if isSFTPNetworkError(err) {
+				conn.broken = true
+			}
+			s.release(conn)
+			return err
+		}
+		// 连接在文件关闭时归还连接池
+		file = &sftpFile{File: remoteFile, conn: conn, release: s.release}
+		info = s.fileInfo(key, stat)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return file, info, nil
+}
+
+func (s *SFTPStorage) Delete(key string) error {
+	remote, err := s.remotePath(key)
+	if err != nil {
+		return err
+	}
+	return s.do(func(conn *sftpConn) error {
+		if err := sftpError(conn.client.Remove(remote)); err != nil && err != ErrNotExist {
+			return err
+		}
+		return nil
+	})
+}
+
+func (s *SFTPStorage) Stat(key string) (*FileInfo, error) {
+	remote, err := s.remotePath(key)
+	if err != nil {
+		return nil, err
+	}
+	var info *FileInfo
+	err = s.do(func(conn *sftpConn) error {
+		stat, err := conn.client.Stat(remote)
+		if err != nil {
+			return sftpError(err)
+		}
+		if stat.IsDir() {
+			return ErrNotExist
+		}
+		info = s.fileInfo(key, stat)
+		return nil
+	})
+	return info, err
+}
+
+func (s *SFTPStorage) List(prefix string) ([]FileInfo, error) {
+	// 从前缀所在的目录开始递归遍历
+	dir := ""
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		dir = prefix[:i]
+	}
+
+	var files []FileInfo
+	err := s.do(func(conn *sftpConn) error {
+		files = nil
+		walker := conn.client.Walk(path.Join(s.root, dir))
+		for walker.Step() {
+			if err := walker.Err(); err != nil {
+				if err = sftpError(err); err == ErrNotExist {
+					continue
+				}
+				return err
+			}
+			stat := walker.Stat()
+			if stat.IsDir() {
+				continue
+			}
+			key := strings.TrimPrefix(strings.TrimPrefix(walker.Path(), s.root), "/")
+			if strings.HasPrefix(key, prefix) {
+				files = append(files, *s.fileInfo(key, stat))
+			}
+		}
+		return nil
+	})
+	return files, err
+}
+
+// URL SFTP 不对外公开，统一经由本应用代理访问
+func (s *SFTPStorage) URL(key string) string {
+	return "/uploads/" + strings.TrimPrefix(key, "/")
+}
+
+func (s *SFTPStorage) fileInfo(key string, stat os.FileInfo) *FileInfo {
+	return &FileInfo{
+		Key:         key,
+		Size:        stat.Size(),
+		ContentType: ContentTypeByKey(key),
+		ModTime:     stat.ModTime(),
+	}
+}
+
+// sftpFile 远程文件读取器，支持 Seek 以便处理 Range 请求，关闭时归还连接
+type sftpFile struct {
+	*sftp.File
+	conn    *sftpConn
+	release func(conn *sftpConn)
+}
+
+func (f *sftpFile) Close() error {
+	err := f.File.Close()
+	if isSFTPNetworkError(err) {
+		f.conn.broken = true
+	}
+	f.release(f.conn)
+	return err
+}
+
+// sftpError 将文件不存在统一转换为 ErrNotExist
+func sftpError(err error) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return ErrNotExist
+	}
+	return err
+}
+
+// isSFTPNetworkError 判断是否为需要重连的错误（非服务端业务错误）
+func isSFTPNetworkError(err error) bool {
+	if err == nil || err == io.EOF || errors.Is(err, ErrNotExist) || errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrPermission) {
+		return false
+	}
+	var statusErr *sftp.StatusError
+	return !errors.As(err, &statusErr)
+}
@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"path"
+	"strings"
+	"time"
+
+	"oneimg/backend/config"
+)
+
+// ErrNotExist 对象不存在
+var ErrNotExist = errors.New("storage: object does not exist")
+
+// FileInfo 存储对象信息
+type FileInfo struct {
+	Key         string    `json:"key"`
+	Size        int64     `json:"size"`
+	ContentType string    `json:"content_type"`
+	ModTime     time.Time `json:"mod_time"`
+}
+
+// Storage 存储后端接口
+// key 为相对于存储根目录的路径，使用 "/" 分隔，例如 20250101/abc.webp
+type Storage interface {
+	// Put 写入对象，已存在时覆盖
+	Put(key string, reader io.Reader, contentType string) error
+	// Get 读取对象，调用方负责关闭返回的 ReadCloser
+	Get(key string) (io.ReadCloser, *FileInfo, error)
+	// Delete 删除对象，对象不存在时不返回错误
+	Delete(key string) error
+	// Stat 获取对象信息，对象不存在时返回 ErrNotExist
+	Stat(key string) (*FileInfo, error)
+	// List 列出指定前缀下的所有对象
+	List(prefix string) ([]FileInfo, error)
+	// URL 返回对象的访问地址
+	URL(key string) string
+}
+
+// 设置全局
+var store Storage
+
+// InitStorage 根据配置初始化存储后端
+func InitStorage(cfg *config.Config) {
+	s, err := NewStorage(cfg)
+	if err != nil {
+		log.Fatal("存储初始化失败:", err)
+	}
+	store = s
+	log.Printf("使用存储驱动: %s", cfg.StorageDriver)
+}
+
+// GetStorage 获取存储实例
+func GetStorage() Storage {
+	return store
+}
+
+// NewStorage 根据配置创建存储后端
+func NewStorage(cfg *config.Config) (Storage, error) {
+	switch cfg.StorageDriver {
+	case "", "local":
+		return NewLocalStorage(cfg.UploadPath)
+	case "s3":
+		// 公开地址绕过本应用，/uploads 签名无法生效
+		if cfg.S3Config.PublicURL != "" && cfg.SignUploads {
+			return nil, fmt.Errorf("S3_PUBLIC_URL cannot be used with SIGN_UPLOADS=true")
+		}
+		return NewS3Storage(cfg.S3Config)
+	case "webdav":
+		return NewWebDAVStorage(cfg.WebDAVConfig, cfg.StorageRetries)
+	case "sftp":
+		return NewSFTPStorage(cfg.SFTPConfig, cfg.StorageRetries)
+	default:
+		return nil, fmt.Errorf("unknown storage driver: %s", cfg.StorageDriver)
+	}
+}
+
+// urlKeyer 可由存储后端实现，用于从其公开地址中还原 key
+type urlKeyer interface {
+	KeyFromURL(url string) (string, bool)
+}
+
+// KeyFromURL 从图片 URL 中提取存储 key
+// URL格式: /uploads/20250101/filename.ext 或存储后端的公开地址
+func KeyFromURL(url string) string {
+	if strings.HasPrefix(url, "/uploads/") {
+		return strings.TrimPrefix(url, "/uploads/")
+	}
+	if keyer, ok := store.(urlKeyer); ok {
+		if key, ok := keyer.KeyFromURL(url); ok {
+			return key
+		}
+	}
+	return url
+}
+
+// CleanKey 规范化 key，拒绝目录遍历
+func CleanKey(key string) (string, error) {
+	cleaned := path.Clean("/" + strings.ReplaceAll(key, "\\", "/"))
+	cleaned = strings.TrimPrefix(cleaned, "/")
+	if cleaned == "" || cleaned == "." || strings.Contains(key, "..") {
+		return "", fmt.Errorf("invalid storage key: %q", key)
+	}
+	return cleaned, nil
+}
+
+// ContentTypeByKey 根据扩展名推断 Content-Type
+func ContentTypeByKey(key string) string {
+	if ct := mime.TypeByExtension(strings.ToLower(path.Ext(key))); ct != "" {
+		return ct
+	}
+	return "application/octet-stream"
+}
@@ -0,0 +1,181 @@
+package storage
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"oneimg/backend/config"
+
+	"github.com/studio-b12/gowebdav"
+)
+
+// WebDAVStorage WebDAV 存储，适用于 NAS / Nextcloud 等
+type WebDAVStorage struct {
+	client  *gowebdav.Client
+	retries int
+}
+
+// NewWebDAVStorage 创建 WebDAV 存储
+// 底层 http.Transport 负责连接复用，MaxConns 控制每个主机保持的空闲连接数
+func NewWebDAVStorage(cfg config.WebDAVConfig, retries int) (*WebDAVStorage, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("WEBDAV_URL is required for webdav storage")
+	}
+
+	maxConns := cfg.MaxConns
+	if maxConns < 1 {
+		maxConns = 8
+	}
+
+	client := gowebdav.NewClient(cfg.URL, cfg.Username, cfg.Password)
+	client.SetTransport(&http.Transport{
+		Proxy:               http.ProxyFromEnvironment,
+		MaxIdleConns:        maxConns,
+		MaxIdleConnsPerHost: maxConns,
+		IdleConnTimeout:     90 * time.Second,
+	})
+	client.SetTimeout(2 * time.Minute)
+
+	if err := retry(retries, client.Connect); err != nil {
+		return nil, fmt.Errorf("failed to connect webdav: %v", err)
+	}
+
+	return &WebDAVStorage{client: client, retries: retries}, nil
+}
+
+func (s *WebDAVStorage) Put(key string, reader io.Reader, contentType string) error {
+	cleaned, err := CleanKey(key)
+	if err != nil {
+		return err
+	}
+	return retryPut(s.retries, reader, func(r io.Reader) error {
+		return s.client.WriteStream(cleaned, r, 0644)
+	})
+}
+
+func (s *WebDAVStorage) Get(key string) (io.ReadCloser, *FileInfo, error) {
+	info, err := s.Stat(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var reader io.ReadCloser
+	err = retry(s.retries, func() error {
+		var err error
+		reader, err = s.client.ReadStream(info.Key)
+		return s.convertError(err)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return reader, info, nil
+}
+
+func (s *WebDAVStorage) Delete(key string) error {
+	cleaned, err := CleanKey(key)
+	if err != nil {
+		return err
+	}
+	// 服务端返回 404 时 gowebdav 已视为成功
+	return retry(s.retries, func() error {
+		return s.client.Remove(cleaned)
+	})
+}
+
+func (s *WebDAVStorage) Stat(key string) (*FileInfo, error) {
+	cleaned, err := CleanKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	var stat os.FileInfo
+	err = retry(s.retries, func() error {
+		var err error
+		stat, err = s.client.Stat(cleaned)
+		return s.convertError(err)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if stat.IsDir() {
+		return nil, ErrNotExist
+	}
+	return s.fileInfo(cleaned, stat), nil
+}
+
+func (s *WebDAVStorage) List(prefix string) ([]FileInfo, error) {
+	// 从前缀所在的目录开始递归遍历，减少不必要的 PROPFIND 请求
+	dir := ""
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		dir = prefix[:i]
+	}
+
+	var files []FileInfo
+	var walk func(dir string) error
+	walk = func(dir string) error {
+		var entries []os.FileInfo
+		err := retry(s.retries, func() error {
+			var err error
+			entries, err = s.client.ReadDir("/" + dir)
+			return s.convertError(err)
+		})
+		if err == ErrNotExist {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			key := path.Join(dir, entry.Name())
+			if entry.IsDir() {
+				if err := walk(key); err != nil {
+					return err
+				}
+				continue
+			}
+			if strings.HasPrefix(key, prefix) {
+				files = append(files, *s.fileInfo(key, entry))
+			}
+		}
+		return nil
+	}
+
+	if err := walk(dir); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// URL WebDAV 通常不对外公开，统一经由本应用代理访问
+func (s *WebDAVStorage) URL(key string) string {
+	return "/uploads/" + strings.TrimPrefix(key, "/")
+}
+
+func (s *WebDAVStorage) fileInfo(key string, stat os.FileInfo) *FileInfo {
+	contentType := ""
+	if f, ok := stat.(interface{ ContentType() string }); ok {
+		contentType = f.ContentType()
+	}
+	if contentType == "" || contentType == "application/octet-stream" {
+		contentType = ContentTypeByKey(key)
+	}
+	return &FileInfo{
+		Key:         key,
+		Size:        stat.Size(),
+		ContentType: contentType,
+		ModTime:     stat.ModTime(),
+	}
+}
+
+// convertError 将 404 统一转换为 ErrNotExist
+func (s *WebDAVStorage) convertError(err error) error {
+	if err != nil && gowebdav.IsErrNotFound(err) {
+		return ErrNotExist
+	}
+	return err
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"log"
+	"os"
 
 	"oneimg/backend/app"
 	"oneimg/backend/routes"
@@ -12,6 +13,17 @@ func main() {
 	system := app.Init()
 	log.Println("应用初始化完成 - DEBUG VERSION 2")
 
+	// 命令行子命令，例如 ./oneimg backfill
+	if len(os.Args) > 1 {
+		if err := app.RunCommand(system, os.Args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// 后台监听收件目录
+	app.StartInboxWatcher(system)
+
 	// 设置路由
 	r := routes.SetupRoutes()
 